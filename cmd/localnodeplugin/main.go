@@ -1,16 +1,28 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"code.cloudfoundry.org/csiplugin"
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/goshims/filepathshim"
 	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagerflags"
+	"code.cloudfoundry.org/local-node-plugin/controller"
+	"code.cloudfoundry.org/local-node-plugin/mtls"
 	"code.cloudfoundry.org/local-node-plugin/node"
 	"code.cloudfoundry.org/local-node-plugin/oshelper"
 	. "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
 	"github.com/tedsuo/ifrit/grpc_server"
 	"github.com/tedsuo/ifrit/sigmon"
 	"google.golang.org/grpc"
@@ -19,7 +31,25 @@ import (
 var atAddress = flag.String(
 	"listenAddr",
 	"0.0.0.0:9760",
-	"host:port to serve on",
+	"unix:///path/to.sock or host:port to serve on. Any host that can reach a TCP port can mount volumes, so prefer a unix socket",
+)
+
+var socketMode = flag.String(
+	"socketMode",
+	"0660",
+	"Octal file mode of the unix socket given in listenAddr",
+)
+
+var socketUid = flag.Int(
+	"socketUid",
+	-1,
+	"User to own the unix socket given in listenAddr. Left as the plugin's user when -1",
+)
+
+var socketGid = flag.Int(
+	"socketGid",
+	-1,
+	"Group to own the unix socket given in listenAddr. Left as the plugin's group when -1",
 )
 
 var pluginsPath = flag.String(
@@ -40,6 +70,108 @@ var nodeId = flag.String(
 	"ID of the current node",
 )
 
+var tlsCertFile = flag.String(
+	"tlsCertFile",
+	"",
+	"Path to the server certificate to serve TCP connections with. Requires tlsKeyFile and tlsClientCAFile",
+)
+
+var tlsKeyFile = flag.String(
+	"tlsKeyFile",
+	"",
+	"Path to the private key of the server certificate",
+)
+
+var tlsClientCAFile = flag.String(
+	"tlsClientCAFile",
+	"",
+	"Path to the CA that client certificates must be signed by. Connections without one are refused",
+)
+
+var tlsCAFile = flag.String(
+	"tlsCAFile",
+	"",
+	"Path to the CA that signed tlsCertFile, written to the plugin spec so clients can verify the plugin",
+)
+
+var tlsAllowedClients = flag.String(
+	"tlsAllowedClients",
+	"",
+	"Comma separated list of client certificate common names or subject alternative names allowed to connect, e.g. the cell's volume manager. Any client of tlsClientCAFile is allowed when empty",
+)
+
+var usageRefreshInterval = flag.Duration(
+	"usageRefreshInterval",
+	30*time.Second,
+	"How long the walked disk usage of a volume is cached before it is recomputed",
+)
+
+var maxConcurrentUsageWalks = flag.Int(
+	"maxConcurrentUsageWalks",
+	2,
+	"Maximum number of volume directories walked concurrently to compute disk usage",
+)
+
+var defaultBackend = flag.String(
+	"defaultBackend",
+	node.DirectoryBackend,
+	"Backend for volumes that do not request one in their backend attribute: directory or loopback",
+)
+
+var enableQuotas = flag.Bool(
+	"enableQuotas",
+	false,
+	"Limit volumes to their capacity attribute using project quotas, or loopback images where project quotas are unavailable",
+)
+
+var allowedTargetRoots = flag.String(
+	"allowedTargetRoots",
+	"",
+	"Comma separated list of directories that staging and target paths must be beneath, e.g. the Diego volume mount root. Any path is allowed when empty",
+)
+
+var stateDir = flag.String(
+	"stateDir",
+	"",
+	"Path to directory where the journal of published volumes is kept so they can be recovered after a restart, along with what each volume was created from. Its parent must already exist. Defaults to .state under volumesRoot",
+)
+
+var orphanCollectionInterval = flag.Duration(
+	"orphanCollectionInterval",
+	10*time.Minute,
+	"How often bind mounts of volume directories that no stage or publish accounts for are unmounted. When zero they are only collected at startup. Nothing is collected until the journal has been kept across a restart, and orphans are only logged without allowedTargetRoots",
+)
+
+var orphanCollectionDryRun = flag.Bool(
+	"orphanCollectionDryRun",
+	false,
+	"Log orphaned bind mounts instead of unmounting them",
+)
+
+var snapshotHardlinkFallback = flag.Bool(
+	"snapshotHardlinkFallback",
+	false,
+	"Hard link files into snapshots when the filesystem cannot reflink them, rather than copying them. Quicker, but files rewritten in place change their snapshots too",
+)
+
+var copyWorkers = flag.Int(
+	"copyWorkers",
+	4,
+	"Number of files copied at once when snapshotting or cloning a volume on a filesystem that cannot reflink them",
+)
+
+var copyBytesPerSecond = flag.Int64(
+	"copyBytesPerSecond",
+	0,
+	"Limit on how fast files are copied when snapshotting or cloning a volume on a filesystem that cannot reflink them. Unlimited when zero",
+)
+
+var enableController = flag.Bool(
+	"enableController",
+	false,
+	"Also serve the CSI controller service, creating and deleting volumes under volumesRoot, so no separate controller plugin is needed",
+)
+
 func main() {
 	parseCommandLine()
 
@@ -48,21 +180,80 @@ func main() {
 	defer logger.Info("end")
 
 	listenAddress := *atAddress
+	network, address, err := parseListenAddress(listenAddress)
+	if err != nil {
+		logger.Fatal("invalid-listen-address", err, lager.Data{"listenAddr": listenAddress})
+	}
 
-	err := csiplugin.WriteSpec(logger, *pluginsPath, csiplugin.CsiPluginSpec{Name: node.NODE_PLUGIN_ID, Address: listenAddress})
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil || mode&^uint64(os.ModePerm) != 0 {
+		logger.Fatal("invalid-socket-mode", errors.New("socket mode must be octal permission bits"), lager.Data{"socketMode": *socketMode})
+	}
+	socketFileMode := os.FileMode(mode)
+
+	tlsConfig, err := serverTLSConfig(logger, network)
 	if err != nil {
-		logger.Fatal("exited-with-failure:", err)
+		logger.Fatal("invalid-tls-config", err)
+	}
+
+	if !node.IsValidBackend(*defaultBackend) {
+		logger.Fatal("invalid-default-backend", errors.New("default backend must be directory or loopback"), lager.Data{"defaultBackend": *defaultBackend})
 	}
 
 	os := &osshim.OsShim{}
-	node := node.NewLocalNode(os, oshelper.NewOsHelper(os), &filepathshim.FilepathShim{}, logger, *volumesRoot, *nodeId)
-	server := grpc_server.NewGRPCServer(listenAddress, nil, node, RegisterServices)
+	filepath := &filepathshim.FilepathShim{}
+	usage := node.NewDirUsageAccountant(filepath, clock.NewClock(), *usageRefreshInterval, *maxConcurrentUsageWalks)
+	journal, err := node.NewFilePublishJournal(publishJournalDir())
+	if err != nil {
+		logger.Fatal("create-publish-journal-failed", err)
+	}
+	node := node.NewLocalNode(os, oshelper.NewOsHelper(os), filepath, logger, *volumesRoot, *nodeId, node.Options{
+		Usage:              usage,
+		Journal:            journal,
+		Specs:              node.NewFileVolumeSpecs(volumeSpecsDir()),
+		QuotasEnabled:      *enableQuotas,
+		DefaultBackend:     *defaultBackend,
+		AllowedTargetRoots: parseList(*allowedTargetRoots),
+		ControllerService:  *enableController,
+		Copy: node.CopyOptions{
+			LinkFallback:   *snapshotHardlinkFallback,
+			Workers:        *copyWorkers,
+			BytesPerSecond: *copyBytesPerSecond,
+		},
+	})
+	err = node.Reconcile(logger)
+	if err != nil {
+		logger.Error("reconcile-published-volumes-failed", err)
+	}
+	err = node.CollectOrphans(logger, *orphanCollectionDryRun)
+	if err != nil {
+		logger.Error("collect-orphans-failed", err)
+	}
+	registerServices := RegisterServices
+	if *enableController {
+		registerServices = withController(controller.NewLocalController(logger, node))
+	}
+	var server ifrit.Runner
+	if network == "unix" {
+		server = unixSocketServer(logger, address, socketFileMode, *socketUid, *socketGid, node, registerServices)
+	} else {
+		server = grpc_server.NewGRPCServer(address, tlsConfig, node, registerServices)
+	}
 
-	monitor := ifrit.Invoke(sigmon.New(server))
+	// the spec is only written once the server is listening
+	spec := newPluginSpec(listenAddress, network, tlsConfig != nil)
+	members := grouper.Members{
+		{Name: "grpc-server", Runner: server},
+		{Name: "plugin-spec", Runner: pluginSpecRunner(logger, *pluginsPath, spec)},
+	}
+	if *orphanCollectionInterval > 0 {
+		members = append(members, grouper.Member{Name: "orphan-collector", Runner: orphanCollector(logger, node)})
+	}
+
+	monitor := ifrit.Invoke(sigmon.New(grouper.NewOrdered(syscall.SIGINT, members)))
 	logger.Info("started")
 
 	err = <-monitor.Wait()
-
 	if err != nil {
 		logger.Fatal("exited-with-failure:", err)
 	}
@@ -73,7 +264,75 @@ func parseCommandLine() {
 	flag.Parse()
 }
 
+func parseList(list string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// serverTLSConfig requires client certificates on TCP connections when the
+// TLS flags are given. Unix sockets are protected by their file mode instead.
+func serverTLSConfig(logger lager.Logger, network string) (*tls.Config, error) {
+	files := mtls.Files{CertFile: *tlsCertFile, KeyFile: *tlsKeyFile, ClientCAFile: *tlsClientCAFile}
+	if files == (mtls.Files{}) {
+		return nil, nil
+	}
+
+	if files.CertFile == "" || files.KeyFile == "" || files.ClientCAFile == "" {
+		return nil, errors.New("tlsCertFile, tlsKeyFile and tlsClientCAFile must be given together")
+	}
+	if network != "tcp" {
+		return nil, errors.New("TLS is only supported when listening on TCP")
+	}
+
+	return mtls.NewServerConfig(logger, files, parseList(*tlsAllowedClients))
+}
+
+func orphanCollector(logger lager.Logger, localNode *node.LocalNode) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		ticker := time.NewTicker(*orphanCollectionInterval)
+		defer ticker.Stop()
+		close(ready)
+
+		for {
+			select {
+			case <-ticker.C:
+				err := localNode.CollectOrphans(logger, *orphanCollectionDryRun)
+				if err != nil {
+					logger.Error("collect-orphans-failed", err)
+				}
+			case <-signals:
+				return nil
+			}
+		}
+	})
+}
+
+func publishJournalDir() string {
+	if *stateDir != "" {
+		return *stateDir
+	}
+	return filepath.Join(*volumesRoot, node.StateDir)
+}
+
+func volumeSpecsDir() string {
+	return filepath.Join(publishJournalDir(), node.VolumeSpecsDir)
+}
+
 func RegisterServices(s *grpc.Server, srv interface{}) {
 	RegisterNodeServer(s, srv.(NodeServer))
 	RegisterIdentityServer(s, srv.(IdentityServer))
+	node.RegisterAdminServer(s, srv.(node.AdminServer))
+}
+
+func withController(controller ControllerServer) func(*grpc.Server, interface{}) {
+	return func(s *grpc.Server, srv interface{}) {
+		RegisterServices(s, srv)
+		RegisterControllerServer(s, controller)
+	}
 }
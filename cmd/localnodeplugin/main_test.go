@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"encoding/json"
 	"net"
 	"os/exec"
 
@@ -9,17 +10,19 @@ import (
 	"github.com/onsi/gomega/gexec"
 	"os"
 	"io/ioutil"
+	"path/filepath"
 )
 
 var _ = Describe("Main", func() {
 	var (
-		session *gexec.Session
-		command *exec.Cmd
-		err     error
+		session    *gexec.Session
+		command    *exec.Cmd
+		err        error
+		pluginsDir string
 	)
 
 	BeforeEach(func() {
-		pluginsDir, err := ioutil.TempDir(os.TempDir(), "plugin-path")
+		pluginsDir, err = ioutil.TempDir(os.TempDir(), "plugin-path")
 		Expect(err).ToNot(HaveOccurred())
 
 		os.MkdirAll(pluginsDir, os.ModePerm)
@@ -45,5 +48,119 @@ var _ = Describe("Main", func() {
       }, 5).ShouldNot(HaveOccurred())
     })
 
+		Context("the plugin spec", func() {
+			var specFile string
+
+			BeforeEach(func() {
+				specFile = filepath.Join(pluginsDir, "org.cloudfoundry.code.local-node-plugin.json")
+			})
+
+			statSpec := func() error {
+				_, err := os.Stat(specFile)
+				return err
+			}
+
+			It("says how to connect to the plugin", func() {
+				Eventually(statSpec, 5).ShouldNot(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(specFile)
+				Expect(err).ToNot(HaveOccurred())
+				var spec map[string]interface{}
+				Expect(json.Unmarshal(contents, &spec)).To(Succeed())
+				Expect(spec).To(HaveKeyWithValue("transport", "tcp"))
+				Expect(spec).To(HaveKeyWithValue("version", "0.1.0"))
+				Expect(spec).NotTo(HaveKey("tls"))
+			})
+
+			It("is removed on shutdown", func() {
+				Eventually(statSpec, 5).ShouldNot(HaveOccurred())
+
+				session.Interrupt()
+				Eventually(session, 5).Should(gexec.Exit(0))
+
+				Expect(os.IsNotExist(statSpec())).To(BeTrue())
+			})
+
+			It("leaves a spec written by another plugin in place on shutdown", func() {
+				Eventually(statSpec, 5).ShouldNot(HaveOccurred())
+				Expect(ioutil.WriteFile(specFile, []byte(`{"name":"org.cloudfoundry.code.local-node-plugin","address":"0.0.0.0:50053"}`), 0644)).To(Succeed())
+
+				session.Interrupt()
+				Eventually(session, 5).Should(gexec.Exit(0))
+
+				Expect(statSpec()).To(Succeed())
+			})
+
+			Context("when the address is already in use", func() {
+				var listener net.Listener
+
+				BeforeEach(func() {
+					listener, err = net.Listen("tcp", "0.0.0.0:50052")
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					listener.Close()
+				})
+
+				It("is never written", func() {
+					Eventually(session, 5).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(Equal(0))
+					Expect(os.IsNotExist(statSpec())).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	Context("with a unix socket address", func() {
+		var socketPath string
+
+		dialSocket := func() error {
+			conn, err := net.Dial("unix", socketPath)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}
+
+		BeforeEach(func() {
+			socketDir, err := ioutil.TempDir(os.TempDir(), "socket-dir")
+			Expect(err).ToNot(HaveOccurred())
+			socketPath = filepath.Join(socketDir, "csi.sock")
+
+			command.Args[2] = "unix://" + socketPath
+			command.Args = append(command.Args, "--socketMode", "0600")
+		})
+
+		It("listens on the socket with the given mode", func() {
+			Eventually(dialSocket, 5).ShouldNot(HaveOccurred())
+
+			info, err := os.Stat(socketPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("removes the socket on shutdown", func() {
+			Eventually(dialSocket, 5).ShouldNot(HaveOccurred())
+
+			session.Interrupt()
+			Eventually(session, 5).Should(gexec.Exit(0))
+
+			_, err := os.Stat(socketPath)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		Context("when a previous run left its socket behind", func() {
+			BeforeEach(func() {
+				listener, err := net.Listen("unix", socketPath)
+				Expect(err).ToNot(HaveOccurred())
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+				listener.Close()
+			})
+
+			It("replaces it", func() {
+				Eventually(dialSocket, 5).ShouldNot(HaveOccurred())
+			})
+		})
 	})
 })
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/csiplugin"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"github.com/tedsuo/ifrit"
+)
+
+// The spec file tells the volume manager how to reach the plugin. It keeps
+// the name and address csiplugin.WriteSpec writes, so readers of that format
+// still find them, and adds the transport, the TLS files needed to connect
+// securely, and the plugin's version and node ID.
+
+type pluginSpec struct {
+	csiplugin.CsiPluginSpec
+	Transport string         `json:"transport"`
+	Version   string         `json:"version"`
+	NodeId    string         `json:"node_id"`
+	TLS       *pluginSpecTLS `json:"tls,omitempty"`
+}
+
+type pluginSpecTLS struct {
+	// CAFile verifies the plugin's certificate
+	CAFile string `json:"ca_file,omitempty"`
+	// CertFile is the plugin's certificate, for clients that pin it
+	CertFile string `json:"cert_file"`
+	// ClientCAFile must have signed the client's certificate
+	ClientCAFile string `json:"client_ca_file"`
+}
+
+func newPluginSpec(listenAddress, network string, tlsEnabled bool) pluginSpec {
+	spec := pluginSpec{
+		CsiPluginSpec: csiplugin.CsiPluginSpec{Name: node.NODE_PLUGIN_ID, Address: listenAddress},
+		Transport:     network,
+		Version:       node.NODE_PLUGIN_VERSION,
+		NodeId:        *nodeId,
+	}
+
+	if tlsEnabled {
+		spec.TLS = &pluginSpecTLS{
+			CAFile:       absPath(*tlsCAFile),
+			CertFile:     absPath(*tlsCertFile),
+			ClientCAFile: absPath(*tlsClientCAFile),
+		}
+	}
+
+	return spec
+}
+
+// writePluginSpec replaces the spec file with a single rename, so the volume
+// manager never reads one that is partly written.
+func writePluginSpec(logger lager.Logger, pluginsDirectory string, spec pluginSpec) error {
+	logger = logger.Session("write-plugin-spec", lager.Data{"path": specPath(pluginsDirectory, spec.Name)})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(specPath(pluginsDirectory, spec.Name)), 0755)
+	if err != nil {
+		return err
+	}
+
+	// not named *.json until it is complete
+	tmp, err := ioutil.TempFile(filepath.Dir(specPath(pluginsDirectory, spec.Name)), "."+spec.Name+".json.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), specPath(pluginsDirectory, spec.Name))
+}
+
+// pluginSpecRunner writes the spec once the members ahead of it in an ordered
+// group, the gRPC server among them, are ready, so the volume manager is never
+// pointed at an address nothing is listening on. The spec is removed again
+// when the runner is signalled.
+func pluginSpecRunner(logger lager.Logger, pluginsDirectory string, spec pluginSpec) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		err := writePluginSpec(logger, pluginsDirectory, spec)
+		if err != nil {
+			logger.Error("write-plugin-spec-failed", err)
+			return err
+		}
+		close(ready)
+
+		<-signals
+		removePluginSpec(logger, pluginsDirectory, spec)
+		return nil
+	})
+}
+
+// removePluginSpec stops the volume manager from dialing a plugin that has
+// shut down. A spec since replaced by another plugin, say one started for the
+// same name while this one was shutting down, is left in place.
+func removePluginSpec(logger lager.Logger, pluginsDirectory string, spec pluginSpec) {
+	logger = logger.Session("remove-plugin-spec", lager.Data{"path": specPath(pluginsDirectory, spec.Name)})
+
+	data, err := ioutil.ReadFile(specPath(pluginsDirectory, spec.Name))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logger.Error("read-plugin-spec-failed", err)
+		return
+	}
+
+	var written pluginSpec
+	err = json.Unmarshal(data, &written)
+	if err != nil || written.Address != spec.Address || written.NodeId != spec.NodeId {
+		logger.Info("plugin-spec-replaced", lager.Data{"address": written.Address, "node id": written.NodeId})
+		return
+	}
+
+	err = os.Remove(specPath(pluginsDirectory, spec.Name))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("remove-plugin-spec-failed", err)
+	}
+}
+
+// specPath is where csiplugin.WriteSpec puts the spec file.
+func specPath(pluginsDirectory string, name string) string {
+	return filepath.Join(pluginsDirectory, name+".json")
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grpc_server"
+	"google.golang.org/grpc"
+)
+
+// A unix domain socket is the usual CSI transport. Unlike a TCP port, which
+// anyone who can reach the host can connect to, only users the socket's mode
+// and ownership allow can use the plugin's unauthenticated API.
+
+// parseListenAddress splits -listenAddr into a network and an address. It
+// accepts unix:///path/to.sock, tcp://host:port or a bare host:port.
+func parseListenAddress(listenAddr string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(listenAddr, "unix://"):
+		path := strings.TrimPrefix(listenAddr, "unix://")
+		if !filepath.IsAbs(path) {
+			return "", "", errors.New("unix socket path must be absolute")
+		}
+		return "unix", filepath.Clean(path), nil
+	case strings.HasPrefix(listenAddr, "tcp://"):
+		return "tcp", strings.TrimPrefix(listenAddr, "tcp://"), nil
+	case strings.Contains(listenAddr, "://"):
+		return "", "", errors.New("listen address must be unix:// or tcp://")
+	}
+	return "tcp", listenAddr, nil
+}
+
+// unixSocketServer serves gRPC on a unix socket as grpc_server.NewGRPCServer
+// does on a TCP port, removing the socket again on shutdown. uid and gid are
+// left unchanged when -1.
+func unixSocketServer(logger lager.Logger, path string, mode os.FileMode, uid, gid int, handler interface{}, register grpc_server.RegisterFunc) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		logger := logger.Session("unix-socket-server", lager.Data{"path": path})
+
+		listener, err := listenUnix(logger, path, mode, uid, gid)
+		if err != nil {
+			logger.Error("listen-failed", err)
+			return err
+		}
+		defer removeSocket(logger, path)
+
+		server := grpc.NewServer()
+		register(server, handler)
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.Serve(listener)
+		}()
+		close(ready)
+		logger.Info("listening")
+
+		select {
+		case <-signals:
+			server.GracefulStop()
+			return nil
+		case err := <-errs:
+			logger.Error("serve-failed", err)
+			return err
+		}
+	})
+}
+
+// listenUnix replaces a socket left behind by a plugin that did not shut down
+// cleanly, unless another plugin is still serving on it.
+func listenUnix(logger lager.Logger, path string, mode os.FileMode, uid, gid int) (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(path)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another process is serving on %s", path)
+		}
+
+		logger.Info("remove-stale-socket")
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// connecting needs write permission, which the usual umask denies group
+	// and others until the mode is set
+	err = os.Chown(path, uid, gid)
+	if err == nil {
+		err = os.Chmod(path, mode)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func removeSocket(logger lager.Logger, path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("remove-socket-failed", err)
+	}
+}
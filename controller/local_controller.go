@@ -0,0 +1,408 @@
+package controller
+
+import (
+	"strconv"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Volumes are local to the node, so the controller does nothing a node could
+// not and is only embedded in the node plugin for single-node deployments.
+// Every volume lives under the node's volumes root, which is where the
+// controller looks them up.
+
+//go:generate counterfeiter -o controllerfakes/fake_volumes.go . Volumes
+type Volumes interface {
+	ProvisionVolume(logger lager.Logger, volumeId string, spec node.VolumeSpec) (node.VolumeSpec, error)
+	VolumeExists(logger lager.Logger, volumeId string) (bool, error)
+	VolumeIds(logger lager.Logger) ([]string, error)
+	CheckVolumeCapabilities(logger lager.Logger, volumeContext map[string]string, capabilities []*csi.VolumeCapability) error
+	AvailableCapacity(logger lager.Logger) (int64, error)
+	DeleteVolume(ctx context.Context, in *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error)
+	CreateSnapshot(logger lager.Logger, snapshotId, sourceVolumeId string) (node.Snapshot, error)
+	DeleteSnapshot(logger lager.Logger, snapshotId string) error
+	Snapshots(logger lager.Logger) ([]node.Snapshot, error)
+}
+
+type LocalController struct {
+	logger  lager.Logger
+	volumes Volumes
+}
+
+func NewLocalController(logger lager.Logger, volumes Volumes) *LocalController {
+	return &LocalController{
+		logger:  logger,
+		volumes: volumes,
+	}
+}
+
+func (lc *LocalController) CreateVolume(ctx context.Context, in *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	logger := lc.logger.Session("create-volume")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetName()
+	if volId == "" {
+		errorDescription := "Volume name is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if len(in.GetVolumeCapabilities()) == 0 {
+		errorDescription := "Volume capabilities are missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	volumeContext := map[string]string{}
+	for key, value := range in.GetParameters() {
+		volumeContext[key] = value
+	}
+
+	capacity := in.GetCapacityRange().GetRequiredBytes()
+	if capacity == 0 {
+		capacity = in.GetCapacityRange().GetLimitBytes()
+	}
+
+	source := in.GetVolumeContentSource()
+	if source != nil && source.GetSnapshot() == nil && source.GetVolume() == nil {
+		errorDescription := "Volume content source must be a snapshot or a volume"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	err := lc.volumes.CheckVolumeCapabilities(logger, volumeContext, in.GetVolumeCapabilities())
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := lc.volumes.ProvisionVolume(logger, volId, node.VolumeSpec{
+		SnapshotId:     source.GetSnapshot().GetSnapshotId(),
+		SourceVolumeId: source.GetVolume().GetVolumeId(),
+		Backend:        volumeContext[node.BackendAttribute],
+		CapacityBytes:  capacity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the volume may already exist, or take its backend and capacity from
+	// its source, so it is staged with what it was created with
+	if spec.Backend != "" {
+		volumeContext[node.BackendAttribute] = spec.Backend
+	}
+	if spec.CapacityBytes > 0 {
+		volumeContext[node.CapacityAttribute] = strconv.FormatInt(spec.CapacityBytes, 10)
+	}
+
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volId,
+			CapacityBytes: spec.CapacityBytes,
+			VolumeContext: volumeContext,
+			ContentSource: source,
+		},
+	}, nil
+}
+
+func (lc *LocalController) DeleteVolume(ctx context.Context, in *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	return lc.volumes.DeleteVolume(ctx, in)
+}
+
+func (lc *LocalController) ControllerPublishVolume(ctx context.Context, in *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "ControllerPublishVolume is not supported")
+}
+
+func (lc *LocalController) ControllerUnpublishVolume(ctx context.Context, in *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "ControllerUnpublishVolume is not supported")
+}
+
+func (lc *LocalController) ValidateVolumeCapabilities(ctx context.Context, in *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	logger := lc.logger.Session("validate-volume-capabilities")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetVolumeId()
+	if volId == "" {
+		errorDescription := "Volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if len(in.GetVolumeCapabilities()) == 0 {
+		errorDescription := "Volume capabilities are missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	exists, err := lc.volumes.VolumeExists(logger, volId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		errorDescription := "Volume does not exist"
+		return nil, grpc.Errorf(codes.NotFound, errorDescription)
+	}
+
+	err = lc.volumes.CheckVolumeCapabilities(logger, in.GetVolumeContext(), in.GetVolumeCapabilities())
+	if err != nil {
+		// an unsupported capability is an answer, not a failed request
+		grpcStatus, _ := status.FromError(err)
+		if grpcStatus.Code() != codes.InvalidArgument {
+			return nil, err
+		}
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: grpcStatus.Message()}, nil
+	}
+
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      in.GetVolumeContext(),
+			VolumeCapabilities: in.GetVolumeCapabilities(),
+			Parameters:         in.GetParameters(),
+		},
+	}, nil
+}
+
+// ListVolumes pages through the volumes in ID order.
+func (lc *LocalController) ListVolumes(ctx context.Context, in *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	logger := lc.logger.Session("list-volumes")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	volumeIds, err := lc.volumes.VolumeIds(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, nextToken, err := page(logger, len(volumeIds), in.GetMaxEntries(), in.GetStartingToken())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &csi.ListVolumesResponse{Entries: []*csi.ListVolumesResponse_Entry{}, NextToken: nextToken}
+	for _, volumeId := range volumeIds[start:end] {
+		resp.Entries = append(resp.Entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{VolumeId: volumeId},
+		})
+	}
+
+	return resp, nil
+}
+
+func (lc *LocalController) GetCapacity(ctx context.Context, in *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	logger := lc.logger.Session("get-capacity")
+
+	if len(in.GetVolumeCapabilities()) > 0 {
+		err := lc.volumes.CheckVolumeCapabilities(logger, in.GetParameters(), in.GetVolumeCapabilities())
+		if err != nil {
+			// no capacity is available for volumes that can't be created, but
+			// a failure to check is not the same as a full disk
+			grpcStatus, _ := status.FromError(err)
+			if grpcStatus.Code() != codes.InvalidArgument {
+				return nil, err
+			}
+			return &csi.GetCapacityResponse{}, nil
+		}
+	}
+
+	available, err := lc.volumes.AvailableCapacity(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.GetCapacityResponse{AvailableCapacity: available}, nil
+}
+
+func (lc *LocalController) ControllerGetCapabilities(ctx context.Context, in *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
+	return &csi.ControllerGetCapabilitiesResponse{Capabilities: []*csi.ControllerServiceCapability{
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+				},
+			},
+		},
+		{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+				},
+			},
+		},
+	}}, nil
+}
+
+func (lc *LocalController) CreateSnapshot(ctx context.Context, in *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	logger := lc.logger.Session("create-snapshot")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if in.GetName() == "" {
+		errorDescription := "Snapshot name is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if in.GetSourceVolumeId() == "" {
+		errorDescription := "Source volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	snapshot, err := lc.volumes.CreateSnapshot(logger, in.GetName(), in.GetSourceVolumeId())
+	if err != nil {
+		return nil, err
+	}
+
+	csiSnapshot, err := toCsiSnapshot(snapshot)
+	if err != nil {
+		logger.Error("convert-creation-time-failed", err)
+		errorDescription := "Error reading snapshot creation time"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return &csi.CreateSnapshotResponse{Snapshot: csiSnapshot}, nil
+}
+
+func (lc *LocalController) DeleteSnapshot(ctx context.Context, in *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	logger := lc.logger.Session("delete-snapshot")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if in.GetSnapshotId() == "" {
+		errorDescription := "Snapshot ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	err := lc.volumes.DeleteSnapshot(logger, in.GetSnapshotId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// ListSnapshots pages through the snapshots in ID order, optionally only
+// those of one volume or the one with a given ID.
+func (lc *LocalController) ListSnapshots(ctx context.Context, in *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	logger := lc.logger.Session("list-snapshots")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	all, err := lc.volumes.Snapshots(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []node.Snapshot{}
+	for _, snapshot := range all {
+		if in.GetSnapshotId() != "" && snapshot.SnapshotId != in.GetSnapshotId() {
+			continue
+		}
+		if in.GetSourceVolumeId() != "" && snapshot.SourceVolumeId != in.GetSourceVolumeId() {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	start, end, nextToken, err := page(logger, len(snapshots), in.GetMaxEntries(), in.GetStartingToken())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &csi.ListSnapshotsResponse{Entries: []*csi.ListSnapshotsResponse_Entry{}, NextToken: nextToken}
+	for _, snapshot := range snapshots[start:end] {
+		csiSnapshot, err := toCsiSnapshot(snapshot)
+		if err != nil {
+			logger.Error("convert-creation-time-failed", err, lager.Data{"snapshot id": snapshot.SnapshotId})
+			errorDescription := "Error reading snapshot creation time"
+			return nil, grpc.Errorf(codes.Internal, errorDescription)
+		}
+		resp.Entries = append(resp.Entries, &csi.ListSnapshotsResponse_Entry{Snapshot: csiSnapshot})
+	}
+
+	return resp, nil
+}
+
+func (lc *LocalController) ControllerExpandVolume(ctx context.Context, in *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "ControllerExpandVolume is not supported")
+}
+
+func (lc *LocalController) ControllerGetVolume(ctx context.Context, in *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	return nil, grpc.Errorf(codes.Unimplemented, "ControllerGetVolume is not supported")
+}
+
+// page picks the entries of a list to return. The token is the index of the
+// next entry.
+func page(logger lager.Logger, count int, maxEntries int32, startingToken string) (int, int, string, error) {
+	if maxEntries < 0 {
+		errorDescription := "Max entries must not be negative"
+		return 0, 0, "", grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	start := 0
+	if startingToken != "" {
+		var err error
+		start, err = strconv.Atoi(startingToken)
+		if err != nil || start < 0 || start > count {
+			logger.Info("invalid-starting-token", lager.Data{"token": startingToken})
+			errorDescription := "Starting token is invalid"
+			return 0, 0, "", grpc.Errorf(codes.Aborted, errorDescription)
+		}
+	}
+
+	end := count
+	if max := int(maxEntries); max > 0 && start+max < end {
+		end = start + max
+	}
+
+	nextToken := ""
+	if end < count {
+		nextToken = strconv.Itoa(end)
+	}
+
+	return start, end, nextToken, nil
+}
+
+func toCsiSnapshot(snapshot node.Snapshot) (*csi.Snapshot, error) {
+	creationTime, err := ptypes.TimestampProto(snapshot.CreationTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.Snapshot{
+		SnapshotId:     snapshot.SnapshotId,
+		SourceVolumeId: snapshot.SourceVolumeId,
+		SizeBytes:      snapshot.SizeBytes,
+		CreationTime:   creationTime,
+		ReadyToUse:     true,
+	}, nil
+}
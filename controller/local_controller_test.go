@@ -0,0 +1,476 @@
+package controller_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/controller"
+	"code.cloudfoundry.org/local-node-plugin/controller/controllerfakes"
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+var _ = Describe("LocalController", func() {
+	var (
+		ctx              context.Context
+		err              error
+		fakeVolumes      *controllerfakes.FakeVolumes
+		localController  *controller.LocalController
+		volumeCapability *csi.VolumeCapability
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fakeVolumes = &controllerfakes.FakeVolumes{}
+		localController = controller.NewLocalController(lagertest.NewTestLogger("local-controller"), fakeVolumes)
+		volumeCapability = &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
+	})
+
+	Describe("CreateVolume", func() {
+		var (
+			request *csi.CreateVolumeRequest
+			resp    *csi.CreateVolumeResponse
+		)
+
+		BeforeEach(func() {
+			request = &csi.CreateVolumeRequest{
+				Name:               "test-volume-id",
+				CapacityRange:      &csi.CapacityRange{RequiredBytes: 1073741824},
+				VolumeCapabilities: []*csi.VolumeCapability{volumeCapability},
+				Parameters:         map[string]string{node.BackendAttribute: node.LoopbackBackend},
+			}
+		})
+
+		BeforeEach(func() {
+			fakeVolumes.ProvisionVolumeStub = func(logger lager.Logger, volumeId string, spec node.VolumeSpec) (node.VolumeSpec, error) {
+				return spec, nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			resp, err = localController.CreateVolume(ctx, request)
+		})
+
+		It("provisions the volume and hands its parameters and capacity to the node in the volume context", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVolumes.ProvisionVolumeCallCount()).To(Equal(1))
+			_, volumeId, spec := fakeVolumes.ProvisionVolumeArgsForCall(0)
+			Expect(volumeId).To(Equal("test-volume-id"))
+			Expect(spec).To(Equal(node.VolumeSpec{Backend: node.LoopbackBackend, CapacityBytes: 1073741824}))
+
+			Expect(resp.GetVolume().GetVolumeId()).To(Equal("test-volume-id"))
+			Expect(resp.GetVolume().GetCapacityBytes()).To(Equal(int64(1073741824)))
+			Expect(resp.GetVolume().GetVolumeContext()).To(Equal(map[string]string{
+				node.BackendAttribute:  node.LoopbackBackend,
+				node.CapacityAttribute: "1073741824",
+			}))
+		})
+
+		Context("when the name is missing", func() {
+			BeforeEach(func() {
+				request.Name = ""
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume name is missing in request"))
+				Expect(fakeVolumes.ProvisionVolumeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the capabilities are missing", func() {
+			BeforeEach(func() {
+				request.VolumeCapabilities = nil
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume capabilities are missing in request"))
+			})
+		})
+
+		Context("when a capability is not supported", func() {
+			BeforeEach(func() {
+				fakeVolumes.CheckVolumeCapabilitiesReturns(grpc.Errorf(codes.InvalidArgument, "Volume access mode MULTI_NODE_MULTI_WRITER is not supported"))
+			})
+
+			It("returns the error without provisioning the volume", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume access mode MULTI_NODE_MULTI_WRITER is not supported"))
+				Expect(fakeVolumes.ProvisionVolumeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume is created from a snapshot", func() {
+			BeforeEach(func() {
+				request.VolumeContentSource = &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: "test-snapshot-id"}}}
+			})
+
+			It("restores the snapshot into the volume", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, spec := fakeVolumes.ProvisionVolumeArgsForCall(0)
+				Expect(spec.SnapshotId).To(Equal("test-snapshot-id"))
+				Expect(resp.GetVolume().GetContentSource()).To(Equal(request.VolumeContentSource))
+			})
+		})
+
+		Context("when the volume takes its backend and capacity from its source", func() {
+			BeforeEach(func() {
+				request.Parameters = nil
+				request.CapacityRange = nil
+				fakeVolumes.ProvisionVolumeReturns(node.VolumeSpec{SnapshotId: "test-snapshot-id", Backend: node.LoopbackBackend, CapacityBytes: 2147483648}, nil)
+			})
+
+			It("hands them to the node in the volume context", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(resp.GetVolume().GetCapacityBytes()).To(Equal(int64(2147483648)))
+				Expect(resp.GetVolume().GetVolumeContext()).To(Equal(map[string]string{
+					node.BackendAttribute:  node.LoopbackBackend,
+					node.CapacityAttribute: "2147483648",
+				}))
+			})
+		})
+
+		Context("when the volume is cloned from another volume", func() {
+			BeforeEach(func() {
+				request.VolumeContentSource = &csi.VolumeContentSource{Type: &csi.VolumeContentSource_Volume{Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "golden-volume-id"}}}
+			})
+
+			It("copies the source volume into the volume", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeVolumes.ProvisionVolumeCallCount()).To(Equal(1))
+				_, volumeId, spec := fakeVolumes.ProvisionVolumeArgsForCall(0)
+				Expect(volumeId).To(Equal("test-volume-id"))
+				Expect(spec.SourceVolumeId).To(Equal("golden-volume-id"))
+				Expect(spec.SnapshotId).To(BeEmpty())
+				Expect(resp.GetVolume().GetContentSource()).To(Equal(request.VolumeContentSource))
+			})
+
+			Context("when the source volume does not exist", func() {
+				BeforeEach(func() {
+					fakeVolumes.ProvisionVolumeReturns(node.VolumeSpec{}, grpc.Errorf(codes.NotFound, "Source volume does not exist"))
+				})
+
+				It("returns the error", func() {
+					Expect(err).To(matchers.HaveGrpcStatus(codes.NotFound, "Source volume does not exist"))
+				})
+			})
+		})
+
+		Context("when the content source is neither a snapshot nor a volume", func() {
+			BeforeEach(func() {
+				request.VolumeContentSource = &csi.VolumeContentSource{}
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume content source must be a snapshot or a volume"))
+				Expect(fakeVolumes.ProvisionVolumeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume cannot be provisioned", func() {
+			BeforeEach(func() {
+				fakeVolumes.ProvisionVolumeReturns(node.VolumeSpec{}, grpc.Errorf(codes.ResourceExhausted, "No space left to create volume directory"))
+			})
+
+			It("returns the error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.ResourceExhausted, "No space left to create volume directory"))
+			})
+		})
+	})
+
+	Describe("DeleteVolume", func() {
+		It("deletes the volume through the node", func() {
+			_, err = localController.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "test-volume-id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVolumes.DeleteVolumeCallCount()).To(Equal(1))
+			_, request := fakeVolumes.DeleteVolumeArgsForCall(0)
+			Expect(request.GetVolumeId()).To(Equal("test-volume-id"))
+		})
+	})
+
+	Describe("ValidateVolumeCapabilities", func() {
+		var (
+			request *csi.ValidateVolumeCapabilitiesRequest
+			resp    *csi.ValidateVolumeCapabilitiesResponse
+		)
+
+		BeforeEach(func() {
+			request = &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "test-volume-id",
+				VolumeCapabilities: []*csi.VolumeCapability{volumeCapability},
+			}
+			fakeVolumes.VolumeExistsReturns(true, nil)
+		})
+
+		JustBeforeEach(func() {
+			resp, err = localController.ValidateVolumeCapabilities(ctx, request)
+		})
+
+		It("confirms supported capabilities", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetConfirmed().GetVolumeCapabilities()).To(Equal([]*csi.VolumeCapability{volumeCapability}))
+		})
+
+		Context("when a capability is not supported", func() {
+			BeforeEach(func() {
+				fakeVolumes.CheckVolumeCapabilitiesReturns(grpc.Errorf(codes.InvalidArgument, "Mount flag sync is not supported"))
+			})
+
+			It("explains why instead of confirming them", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.GetConfirmed()).To(BeNil())
+				Expect(resp.GetMessage()).To(Equal("Mount flag sync is not supported"))
+			})
+		})
+
+		Context("when the volume does not exist", func() {
+			BeforeEach(func() {
+				fakeVolumes.VolumeExistsReturns(false, nil)
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.NotFound, "Volume does not exist"))
+			})
+		})
+	})
+
+	Describe("ListVolumes", func() {
+		BeforeEach(func() {
+			fakeVolumes.VolumeIdsReturns([]string{"a-volume", "b-volume", "c-volume"}, nil)
+		})
+
+		volumeIds := func(resp *csi.ListVolumesResponse) []string {
+			ids := []string{}
+			for _, entry := range resp.GetEntries() {
+				ids = append(ids, entry.GetVolume().GetVolumeId())
+			}
+			return ids
+		}
+
+		It("lists every volume", func() {
+			resp, err := localController.ListVolumes(ctx, &csi.ListVolumesRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumeIds(resp)).To(Equal([]string{"a-volume", "b-volume", "c-volume"}))
+			Expect(resp.GetNextToken()).To(BeEmpty())
+		})
+
+		It("pages through the volumes", func() {
+			resp, err := localController.ListVolumes(ctx, &csi.ListVolumesRequest{MaxEntries: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumeIds(resp)).To(Equal([]string{"a-volume", "b-volume"}))
+
+			resp, err = localController.ListVolumes(ctx, &csi.ListVolumesRequest{MaxEntries: 2, StartingToken: resp.GetNextToken()})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volumeIds(resp)).To(Equal([]string{"c-volume"}))
+			Expect(resp.GetNextToken()).To(BeEmpty())
+		})
+
+		It("aborts on an invalid starting token", func() {
+			_, err = localController.ListVolumes(ctx, &csi.ListVolumesRequest{StartingToken: "4"})
+			Expect(err).To(matchers.HaveGrpcStatus(codes.Aborted, "Starting token is invalid"))
+		})
+	})
+
+	Describe("GetCapacity", func() {
+		BeforeEach(func() {
+			fakeVolumes.AvailableCapacityReturns(1073741824, nil)
+		})
+
+		It("reports the capacity available under the volumes root", func() {
+			resp, err := localController.GetCapacity(ctx, &csi.GetCapacityRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAvailableCapacity()).To(Equal(int64(1073741824)))
+		})
+
+		It("reports no capacity for volumes that cannot be created", func() {
+			fakeVolumes.CheckVolumeCapabilitiesReturns(grpc.Errorf(codes.InvalidArgument, "Volume filesystem type xfs is not supported"))
+
+			resp, err := localController.GetCapacity(ctx, &csi.GetCapacityRequest{VolumeCapabilities: []*csi.VolumeCapability{volumeCapability}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetAvailableCapacity()).To(BeZero())
+		})
+
+		Context("when the capabilities cannot be checked", func() {
+			BeforeEach(func() {
+				fakeVolumes.CheckVolumeCapabilitiesReturns(grpc.Errorf(codes.Internal, "Error getting volumes root stats"))
+			})
+
+			It("returns the error rather than no capacity", func() {
+				resp, err := localController.GetCapacity(ctx, &csi.GetCapacityRequest{VolumeCapabilities: []*csi.VolumeCapability{volumeCapability}})
+				Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error getting volumes root stats"))
+				Expect(resp).To(BeNil())
+			})
+		})
+
+		Context("when the capacity cannot be read", func() {
+			BeforeEach(func() {
+				fakeVolumes.AvailableCapacityReturns(0, errors.New("statfs failed"))
+			})
+
+			It("returns the error", func() {
+				_, err := localController.GetCapacity(ctx, &csi.GetCapacityRequest{})
+				Expect(err).To(MatchError("statfs failed"))
+			})
+		})
+	})
+
+	Describe("CreateSnapshot", func() {
+		var (
+			request      *csi.CreateSnapshotRequest
+			resp         *csi.CreateSnapshotResponse
+			creationTime time.Time
+		)
+
+		BeforeEach(func() {
+			request = &csi.CreateSnapshotRequest{Name: "test-snapshot-id", SourceVolumeId: "test-volume-id"}
+			creationTime = time.Unix(1500000000, 0)
+			fakeVolumes.CreateSnapshotReturns(node.Snapshot{SnapshotId: "test-snapshot-id", SourceVolumeId: "test-volume-id", CreationTime: creationTime, SizeBytes: 4096}, nil)
+		})
+
+		JustBeforeEach(func() {
+			resp, err = localController.CreateSnapshot(ctx, request)
+		})
+
+		It("snapshots the volume", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVolumes.CreateSnapshotCallCount()).To(Equal(1))
+			_, snapshotId, sourceVolumeId := fakeVolumes.CreateSnapshotArgsForCall(0)
+			Expect(snapshotId).To(Equal("test-snapshot-id"))
+			Expect(sourceVolumeId).To(Equal("test-volume-id"))
+
+			Expect(resp.GetSnapshot().GetSnapshotId()).To(Equal("test-snapshot-id"))
+			Expect(resp.GetSnapshot().GetSourceVolumeId()).To(Equal("test-volume-id"))
+			Expect(resp.GetSnapshot().GetSizeBytes()).To(Equal(int64(4096)))
+			Expect(resp.GetSnapshot().GetCreationTime().GetSeconds()).To(Equal(int64(1500000000)))
+			Expect(resp.GetSnapshot().GetReadyToUse()).To(BeTrue())
+		})
+
+		Context("when the name is missing", func() {
+			BeforeEach(func() {
+				request.Name = ""
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Snapshot name is missing in request"))
+				Expect(fakeVolumes.CreateSnapshotCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the source volume is missing", func() {
+			BeforeEach(func() {
+				request.SourceVolumeId = ""
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Source volume ID is missing in request"))
+			})
+		})
+
+		Context("when the snapshot cannot be created", func() {
+			BeforeEach(func() {
+				fakeVolumes.CreateSnapshotReturns(node.Snapshot{}, grpc.Errorf(codes.AlreadyExists, "Snapshot already exists for another volume"))
+			})
+
+			It("returns the error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.AlreadyExists, "Snapshot already exists for another volume"))
+			})
+		})
+	})
+
+	Describe("DeleteSnapshot", func() {
+		It("deletes the snapshot through the node", func() {
+			_, err = localController.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: "test-snapshot-id"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeVolumes.DeleteSnapshotCallCount()).To(Equal(1))
+			_, snapshotId := fakeVolumes.DeleteSnapshotArgsForCall(0)
+			Expect(snapshotId).To(Equal("test-snapshot-id"))
+		})
+
+		It("requires a snapshot ID", func() {
+			_, err = localController.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{})
+			Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Snapshot ID is missing in request"))
+		})
+	})
+
+	Describe("ListSnapshots", func() {
+		BeforeEach(func() {
+			fakeVolumes.SnapshotsReturns([]node.Snapshot{
+				{SnapshotId: "a-snapshot", SourceVolumeId: "a-volume"},
+				{SnapshotId: "b-snapshot", SourceVolumeId: "b-volume"},
+				{SnapshotId: "c-snapshot", SourceVolumeId: "a-volume"},
+			}, nil)
+		})
+
+		snapshotIds := func(resp *csi.ListSnapshotsResponse) []string {
+			ids := []string{}
+			for _, entry := range resp.GetEntries() {
+				ids = append(ids, entry.GetSnapshot().GetSnapshotId())
+			}
+			return ids
+		}
+
+		It("lists every snapshot", func() {
+			resp, err := localController.ListSnapshots(ctx, &csi.ListSnapshotsRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshotIds(resp)).To(Equal([]string{"a-snapshot", "b-snapshot", "c-snapshot"}))
+		})
+
+		It("lists the snapshots of one volume", func() {
+			resp, err := localController.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SourceVolumeId: "a-volume"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshotIds(resp)).To(Equal([]string{"a-snapshot", "c-snapshot"}))
+		})
+
+		It("looks up one snapshot", func() {
+			resp, err := localController.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SnapshotId: "b-snapshot"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshotIds(resp)).To(Equal([]string{"b-snapshot"}))
+		})
+
+		It("pages through the snapshots", func() {
+			resp, err := localController.ListSnapshots(ctx, &csi.ListSnapshotsRequest{MaxEntries: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshotIds(resp)).To(Equal([]string{"a-snapshot", "b-snapshot"}))
+
+			resp, err = localController.ListSnapshots(ctx, &csi.ListSnapshotsRequest{MaxEntries: 2, StartingToken: resp.GetNextToken()})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshotIds(resp)).To(Equal([]string{"c-snapshot"}))
+			Expect(resp.GetNextToken()).To(BeEmpty())
+		})
+	})
+
+	Describe("ControllerGetCapabilities", func() {
+		It("advertises volume and snapshot management and cloning", func() {
+			resp, err := localController.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			capabilities := resp.GetCapabilities()
+			Expect(capabilities).To(HaveLen(6))
+			Expect(capabilities[0].GetRpc().GetType()).To(Equal(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME))
+			Expect(capabilities[1].GetRpc().GetType()).To(Equal(csi.ControllerServiceCapability_RPC_LIST_VOLUMES))
+			Expect(capabilities[2].GetRpc().GetType()).To(Equal(csi.ControllerServiceCapability_RPC_GET_CAPACITY))
+			Expect(capabilities[3].GetRpc().GetType()).To(Equal(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT))
+			Expect(capabilities[4].GetRpc().GetType()).To(Equal(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS))
+			Expect(capabilities[5].GetRpc().GetType()).To(Equal(csi.ControllerServiceCapability_RPC_CLONE_VOLUME))
+		})
+	})
+
+	Describe("ControllerPublishVolume", func() {
+		It("is not supported", func() {
+			_, err = localController.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{})
+			Expect(err).To(matchers.HaveGrpcStatus(codes.Unimplemented, "ControllerPublishVolume is not supported"))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package matchers
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HaveGrpcStatus succeeds when the actual value is an error carrying the
+// given gRPC status code and message.
+func HaveGrpcStatus(code codes.Code, message string) types.GomegaMatcher {
+	return &grpcStatusMatcher{code: code, message: message}
+}
+
+type grpcStatusMatcher struct {
+	code    codes.Code
+	message string
+}
+
+func (m *grpcStatusMatcher) Match(actual interface{}) (bool, error) {
+	if actual == nil {
+		return false, nil
+	}
+
+	err, ok := actual.(error)
+	if !ok {
+		return false, fmt.Errorf("HaveGrpcStatus expects an error, got %#v", actual)
+	}
+
+	grpcStatus, ok := status.FromError(err)
+	if !ok {
+		return false, nil
+	}
+	return grpcStatus.Code() == m.code && grpcStatus.Message() == m.message, nil
+}
+
+func (m *grpcStatusMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n\t%v\nto have status %v: %q", actual, m.code, m.message)
+}
+
+func (m *grpcStatusMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected\n\t%v\nnot to have status %v: %q", actual, m.code, m.message)
+}
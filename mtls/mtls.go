@@ -0,0 +1,201 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// The server only talks to clients presenting a certificate signed by the
+// client CA, and when allowed clients are given, only to those whose common
+// name or a subject alternative name is one of them. The certificate, key and
+// client CA are read again whenever one of their files changes, so they can
+// be rotated without restarting the plugin.
+
+type Files struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// NewServerConfig loads the files, failing if they cannot be used, and
+// returns a config that keeps them up to date.
+func NewServerConfig(logger lager.Logger, files Files, allowedClients []string) (*tls.Config, error) {
+	store := &store{
+		logger:         logger.Session("mtls"),
+		files:          files,
+		allowedClients: allowedClients,
+	}
+
+	err := store.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// verifyClient checks the chain against the current client CA. Unlike
+		// VerifyPeerCertificate, VerifyConnection also runs when a session is
+		// resumed, so a client the current CA no longer trusts cannot resume
+		// one it started under the old CA.
+		ClientAuth:       tls.RequireAnyClientCert,
+		GetCertificate:   store.getCertificate,
+		VerifyConnection: store.verifyClient,
+	}, nil
+}
+
+type store struct {
+	logger         lager.Logger
+	files          Files
+	allowedClients []string
+
+	lock        sync.Mutex
+	modTimes    []time.Time
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+func (s *store) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificate, _ := s.current()
+	return certificate, nil
+}
+
+func (s *store) verifyClient(state tls.ConnectionState) error {
+	_, clientCAs := s.current()
+
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("client certificate is missing")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		s.logger.Info("client-certificate-rejected", lager.Data{"subject": certs[0].Subject.String(), "reason": err.Error()})
+		return err
+	}
+
+	if !s.allowed(certs[0]) {
+		s.logger.Info("client-not-allowed", lager.Data{"subject": certs[0].Subject.String()})
+		return fmt.Errorf("client %s is not allowed", certs[0].Subject.CommonName)
+	}
+
+	return nil
+}
+
+func (s *store) allowed(cert *x509.Certificate) bool {
+	if len(s.allowedClients) == 0 {
+		return true
+	}
+
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, name := range names {
+		for _, allowed := range s.allowedClients {
+			if name != "" && name == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// current reloads the files if any of them changed since they were last
+// read. If they cannot be used, say because only some of them have been
+// replaced so far, the ones already loaded are kept until they change again.
+func (s *store) current() (*tls.Certificate, *x509.CertPool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	modTimes, err := s.modTimesLocked()
+	if err == nil && !sameTimes(modTimes, s.modTimes) {
+		s.modTimes = modTimes
+		err = s.loadLocked()
+	}
+	if err != nil {
+		s.logger.Error("reload-failed", err)
+	}
+
+	return s.certificate, s.clientCAs
+}
+
+func (s *store) reload() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	modTimes, err := s.modTimesLocked()
+	if err != nil {
+		return err
+	}
+	s.modTimes = modTimes
+
+	return s.loadLocked()
+}
+
+func (s *store) loadLocked() error {
+	certificate, err := tls.LoadX509KeyPair(s.files.CertFile, s.files.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	caPEM, err := ioutil.ReadFile(s.files.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in %s", s.files.ClientCAFile)
+	}
+
+	s.certificate = &certificate
+	s.clientCAs = clientCAs
+	s.logger.Info("loaded", lager.Data{"cert file": s.files.CertFile, "client ca file": s.files.ClientCAFile})
+	return nil
+}
+
+func (s *store) modTimesLocked() ([]time.Time, error) {
+	modTimes := []time.Time{}
+	for _, path := range []string{s.files.CertFile, s.files.KeyFile, s.files.ClientCAFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func sameTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,13 @@
+package mtls_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestMtls(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mtls Suite")
+}
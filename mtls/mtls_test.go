@@ -0,0 +1,300 @@
+package mtls_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/mtls"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type certAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCertAuthority(name string) *certAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return &certAuthority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for the common name and DNS names.
+func (ca *certAuthority) issue(usage x509.ExtKeyUsage, commonName string, dnsNames ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+var _ = Describe("NewServerConfig", func() {
+	var (
+		allowedClients []string
+		clientCA       *certAuthority
+		config         *tls.Config
+		err            error
+		files          mtls.Files
+		serverCA       *certAuthority
+		testLogger     *lagertest.TestLogger
+		tmpDir         string
+	)
+
+	writeFile := func(path string, contents []byte, modTime time.Time) {
+		Expect(ioutil.WriteFile(path, contents, 0600)).To(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+
+	writeServerCert := func(commonName string, modTime time.Time) {
+		cert, key := serverCA.issue(x509.ExtKeyUsageServerAuth, commonName, "localhost")
+		writeFile(files.CertFile, cert, modTime)
+		writeFile(files.KeyFile, key, modTime)
+	}
+
+	clientConfig := func(clientCert []byte, clientKey []byte) *tls.Config {
+		roots := x509.NewCertPool()
+		roots.AddCert(serverCA.cert)
+		clientConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if clientCert != nil {
+			certificate, err := tls.X509KeyPair(clientCert, clientKey)
+			Expect(err).NotTo(HaveOccurred())
+			clientConfig.Certificates = []tls.Certificate{certificate}
+		}
+		return clientConfig
+	}
+
+	// connect dials the server, returning the client's view of the connection
+	// or the error the server hit
+	connect := func(clientConfig *tls.Config) (tls.ConnectionState, error) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		serverErr := make(chan error, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			defer conn.Close()
+			server := tls.Server(conn, config)
+			err = server.Handshake()
+			if err == nil {
+				// TLS 1.3 session tickets only reach a client that reads
+				_, err = server.Write([]byte{0})
+			}
+			serverErr <- err
+		}()
+
+		client, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		if err == nil {
+			defer client.Close()
+			client.Read(make([]byte, 1))
+		}
+
+		err = <-serverErr
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		return client.ConnectionState(), nil
+	}
+
+	// handshake connects as a client with the given certificate, returning
+	// the server's certificate or the error the server hit
+	handshake := func(clientCert []byte, clientKey []byte) (*x509.Certificate, error) {
+		state, err := connect(clientConfig(clientCert, clientKey))
+		if err != nil {
+			return nil, err
+		}
+		return state.PeerCertificates[0], nil
+	}
+
+	BeforeEach(func() {
+		tmpDir, err = ioutil.TempDir("", "mtls")
+		Expect(err).NotTo(HaveOccurred())
+
+		testLogger = lagertest.NewTestLogger("mtls")
+		serverCA = newCertAuthority("server-ca")
+		clientCA = newCertAuthority("client-ca")
+		allowedClients = nil
+
+		files = mtls.Files{
+			CertFile:     filepath.Join(tmpDir, "server.crt"),
+			KeyFile:      filepath.Join(tmpDir, "server.key"),
+			ClientCAFile: filepath.Join(tmpDir, "client-ca.crt"),
+		}
+		writeServerCert("local-node-plugin", time.Now().Add(-time.Minute))
+		writeFile(files.ClientCAFile, clientCA.pem, time.Now().Add(-time.Minute))
+	})
+
+	JustBeforeEach(func() {
+		config, err = mtls.NewServerConfig(testLogger, files, allowedClients)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("accepts clients with a certificate from the client CA", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		serverCert, err := handshake(clientCA.issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serverCert.Subject.CommonName).To(Equal("local-node-plugin"))
+	})
+
+	It("rejects clients without a certificate", func() {
+		_, err := handshake(nil, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects clients with a certificate from another CA", func() {
+		_, err := handshake(newCertAuthority("other-ca").issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects certificates that are not for clients", func() {
+		_, err := handshake(clientCA.issue(x509.ExtKeyUsageServerAuth, "volume-manager"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when only some clients are allowed", func() {
+		BeforeEach(func() {
+			allowedClients = []string{"volume-manager", "rep.service.cf.internal"}
+		})
+
+		It("accepts them by common name", func() {
+			_, err := handshake(clientCA.issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("accepts them by subject alternative name", func() {
+			_, err := handshake(clientCA.issue(x509.ExtKeyUsageClientAuth, "cell-1", "rep.service.cf.internal"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects other clients of the client CA", func() {
+			_, err := handshake(clientCA.issue(x509.ExtKeyUsageClientAuth, "someone-else"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("client someone-else is not allowed"))
+		})
+	})
+
+	Context("when the files are replaced", func() {
+		var newClientCA *certAuthority
+
+		JustBeforeEach(func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			newClientCA = newCertAuthority("new-client-ca")
+			writeServerCert("rotated-local-node-plugin", time.Now())
+			writeFile(files.ClientCAFile, newClientCA.pem, time.Now())
+		})
+
+		It("uses them from the next connection", func() {
+			serverCert, err := handshake(newClientCA.issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serverCert.Subject.CommonName).To(Equal("rotated-local-node-plugin"))
+
+			_, err = handshake(clientCA.issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when a client resumes a session", func() {
+		var resumingConfig *tls.Config
+
+		JustBeforeEach(func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			resumingConfig = clientConfig(clientCA.issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+			resumingConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+			state, err := connect(resumingConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.DidResume).To(BeFalse())
+		})
+
+		It("lets it resume while its CA is trusted", func() {
+			state, err := connect(resumingConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.DidResume).To(BeTrue())
+		})
+
+		It("checks it again against a rotated client CA", func() {
+			writeFile(files.ClientCAFile, newCertAuthority("new-client-ca").pem, time.Now())
+
+			_, err := connect(resumingConfig)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when a replacement cannot be used", func() {
+		JustBeforeEach(func() {
+			Expect(err).NotTo(HaveOccurred())
+			writeFile(files.KeyFile, []byte("not a key"), time.Now())
+		})
+
+		It("keeps using the files it already has", func() {
+			serverCert, err := handshake(clientCA.issue(x509.ExtKeyUsageClientAuth, "volume-manager"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(serverCert.Subject.CommonName).To(Equal("local-node-plugin"))
+		})
+	})
+
+	Context("when the files cannot be loaded at startup", func() {
+		BeforeEach(func() {
+			writeFile(files.ClientCAFile, []byte("not a certificate"), time.Now())
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no certificates found"))
+		})
+	})
+})
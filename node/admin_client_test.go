@@ -0,0 +1,70 @@
+package node_test
+
+import (
+	"net"
+
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type recordingAdminServer struct {
+	requests []*csi.DeleteVolumeRequest
+	err      error
+}
+
+func (s *recordingAdminServer) DeleteVolume(ctx context.Context, in *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	s.requests = append(s.requests, in)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+var _ = Describe("AdminClient", func() {
+	var (
+		admin  *recordingAdminServer
+		client node.AdminClient
+		conn   *grpc.ClientConn
+		server *grpc.Server
+	)
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		admin = &recordingAdminServer{}
+		server = grpc.NewServer()
+		node.RegisterAdminServer(server, admin)
+		go server.Serve(listener)
+
+		conn, err = grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+		Expect(err).NotTo(HaveOccurred())
+		client = node.NewAdminClient(conn)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	It("sends DeleteVolume to the admin service", func() {
+		_, err := client.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "test-volume-id"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(admin.requests).To(HaveLen(1))
+		Expect(admin.requests[0].GetVolumeId()).To(Equal("test-volume-id"))
+	})
+
+	It("returns the status the service fails with", func() {
+		admin.err = grpc.Errorf(codes.FailedPrecondition, "Volume is still staged")
+
+		_, err := client.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: "test-volume-id"})
+		Expect(err).To(matchers.HaveGrpcStatus(codes.FailedPrecondition, "Volume is still staged"))
+	})
+})
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The admin service carries operations that CSI leaves to a controller
+// plugin but that only the node can carry out for local volumes. It reuses
+// the CSI request and response messages, so it is registered by hand rather
+// than generated from a proto file. On the wire it is the service
+//
+//	package localnodeplugin;
+//
+//	import "csi.proto";
+//
+//	service Admin {
+//	  rpc DeleteVolume(csi.v1.DeleteVolumeRequest)
+//	    returns (csi.v1.DeleteVolumeResponse) {}
+//	}
+//
+// so its one method is called as /localnodeplugin.Admin/DeleteVolume with the
+// same protobuf messages as the CSI controller's DeleteVolume, and fails with
+// the same status codes. Go clients can use NewAdminClient.
+
+const AdminServiceName = "localnodeplugin.Admin"
+
+type AdminServer interface {
+	DeleteVolume(context.Context, *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&adminServiceDesc, srv)
+}
+
+func adminDeleteVolumeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(csi.DeleteVolumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteVolume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + AdminServiceName + "/DeleteVolume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteVolume(ctx, req.(*csi.DeleteVolumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: AdminServiceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DeleteVolume",
+			Handler:    adminDeleteVolumeHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
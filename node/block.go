@@ -0,0 +1,158 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const blockTargetMode = 0660
+
+// stageBlock attaches the volume's image to a loop device, creating the image
+// the first time the volume is staged. Block images are left unformatted.
+func (ns *LocalNode) stageBlock(logger lager.Logger, volumeId string, volumeContext map[string]string) error {
+	logger = logger.Session("stage-block")
+
+	capacity, ok := volumeContext[CapacityAttribute]
+	if !ok {
+		errorDescription := "Capacity volume attribute is required for block volumes"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	bytes, err := parseCapacity(logger, capacity)
+	if err != nil {
+		return err
+	}
+
+	imagePath := ns.blockImagePath(volumeId)
+	device, err := ns.osHelper.FindLoopDevice(imagePath)
+	if err != nil {
+		logger.Error("find-loop-device-failed", err)
+		errorDescription := "Error staging volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if device != "" {
+		logger.Info("volume-already-staged", lager.Data{"volume id": volumeId, "device": device})
+		return nil
+	}
+
+	err = ns.attachBlockImage(logger, imagePath, bytes)
+	if err != nil {
+		logger.Error("attach-block-image-failed", err)
+		errorDescription := "Error staging volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return nil
+}
+
+func (ns *LocalNode) attachBlockImage(logger lager.Logger, imagePath string, sizeBytes int64) error {
+	exists, err := ns.exists(imagePath)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err = ns.os.MkdirAll(filepath.Dir(imagePath), imagesDirMode)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("create-image", lager.Data{"imagePath": imagePath, "size": sizeBytes})
+		err = ns.osHelper.CreateImage(imagePath, sizeBytes, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	device, err := ns.osHelper.AttachLoopDevice(imagePath)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("attached-loop-device", lager.Data{"imagePath": imagePath, "device": device})
+	return nil
+}
+
+// unstageBlock detaches the loop device backing a block volume, if any.
+func (ns *LocalNode) unstageBlock(logger lager.Logger, volumeId string) error {
+	imagePath := ns.blockImagePath(volumeId)
+	exists, err := ns.exists(imagePath)
+	if err != nil {
+		logger.Error("block-image-exists-failed", err)
+		errorDescription := "Error checking if block image exists"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !exists {
+		return nil
+	}
+
+	device, err := ns.osHelper.FindLoopDevice(imagePath)
+	if err != nil {
+		logger.Error("find-loop-device-failed", err)
+		errorDescription := "Error detaching loop device"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if device == "" {
+		return nil
+	}
+
+	logger.Info("detach-loop-device", lager.Data{"volume id": volumeId, "device": device})
+	err = ns.osHelper.DetachLoopDevice(device)
+	if err != nil {
+		logger.Error("detach-loop-device-failed", err)
+		errorDescription := "Error detaching loop device"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return nil
+}
+
+// blockDevice returns the loop device a staged block volume is attached to.
+func (ns *LocalNode) blockDevice(logger lager.Logger, volumeId string) (string, error) {
+	device, err := ns.osHelper.FindLoopDevice(ns.blockImagePath(volumeId))
+	if err != nil {
+		logger.Error("find-loop-device-failed", err)
+		errorDescription := "Error checking if volume is staged"
+		return "", grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if device == "" {
+		logger.Info("volume-not-staged", lager.Data{"volume id": volumeId})
+		errorDescription := "Volume is not staged"
+		return "", grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	}
+
+	return device, nil
+}
+
+// mountBlock binds the loop device onto a regular file at the target path.
+// Block volumes are only ever published read-write, as Linux does not apply a
+// read-only bind mount to the device behind it.
+func (ns *LocalNode) mountBlock(logger lager.Logger, device, targetPath string) error {
+	err := ns.createVolumesRootifNotExist(logger, filepath.Dir(targetPath))
+	if err != nil {
+		logger.Error("create-target-dir-failed", err)
+		return err
+	}
+
+	file, err := ns.os.OpenFile(targetPath, os.O_CREATE|os.O_RDWR, blockTargetMode)
+	if err != nil {
+		logger.Error("create-target-file-failed", err)
+		return err
+	}
+	file.Close()
+
+	logger.Info("mount-block", lager.Data{"device": device, "tgt": targetPath})
+	return ns.osHelper.Mount(device, targetPath, nil)
+}
+
+func (ns *LocalNode) blockImagePath(volumeId string) string {
+	return filepath.Join(ns.volumesRootDir, imagesDir, volumeId+".block")
+}
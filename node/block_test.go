@@ -0,0 +1,298 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Block Volumes", func() {
+	var (
+		context          context.Context
+		fakeFilepath     *filepath_fake.FakeFilepath
+		fakeJournal      *nodefakes.FakePublishJournal
+		fakeOs           *os_fake.FakeOs
+		fakeOsHelper     *nodefakes.FakeOsHelper
+		imagePath        string
+		localNode        *node.LocalNode
+		volumeCapability *csi.VolumeCapability
+		stagingPath      string
+		targetPath       string
+		volumeId         string
+		volumesRoot      string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		volumeId = "test-volume-id"
+		stagingPath = "/path/to/staging/test-volume-id"
+		targetPath = "/path/to/target/test-volume-id"
+		imagePath = filepath.Join(volumesRoot, ".images", volumeId+".block")
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.StatReturns(nil, os.ErrNotExist)
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeJournal = &nodefakes.FakePublishJournal{}
+
+		volumeCapability = &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		}
+	})
+
+	JustBeforeEach(func() {
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("block"), volumesRoot, "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, Journal: fakeJournal})
+	})
+
+	Describe("NodeStageVolume", func() {
+		var request *csi.NodeStageVolumeRequest
+
+		BeforeEach(func() {
+			request = &csi.NodeStageVolumeRequest{
+				VolumeId:          volumeId,
+				StagingTargetPath: stagingPath,
+				VolumeCapability:  volumeCapability,
+				VolumeContext:     map[string]string{node.CapacityAttribute: "1073741824"},
+			}
+		})
+
+		It("creates an unformatted image and attaches it to a loop device", func() {
+			_, err := localNode.NodeStageVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOs.MkdirAllCallCount()).To(Equal(1))
+			path, _ := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(filepath.Dir(imagePath)))
+
+			Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(1))
+			path, size, fsType := fakeOsHelper.CreateImageArgsForCall(0)
+			Expect(path).To(Equal(imagePath))
+			Expect(size).To(Equal(int64(1073741824)))
+			Expect(fsType).To(BeEmpty())
+
+			Expect(fakeOsHelper.AttachLoopDeviceCallCount()).To(Equal(1))
+			Expect(fakeOsHelper.AttachLoopDeviceArgsForCall(0)).To(Equal(imagePath))
+			Expect(fakeOsHelper.MountImageCallCount()).To(Equal(0))
+		})
+
+		It("records the stage in the journal", func() {
+			_, err := localNode.NodeStageVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeJournal.RecordStageCallCount()).To(Equal(1))
+			Expect(fakeJournal.RecordStageArgsForCall(0)).To(Equal(node.StageRecord{VolumeId: volumeId, StagingPath: stagingPath}))
+		})
+
+		Context("when the image is already attached", func() {
+			BeforeEach(func() {
+				fakeOsHelper.FindLoopDeviceReturns("/dev/loop3", nil)
+			})
+
+			It("does not attach it again", func() {
+				_, err := localNode.NodeStageVolume(context, request)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.AttachLoopDeviceCallCount()).To(Equal(0))
+				Expect(fakeJournal.RecordStageCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the access mode is read-only", func() {
+			BeforeEach(func() {
+				request.VolumeCapability.AccessMode.Mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+			})
+
+			It("returns an error without attaching the image", func() {
+				_, err := localNode.NodeStageVolume(context, request)
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Read-only access is not supported for block volumes"))
+				Expect(fakeOsHelper.AttachLoopDeviceCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when no capacity is given", func() {
+			BeforeEach(func() {
+				request.VolumeContext = nil
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeStageVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+				Expect(grpcStatus.Message()).To(Equal("Capacity volume attribute is required for block volumes"))
+			})
+		})
+
+		Context("when attaching the loop device fails", func() {
+			BeforeEach(func() {
+				fakeOsHelper.AttachLoopDeviceReturns("", errors.New("losetup failed"))
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeStageVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+				Expect(grpcStatus.Message()).To(Equal("Error staging volume"))
+			})
+		})
+	})
+
+	Describe("NodePublishVolume", func() {
+		var (
+			request  *csi.NodePublishVolumeRequest
+			tempFile *os.File
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempFile, err = os.Create(filepath.Join(os.TempDir(), "block-target"))
+			Expect(err).NotTo(HaveOccurred())
+			fakeOs.OpenFileReturns(tempFile, nil)
+
+			fakeOsHelper.FindLoopDeviceReturns("/dev/loop3", nil)
+			request = &csi.NodePublishVolumeRequest{
+				VolumeId:          volumeId,
+				StagingTargetPath: stagingPath,
+				TargetPath:        targetPath,
+				VolumeCapability:  volumeCapability,
+			}
+		})
+
+		AfterEach(func() {
+			os.Remove(tempFile.Name())
+		})
+
+		It("binds the loop device onto a file at the target path", func() {
+			_, err := localNode.NodePublishVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOsHelper.FindLoopDeviceArgsForCall(0)).To(Equal(imagePath))
+
+			path, _ := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(filepath.Dir(targetPath)))
+
+			Expect(fakeOs.OpenFileCallCount()).To(Equal(1))
+			path, flag, _ := fakeOs.OpenFileArgsForCall(0)
+			Expect(path).To(Equal(targetPath))
+			Expect(flag & os.O_CREATE).NotTo(BeZero())
+
+			Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+			src, tgt, options := fakeOsHelper.MountArgsForCall(0)
+			Expect(src).To(Equal("/dev/loop3"))
+			Expect(tgt).To(Equal(targetPath))
+			Expect(options).To(BeEmpty())
+		})
+
+		Context("when the volume is published read-only", func() {
+			BeforeEach(func() {
+				request.Readonly = true
+			})
+
+			It("refuses, as the loop device behind a read-only bind is still writable", func() {
+				_, err := localNode.NodePublishVolume(context, request)
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Read-only access is not supported for block volumes"))
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume is published with a read-only access mode", func() {
+			BeforeEach(func() {
+				request.VolumeCapability.AccessMode.Mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+			})
+
+			It("refuses", func() {
+				_, err := localNode.NodePublishVolume(context, request)
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Read-only access is not supported for block volumes"))
+				Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume is not attached to a loop device", func() {
+			BeforeEach(func() {
+				fakeOsHelper.FindLoopDeviceReturns("", nil)
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodePublishVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+				Expect(grpcStatus.Message()).To(Equal("Volume is not staged"))
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("NodeUnstageVolume", func() {
+		var request *csi.NodeUnstageVolumeRequest
+
+		BeforeEach(func() {
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if path == imagePath {
+					return nil, nil
+				}
+				return nil, os.ErrNotExist
+			}
+			fakeOsHelper.FindLoopDeviceReturns("/dev/loop3", nil)
+			request = &csi.NodeUnstageVolumeRequest{
+				VolumeId:          volumeId,
+				StagingTargetPath: stagingPath,
+			}
+		})
+
+		It("detaches the loop device", func() {
+			_, err := localNode.NodeUnstageVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.DetachLoopDeviceCallCount()).To(Equal(1))
+			Expect(fakeOsHelper.DetachLoopDeviceArgsForCall(0)).To(Equal("/dev/loop3"))
+		})
+
+		Context("when detaching fails", func() {
+			BeforeEach(func() {
+				fakeOsHelper.DetachLoopDeviceReturns(errors.New("device busy"))
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeUnstageVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+				Expect(grpcStatus.Message()).To(Equal("Error detaching loop device"))
+			})
+		})
+
+		Context("when the volume has no block image", func() {
+			BeforeEach(func() {
+				fakeOs.StatStub = nil
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("does not look for a loop device", func() {
+				_, err := localNode.NodeUnstageVolume(context, request)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.FindLoopDeviceCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.DetachLoopDeviceCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
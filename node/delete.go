@@ -0,0 +1,194 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// DeleteVolume removes the volume directory and any images backing it. Only
+// volumes that are neither staged nor published can be deleted, and nothing
+// is removed through a symlink or from beneath a mount point. Deleting a
+// volume that does not exist succeeds.
+func (ln *LocalNode) DeleteVolume(ctx context.Context, in *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	logger := ln.logger.Session("delete-volume")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetVolumeId()
+	if volId == "" {
+		errorDescription := "Volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if err := validateVolumeId(logger, volId); err != nil {
+		return nil, err
+	}
+
+	unlock, err := ln.lockVolume(logger, volId, "")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = ln.checkVolumeUnused(logger, volId)
+	if err != nil {
+		return nil, err
+	}
+
+	volumePath := filepath.Join(ln.volumesRootDir, volId)
+	exists, err := ln.exists(volumePath)
+	if err != nil {
+		logger.Error("stat-volume-path-failed", err)
+		errorDescription := "Error checking if volume path exists"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if exists {
+		err = ln.deleteVolumePath(logger, volumePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, imagePath := range []string{ln.imagePath(volId), ln.blockImagePath(volId)} {
+		err = ln.os.Remove(imagePath)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("remove-image-failed", err, lager.Data{"image path": imagePath})
+			errorDescription := "Error deleting volume image"
+			return nil, grpc.Errorf(codes.Internal, errorDescription)
+		}
+	}
+
+	// a volume created later with the same ID must not be reported with this
+	// one's usage or checked against its spec
+	ln.usage.Invalidate(volumePath)
+
+	err = ln.specs.Remove(volId)
+	if err != nil {
+		logger.Error("remove-volume-spec-failed", err)
+		errorDescription := "Error deleting volume spec"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	logger.Info("volume-deleted", lager.Data{"volume id": volId, "volume path": volumePath})
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// checkVolumeUnused refuses to delete a volume that is published, or that is
+// staged and so may be published again without warning.
+func (ns *LocalNode) checkVolumeUnused(logger lager.Logger, volumeId string) error {
+	if count := ns.publishCount(volumeId); count > 0 {
+		logger.Info("volume-still-published", lager.Data{"volume id": volumeId, "publishes": count})
+		errorDescription := "Volume is still published"
+		return grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	}
+
+	stages, err := ns.journal.Stages()
+	if err != nil {
+		logger.Error("read-publish-journal-failed", err)
+		errorDescription := "Error checking if volume is staged"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	staged := false
+	for _, stage := range stages {
+		staged = staged || stage.VolumeId == volumeId
+	}
+
+	if staged {
+		logger.Info("volume-still-staged", lager.Data{"volume id": volumeId})
+		errorDescription := "Volume is still staged"
+		return grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	}
+
+	// only block volumes have an image that may be left attached
+	imagePath := ns.blockImagePath(volumeId)
+	imageExists, err := ns.exists(imagePath)
+	if err != nil {
+		logger.Error("stat-block-image-failed", err, lager.Data{"image path": imagePath})
+		errorDescription := "Error checking if volume is staged"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if imageExists {
+		device, err := ns.osHelper.FindLoopDevice(imagePath)
+		if err != nil {
+			logger.Error("find-loop-device-failed", err)
+			errorDescription := "Error checking if volume is staged"
+			return grpc.Errorf(codes.Internal, errorDescription)
+		}
+		if device != "" {
+			logger.Info("volume-block-image-attached", lager.Data{"volume id": volumeId, "device": device})
+			errorDescription := "Volume is still staged"
+			return grpc.Errorf(codes.FailedPrecondition, errorDescription)
+		}
+	}
+
+	return nil
+}
+
+// deleteVolumePath unmounts the image a capacity-limited volume directory may
+// be backed by and removes the directory. A volume directory with anything
+// else mounted beneath it is left alone, as removing it would reach into the
+// mounted filesystem.
+func (ns *LocalNode) deleteVolumePath(logger lager.Logger, volumePath string) error {
+	err := ns.confine(logger, volumePath)
+	if err != nil {
+		return err
+	}
+
+	mounts, err := ns.osHelper.ListMounts()
+	if err != nil {
+		logger.Error("list-mounts-failed", err)
+		errorDescription := "Error checking for mounts in volume directory"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	resolved, err := ns.filepath.EvalSymlinks(volumePath)
+	if err != nil {
+		logger.Error("eval-volume-path-symlinks-failed", err)
+		errorDescription := "Error resolving volume path"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	imageMounted := false
+	for _, mount := range mounts {
+		if mount.MountPoint == resolved {
+			imageMounted = true
+			continue
+		}
+
+		if strings.HasPrefix(mount.MountPoint, resolved+string(filepath.Separator)) {
+			logger.Info("volume-directory-has-mounts", lager.Data{"volume path": volumePath, "mount point": mount.MountPoint})
+			errorDescription := "Volume directory has mounts beneath it"
+			return grpc.Errorf(codes.FailedPrecondition, errorDescription)
+		}
+	}
+
+	if imageMounted {
+		logger.Info("unmount-volume-image", lager.Data{"volume path": volumePath})
+		err = ns.osHelper.Unmount(volumePath)
+		if err != nil {
+			logger.Error("unmount-volume-image-failed", err)
+			errorDescription := "Error unmounting volume image"
+			return grpc.Errorf(codes.Internal, errorDescription)
+		}
+	}
+
+	logger.Info("remove-volume-directory", lager.Data{"volume path": volumePath})
+	err = ns.os.RemoveAll(volumePath)
+	if err != nil {
+		logger.Error("remove-volume-directory-failed", err)
+		errorDescription := "Error deleting volume directory"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+var _ = Describe("DeleteVolume", func() {
+	var (
+		context      context.Context
+		err          error
+		fakeFilepath *filepath_fake.FakeFilepath
+		fakeJournal  *nodefakes.FakePublishJournal
+		fakeOs       *os_fake.FakeOs
+		fakeOsHelper *nodefakes.FakeOsHelper
+		fakeSpecs    *nodefakes.FakeVolumeSpecs
+		fakeUsage    *nodefakes.FakeUsageAccountant
+		localNode    *node.LocalNode
+		options      node.Options
+		request      *csi.DeleteVolumeRequest
+		volumeId     string
+		volumePath   string
+		volumesRoot  string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		volumeId = "test-volume-id"
+		volumePath = filepath.Join(volumesRoot, volumeId)
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.RemoveReturns(os.ErrNotExist)
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeJournal = &nodefakes.FakePublishJournal{}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeSpecs = &nodefakes.FakeVolumeSpecs{}
+		fakeUsage = &nodefakes.FakeUsageAccountant{}
+		fakeOsHelper.ListMountsReturns([]node.MountInfo{
+			{Device: "8:1", Root: "/", MountPoint: "/"},
+		}, nil)
+
+		options = node.Options{Usage: fakeUsage, Journal: fakeJournal, Specs: fakeSpecs}
+		request = &csi.DeleteVolumeRequest{VolumeId: volumeId}
+	})
+
+	JustBeforeEach(func() {
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("delete"), volumesRoot, "some-node-id", options)
+		_, err = localNode.DeleteVolume(context, request)
+	})
+
+	It("removes the volume directory and its images", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeOs.RemoveAllCallCount()).To(Equal(1))
+		Expect(fakeOs.RemoveAllArgsForCall(0)).To(Equal(volumePath))
+
+		Expect(fakeOs.RemoveCallCount()).To(Equal(2))
+		Expect(fakeOs.RemoveArgsForCall(0)).To(Equal(filepath.Join(volumesRoot, ".images", volumeId+".img")))
+		Expect(fakeOs.RemoveArgsForCall(1)).To(Equal(filepath.Join(volumesRoot, ".images", volumeId+".block")))
+	})
+
+	It("forgets the usage cached for the volume", func() {
+		Expect(fakeUsage.InvalidateCallCount()).To(Equal(1))
+		Expect(fakeUsage.InvalidateArgsForCall(0)).To(Equal(volumePath))
+	})
+
+	It("forgets the spec the volume was created with", func() {
+		Expect(fakeSpecs.RemoveCallCount()).To(Equal(1))
+		Expect(fakeSpecs.RemoveArgsForCall(0)).To(Equal(volumeId))
+	})
+
+	Context("when the spec cannot be removed", func() {
+		BeforeEach(func() {
+			fakeSpecs.RemoveReturns(errors.New("permission denied"))
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error deleting volume spec"))
+		})
+	})
+
+	Context("when no usage accountant or journal is configured", func() {
+		BeforeEach(func() {
+			options = node.Options{}
+		})
+
+		It("removes the volume directory and its images", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(1))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(2))
+		})
+	})
+
+	Context("when the volume directory does not exist", func() {
+		BeforeEach(func() {
+			fakeOs.StatReturns(nil, os.ErrNotExist)
+		})
+
+		It("succeeds without removing anything", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume ID is missing", func() {
+		BeforeEach(func() {
+			request.VolumeId = ""
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume ID is missing in request"))
+		})
+	})
+
+	Context("when the volume is staged", func() {
+		BeforeEach(func() {
+			fakeJournal.StagesReturns([]node.StageRecord{{VolumeId: volumeId, StagingPath: "/path/to/staging/test-volume-id"}}, nil)
+		})
+
+		It("refuses to delete it", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.FailedPrecondition, "Volume is still staged"))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume's block image is attached", func() {
+		BeforeEach(func() {
+			fakeOsHelper.FindLoopDeviceReturns("/dev/loop3", nil)
+		})
+
+		It("refuses to delete it", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.FailedPrecondition, "Volume is still staged"))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume is a plain directory without a block image", func() {
+		BeforeEach(func() {
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if path == filepath.Join(volumesRoot, ".images", volumeId+".block") {
+					return nil, os.ErrNotExist
+				}
+				return nil, nil
+			}
+			fakeOsHelper.FindLoopDeviceReturns("", os.ErrNotExist)
+		})
+
+		It("deletes it without looking for a loop device", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.FindLoopDeviceCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when the journal cannot be read", func() {
+		BeforeEach(func() {
+			fakeJournal.StagesReturns(nil, errors.New("corrupt journal"))
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error checking if volume is staged"))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume directory is backed by a mounted image", func() {
+		BeforeEach(func() {
+			fakeOsHelper.ListMountsReturns([]node.MountInfo{
+				{Device: "8:1", Root: "/", MountPoint: "/"},
+				{Device: "7:3", Root: "/", MountPoint: volumePath},
+			}, nil)
+		})
+
+		It("unmounts the image before removing the directory", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(1))
+			Expect(fakeOsHelper.UnmountArgsForCall(0)).To(Equal(volumePath))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when something is mounted beneath the volume directory", func() {
+		BeforeEach(func() {
+			fakeOsHelper.ListMountsReturns([]node.MountInfo{
+				{Device: "8:1", Root: "/", MountPoint: "/"},
+				{Device: "8:2", Root: "/", MountPoint: filepath.Join(volumePath, "data")},
+			}, nil)
+		})
+
+		It("refuses to delete it", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.FailedPrecondition, "Volume directory has mounts beneath it"))
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume directory is a symlink out of the volumes root", func() {
+		BeforeEach(func() {
+			fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+				if path == volumePath {
+					return "/etc", nil
+				}
+				return path, nil
+			}
+		})
+
+		It("refuses to delete it", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume path is outside the volumes root directory"))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume directory cannot be removed", func() {
+		BeforeEach(func() {
+			fakeOs.RemoveAllReturns(errors.New("permission denied"))
+		})
+
+		It("returns an error", func() {
+			Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error deleting volume directory"))
+		})
+	})
+})
@@ -0,0 +1,217 @@
+package node
+
+import (
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func (ln *LocalNode) NodeExpandVolume(ctx context.Context, in *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
+	logger := ln.logger.Session("node-expand-volume")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetVolumeId()
+	if volId == "" {
+		errorDescription := "Volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if err := validateVolumeId(logger, volId); err != nil {
+		return nil, err
+	}
+
+	volumePath := in.GetVolumePath()
+	if volumePath == "" {
+		errorDescription := "Volume path is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	requiredBytes := in.GetCapacityRange().GetRequiredBytes()
+	if requiredBytes <= 0 {
+		errorDescription := "Required capacity is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	limitBytes := in.GetCapacityRange().GetLimitBytes()
+	if limitBytes > 0 && requiredBytes > limitBytes {
+		logger.Info("invalid-capacity-range", lager.Data{"required": requiredBytes, "limit": limitBytes})
+		errorDescription := "Required capacity exceeds the capacity limit"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if err := ln.validateTargetPath(logger, volumePath); err != nil {
+		return nil, err
+	}
+
+	stagingPath := in.GetStagingTargetPath()
+	if stagingPath != "" {
+		if err := ln.validateTargetPath(logger, stagingPath); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock, err := ln.lockVolume(logger, volId, "")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	exists, err := ln.exists(volumePath)
+	if err != nil {
+		logger.Error("stat-volume-path-failed", err)
+		errorDescription := "Error checking if volume path exists"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !exists {
+		logger.Info("volume-path-not-found", lager.Data{"volume id": volId, "path": volumePath})
+		errorDescription := "Volume path not found"
+		return nil, grpc.Errorf(codes.NotFound, errorDescription)
+	}
+
+	capacity, err := ln.expand(logger, volId, volumePath, stagingPath, requiredBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("volume-expanded", lager.Data{"volume id": volId, "capacity": capacity})
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: capacity}, nil
+}
+
+// expand grows whichever of a block image, a filesystem image or a project
+// quota is limiting the volume. Volumes are never shrunk, so asking for less
+// than the current capacity just reports the current capacity.
+func (ns *LocalNode) expand(logger lager.Logger, volumeId, volumePath, stagingPath string, requiredBytes int64) (int64, error) {
+	blockImagePath := ns.blockImagePath(volumeId)
+	block, err := ns.exists(blockImagePath)
+	if err != nil {
+		logger.Error("block-image-exists-failed", err)
+		errorDescription := "Error checking if block image exists"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if block {
+		return ns.expandImage(logger, blockImagePath, "", requiredBytes)
+	}
+
+	imagePath := ns.imagePath(volumeId)
+	loopback, err := ns.exists(imagePath)
+	if err != nil {
+		logger.Error("image-exists-failed", err)
+		errorDescription := "Error checking if loopback image exists"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if loopback {
+		mountPath := stagingPath
+		if mountPath == "" {
+			mountPath = volumePath
+		}
+		return ns.expandImage(logger, imagePath, mountPath, requiredBytes)
+	}
+
+	return ns.expandQuota(logger, volumeId, requiredBytes)
+}
+
+// expandImage grows the image file and, when mountPath is given, the
+// filesystem mounted from it. The image must be attached to a loop device so
+// the filesystem can be grown online.
+func (ns *LocalNode) expandImage(logger lager.Logger, imagePath, mountPath string, requiredBytes int64) (int64, error) {
+	logger = logger.Session("expand-image", lager.Data{"imagePath": imagePath})
+
+	info, err := ns.os.Stat(imagePath)
+	if err != nil {
+		logger.Error("stat-image-failed", err)
+		errorDescription := "Error expanding volume"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if info.Size() >= requiredBytes {
+		logger.Info("image-already-large-enough", lager.Data{"size": info.Size(), "required": requiredBytes})
+		return info.Size(), nil
+	}
+
+	device, err := ns.osHelper.FindLoopDevice(imagePath)
+	if err != nil {
+		logger.Error("find-loop-device-failed", err)
+		errorDescription := "Error expanding volume"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if device == "" {
+		logger.Info("volume-not-staged")
+		errorDescription := "Volume is not staged"
+		return 0, grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	}
+
+	logger.Info("resize-image", lager.Data{"size": requiredBytes})
+	err = ns.osHelper.ResizeImage(imagePath, requiredBytes)
+	if err != nil {
+		logger.Error("resize-image-failed", err)
+		errorDescription := "Error expanding volume"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if mountPath != "" {
+		logger.Info("grow-filesystem", lager.Data{"device": device, "mountPath": mountPath})
+		err = ns.osHelper.GrowFilesystem(device, mountPath)
+		if err != nil {
+			logger.Error("grow-filesystem-failed", err)
+			errorDescription := "Error growing volume filesystem"
+			return 0, grpc.Errorf(codes.Internal, errorDescription)
+		}
+	}
+
+	return requiredBytes, nil
+}
+
+// expandQuota raises the project quota on the volume directory.
+func (ns *LocalNode) expandQuota(logger lager.Logger, volumeId string, requiredBytes int64) (int64, error) {
+	logger = logger.Session("expand-quota")
+	volumePath := filepath.Join(ns.volumesRootDir, volumeId)
+
+	var projectId uint32
+	if ns.quotasEnabled {
+		var err error
+		projectId, err = ns.osHelper.GetProjectId(volumePath)
+		if err != nil {
+			// not every filesystem supports project IDs, which leaves nothing to expand
+			logger.Error("get-project-id-failed", err)
+			projectId = 0
+		}
+	}
+
+	if projectId == 0 {
+		logger.Info("volume-has-no-capacity", lager.Data{"volume id": volumeId})
+		errorDescription := "Volume does not have a capacity that can be expanded"
+		return 0, grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	}
+
+	quota, err := ns.osHelper.GetProjectQuota(volumePath, projectId)
+	if err != nil {
+		logger.Error("get-project-quota-failed", err)
+		errorDescription := "Error expanding volume"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if quota.LimitBytes >= requiredBytes {
+		logger.Info("quota-already-large-enough", lager.Data{"limit": quota.LimitBytes, "required": requiredBytes})
+		return quota.LimitBytes, nil
+	}
+
+	limits := QuotaLimits{Bytes: requiredBytes, Inodes: requiredBytes / bytesPerInode}
+	logger.Info("set-project-quota", lager.Data{"projectId": projectId, "limits": limits})
+	err = ns.osHelper.SetProjectQuota(volumePath, projectId, limits)
+	if err != nil {
+		logger.Error("set-project-quota-failed", err)
+		errorDescription := "Error expanding volume"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return requiredBytes, nil
+}
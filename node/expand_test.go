@@ -0,0 +1,261 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("NodeExpandVolume", func() {
+	var (
+		context       context.Context
+		fakeFilepath  *filepath_fake.FakeFilepath
+		fakeOs        *os_fake.FakeOs
+		fakeOsHelper  *nodefakes.FakeOsHelper
+		localNode     *node.LocalNode
+		quotasEnabled bool
+		request       *csi.NodeExpandVolumeRequest
+		volumeId      string
+		volumePath    string
+		volumesRoot   string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		volumeId = "test-volume-id"
+		volumePath = filepath.Join(volumesRoot, volumeId)
+		quotasEnabled = true
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+
+		request = &csi.NodeExpandVolumeRequest{
+			VolumeId:          volumeId,
+			VolumePath:        "/path/to/target/test-volume-id",
+			StagingTargetPath: "/path/to/staging/test-volume-id",
+			CapacityRange:     &csi.CapacityRange{RequiredBytes: 2147483648},
+		}
+	})
+
+	JustBeforeEach(func() {
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("expand"), volumesRoot, "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, QuotasEnabled: quotasEnabled, Journal: &nodefakes.FakePublishJournal{}})
+	})
+
+	// only the request's paths and an image with the given extension exist
+	imageOfSize := func(ext string, size int64) {
+		fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+			if path == request.VolumePath || path == request.StagingTargetPath {
+				return &sizedFileInfo{}, nil
+			}
+			if ext != "" && filepath.Ext(path) == ext {
+				return &sizedFileInfo{size: size}, nil
+			}
+			return nil, os.ErrNotExist
+		}
+	}
+
+	BeforeEach(func() {
+		imageOfSize("", 0)
+	})
+
+	Context("when the volume has a project quota", func() {
+		BeforeEach(func() {
+			fakeOsHelper.GetProjectIdReturns(1234, nil)
+			fakeOsHelper.GetProjectQuotaReturns(node.QuotaStats{LimitBytes: 1073741824}, nil)
+		})
+
+		It("raises the quota and returns the new capacity", func() {
+			resp, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetCapacityBytes()).To(Equal(int64(2147483648)))
+
+			Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(1))
+			path, projectId, limits := fakeOsHelper.SetProjectQuotaArgsForCall(0)
+			Expect(path).To(Equal(volumePath))
+			Expect(projectId).To(Equal(uint32(1234)))
+			Expect(limits).To(Equal(node.QuotaLimits{Bytes: 2147483648, Inodes: 131072}))
+		})
+
+		Context("when the quota is already large enough", func() {
+			BeforeEach(func() {
+				fakeOsHelper.GetProjectQuotaReturns(node.QuotaStats{LimitBytes: 4294967296}, nil)
+			})
+
+			It("does not shrink it", func() {
+				resp, err := localNode.NodeExpandVolume(context, request)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.GetCapacityBytes()).To(Equal(int64(4294967296)))
+				Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when setting the quota fails", func() {
+			BeforeEach(func() {
+				fakeOsHelper.SetProjectQuotaReturns(errors.New("quotactl failed"))
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeExpandVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+				Expect(grpcStatus.Message()).To(Equal("Error expanding volume"))
+			})
+		})
+	})
+
+	Context("when the volume is backed by a loopback image", func() {
+		BeforeEach(func() {
+			imageOfSize(".img", 1073741824)
+			fakeOsHelper.FindLoopDeviceReturns("/dev/loop2", nil)
+		})
+
+		It("grows the image and its filesystem", func() {
+			resp, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetCapacityBytes()).To(Equal(int64(2147483648)))
+
+			Expect(fakeOsHelper.ResizeImageCallCount()).To(Equal(1))
+			path, size := fakeOsHelper.ResizeImageArgsForCall(0)
+			Expect(path).To(Equal(filepath.Join(volumesRoot, ".images", volumeId+".img")))
+			Expect(size).To(Equal(int64(2147483648)))
+
+			Expect(fakeOsHelper.GrowFilesystemCallCount()).To(Equal(1))
+			device, mountPath := fakeOsHelper.GrowFilesystemArgsForCall(0)
+			Expect(device).To(Equal("/dev/loop2"))
+			Expect(mountPath).To(Equal("/path/to/staging/test-volume-id"))
+
+			Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(0))
+		})
+
+		Context("when the image is not attached", func() {
+			BeforeEach(func() {
+				fakeOsHelper.FindLoopDeviceReturns("", nil)
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeExpandVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+				Expect(fakeOsHelper.ResizeImageCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when growing the filesystem fails", func() {
+			BeforeEach(func() {
+				fakeOsHelper.GrowFilesystemReturns(errors.New("resize2fs failed"))
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeExpandVolume(context, request)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+				Expect(grpcStatus.Message()).To(Equal("Error growing volume filesystem"))
+			})
+		})
+	})
+
+	Context("when the volume is a block volume", func() {
+		BeforeEach(func() {
+			imageOfSize(".block", 1073741824)
+			fakeOsHelper.FindLoopDeviceReturns("/dev/loop3", nil)
+		})
+
+		It("grows the image without touching a filesystem", func() {
+			resp, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetCapacityBytes()).To(Equal(int64(2147483648)))
+
+			path, _ := fakeOsHelper.ResizeImageArgsForCall(0)
+			Expect(path).To(Equal(filepath.Join(volumesRoot, ".images", volumeId+".block")))
+			Expect(fakeOsHelper.GrowFilesystemCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume has no capacity", func() {
+		BeforeEach(func() {
+			quotasEnabled = false
+		})
+
+		It("returns an error", func() {
+			_, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+			Expect(grpcStatus.Message()).To(Equal("Volume does not have a capacity that can be expanded"))
+		})
+	})
+
+	Context("when the required capacity is missing", func() {
+		BeforeEach(func() {
+			request.CapacityRange = nil
+		})
+
+		It("returns an error", func() {
+			_, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+			Expect(grpcStatus.Message()).To(Equal("Required capacity is missing in request"))
+		})
+	})
+
+	Context("when the required capacity exceeds the limit", func() {
+		BeforeEach(func() {
+			request.CapacityRange.LimitBytes = 1073741824
+		})
+
+		It("returns an error", func() {
+			_, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Context("when the volume path is missing", func() {
+		BeforeEach(func() {
+			request.VolumePath = ""
+		})
+
+		It("returns an error", func() {
+			_, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+			Expect(grpcStatus.Message()).To(Equal("Volume path is missing in request"))
+		})
+	})
+
+	Context("when the volume path does not exist", func() {
+		BeforeEach(func() {
+			fakeOs.StatReturns(nil, os.ErrNotExist)
+		})
+
+		It("returns an error", func() {
+			_, err := localNode.NodeExpandVolume(context, request)
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.NotFound))
+			Expect(grpcStatus.Message()).To(Equal("Volume path not found"))
+			Expect(fakeOsHelper.ResizeImageCallCount()).To(Equal(0))
+			Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(0))
+		})
+	})
+})
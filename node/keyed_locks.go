@@ -0,0 +1,76 @@
+package node
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// keyedLocks tracks which volume IDs or target paths have an operation in
+// flight. Rather than queueing behind one another, callers that find a key
+// taken fail so the CO can retry once the first operation has finished.
+type keyedLocks struct {
+	lock     sync.Mutex
+	inFlight map[string]struct{}
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{inFlight: map[string]struct{}{}}
+}
+
+func (l *keyedLocks) tryAcquire(key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.inFlight[key]; ok {
+		return false
+	}
+	l.inFlight[key] = struct{}{}
+	return true
+}
+
+func (l *keyedLocks) release(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.inFlight, key)
+}
+
+// lockVolume claims the volume ID, and the target path when one is given, for
+// the duration of an RPC. The returned function releases both.
+func (ns *LocalNode) lockVolume(logger lager.Logger, volumeId, targetPath string) (func(), error) {
+	if !ns.volumeLocks.tryAcquire(volumeId) {
+		logger.Info("volume-operation-in-progress", lager.Data{"volume id": volumeId})
+		errorDescription := "An operation is already in progress for volume " + volumeId
+		return nil, grpc.Errorf(codes.Aborted, errorDescription)
+	}
+
+	if targetPath == "" {
+		return func() { ns.volumeLocks.release(volumeId) }, nil
+	}
+
+	if !ns.targetLocks.tryAcquire(targetPath) {
+		ns.volumeLocks.release(volumeId)
+		logger.Info("target-operation-in-progress", lager.Data{"target path": targetPath})
+		errorDescription := "An operation is already in progress for target path " + targetPath
+		return nil, grpc.Errorf(codes.Aborted, errorDescription)
+	}
+
+	return func() {
+		ns.targetLocks.release(targetPath)
+		ns.volumeLocks.release(volumeId)
+	}, nil
+}
+
+// lockSnapshot claims the snapshot ID for the duration of an RPC.
+func (ns *LocalNode) lockSnapshot(logger lager.Logger, snapshotId string) (func(), error) {
+	if !ns.snapshotLocks.tryAcquire(snapshotId) {
+		logger.Info("snapshot-operation-in-progress", lager.Data{"snapshot id": snapshotId})
+		errorDescription := "An operation is already in progress for snapshot " + snapshotId
+		return nil, grpc.Errorf(codes.Aborted, errorDescription)
+	}
+
+	return func() { ns.snapshotLocks.release(snapshotId) }, nil
+}
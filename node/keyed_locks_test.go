@@ -0,0 +1,110 @@
+package node_test
+
+import (
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Concurrent Operations", func() {
+	var (
+		context          context.Context
+		fakeOsHelper     *nodefakes.FakeOsHelper
+		localNode        *node.LocalNode
+		mounting         chan struct{}
+		unblock          chan struct{}
+		volumeCapability *csi.VolumeCapability
+	)
+
+	BeforeEach(func() {
+		context = &DummyContext{}
+		mounting = make(chan struct{})
+		unblock = make(chan struct{})
+
+		fakeFilepath := &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+			return path == "/path/to/staging/test-volume-id", nil
+		}
+		fakeOsHelper.MountStub = func(srcPath, targetPath string, options []string) error {
+			close(mounting)
+			<-unblock
+			return nil
+		}
+
+		localNode = node.NewLocalNode(&os_fake.FakeOs{}, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("concurrency"), "/tmp/_volumes", "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, Journal: &nodefakes.FakePublishJournal{}})
+		volumeCapability = &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
+	})
+
+	publish := func(volumeId, targetPath string) error {
+		_, err := localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+			VolumeId:          volumeId,
+			StagingTargetPath: "/path/to/staging/test-volume-id",
+			TargetPath:        targetPath,
+			VolumeCapability:  volumeCapability,
+		})
+		return err
+	}
+
+	expectAborted := func(err error) {
+		Expect(err).To(HaveOccurred())
+		grpcStatus, _ := status.FromError(err)
+		Expect(grpcStatus.Code()).To(Equal(codes.Aborted))
+	}
+
+	Context("while an operation is in flight for a volume", func() {
+		var firstErr chan error
+
+		BeforeEach(func() {
+			firstErr = make(chan error, 1)
+			go func() {
+				firstErr <- publish("test-volume-id", "/path/to/target/one")
+			}()
+			Eventually(mounting).Should(BeClosed())
+		})
+
+		AfterEach(func() {
+			if unblock != nil {
+				close(unblock)
+				Eventually(firstErr).Should(Receive(BeNil()))
+			}
+		})
+
+		It("aborts other operations on the same volume", func() {
+			expectAborted(publish("test-volume-id", "/path/to/target/two"))
+
+			_, err := localNode.NodeUnpublishVolume(context, &csi.NodeUnpublishVolumeRequest{VolumeId: "test-volume-id", TargetPath: "/path/to/target/one"})
+			expectAborted(err)
+		})
+
+		It("only checks whether the volume is staged once it holds the lock", func() {
+			checks := fakeOsHelper.IsMountedCallCount()
+			expectAborted(publish("test-volume-id", "/path/to/target/two"))
+			Expect(fakeOsHelper.IsMountedCallCount()).To(Equal(checks))
+		})
+
+		It("aborts operations on other volumes for the same target path", func() {
+			expectAborted(publish("other-volume-id", "/path/to/target/one"))
+		})
+
+		It("releases the volume once the operation finishes", func() {
+			close(unblock)
+			Eventually(firstErr).Should(Receive(BeNil()))
+			unblock = nil
+
+			fakeOsHelper.MountStub = nil
+			Expect(publish("test-volume-id", "/path/to/target/two")).To(Succeed())
+		})
+	})
+})
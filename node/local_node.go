@@ -1,9 +1,14 @@
 package node
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"syscall"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/goshims/filepathshim"
 	"code.cloudfoundry.org/goshims/osshim"
 	"code.cloudfoundry.org/lager"
@@ -14,19 +19,91 @@ import (
 )
 
 const (
-	NODE_PLUGIN_ID = "org.cloudfoundry.code.local-node-plugin"
+	NODE_PLUGIN_ID      = "org.cloudfoundry.code.local-node-plugin"
+	NODE_PLUGIN_VERSION = "0.1.0"
+
+	// RepairAttribute set to "true" makes NodePublishVolume replace a mount
+	// of the volume at the target path with a different read-only mode or
+	// mount flags instead of refusing it. Compatible mounts are left alone.
+	RepairAttribute = "repair"
 )
 
+var allowedMountFlags = map[string]bool{
+	"noexec":     true,
+	"nosuid":     true,
+	"nodev":      true,
+	"noatime":    true,
+	"nodiratime": true,
+	"relatime":   true,
+}
+
+var supportedAccessModes = map[csi.VolumeCapability_AccessMode_Mode]bool{
+	csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER:      true,
+	csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY: true,
+}
+
 type LocalVolume struct {
 	csi.Volume
 }
 
 //go:generate counterfeiter -o nodefakes/fake_os_helper.go . OsHelper
 type OsHelper interface {
-	Umask(mask int) (oldmask int)
-	Mount(srcPath string, targetPath string) error
+	Mount(srcPath string, targetPath string, options []string) error
+	MountReadOnly(srcPath string, targetPath string, options []string) error
 	IsMounted(targetPath string) (bool, error)
+	GetMountInfo(targetPath string) (MountInfo, bool, error)
+	ListMounts() ([]MountInfo, error)
+	IsReadOnly(targetPath string) (bool, error)
 	Unmount(targetPath string) error
+	Statfs(path string) (FilesystemStats, error)
+	SupportsProjectQuota(path string) (bool, error)
+	GetProjectId(path string) (uint32, error)
+	SetProjectQuota(path string, projectId uint32, limits QuotaLimits) error
+	GetProjectQuota(path string, projectId uint32) (QuotaStats, error)
+	CreateImage(imagePath string, sizeBytes int64, fsType string) error
+	MountImage(imagePath string, targetPath string) error
+	AttachLoopDevice(imagePath string) (string, error)
+	FindLoopDevice(imagePath string) (string, error)
+	DetachLoopDevice(devicePath string) error
+	ResizeImage(imagePath string, sizeBytes int64) error
+	GrowFilesystem(devicePath string, mountPath string) error
+	CloneFile(srcPath string, dstPath string, options CopyOptions) error
+	CloneTree(srcPath string, dstPath string, options CopyOptions) error
+}
+
+// CopyOptions controls how volumes are copied on filesystems that cannot
+// reflink them. Files are hard linked when LinkFallback is set, otherwise
+// copied Workers at a time at no more than BytesPerSecond in total, where
+// zero is unlimited. Progress is called every few seconds and once done.
+// Skipped is called for each socket, fifo or device file, which are not
+// volume content and are left out of the copy.
+type CopyOptions struct {
+	LinkFallback   bool
+	Workers        int
+	BytesPerSecond int64
+	Progress       func(files, bytes int64)
+	Skipped        func(path string, mode os.FileMode)
+}
+
+type FilesystemStats struct {
+	TotalBytes     int64
+	AvailableBytes int64
+	UsedBytes      int64
+	TotalInodes    int64
+	FreeInodes     int64
+	UsedInodes     int64
+}
+
+// MountInfo describes a mount as listed in /proc/self/mountinfo. Device and
+// Root together identify which directory of which filesystem is mounted.
+type MountInfo struct {
+	Device      string
+	Root        string
+	MountPoint  string
+	Options     []string
+	Propagation []string
+	FsType      string
+	Source      string
 }
 
 type LocalNode struct {
@@ -36,6 +113,42 @@ type LocalNode struct {
 	volumesRootDir string
 	osHelper       OsHelper
 	nodeId         string
+	usage          UsageAccountant
+	quotasEnabled  bool
+	defaultBackend string
+
+	allowedTargetRoots []string
+	journal            PublishJournal
+	specs              VolumeSpecs
+	controllerService  bool
+	copyOptions        CopyOptions
+
+	publishedLock sync.Mutex
+	published     map[string]map[string]struct{}
+	projectIdLock sync.Mutex
+	volumeLocks   *keyedLocks
+	targetLocks   *keyedLocks
+	snapshotLocks *keyedLocks
+}
+
+// Options configures the features added on top of a plain directory per
+// volume. The zero value has quotas, target root checks and the controller
+// service turned off and stores volumes as directories. Without a Usage the
+// volume directories are walked on every stats request, and without a
+// Journal or Specs stages, publishes and volume specs are only remembered in
+// memory.
+type Options struct {
+	Usage          UsageAccountant
+	Journal        PublishJournal
+	Specs          VolumeSpecs
+	QuotasEnabled  bool
+	DefaultBackend string
+
+	// AllowedTargetRoots limits where volumes may be staged and published
+	AllowedTargetRoots []string
+	// ControllerService is reported when the controller is served as well
+	ControllerService bool
+	Copy              CopyOptions
 }
 
 func NewLocalNode(
@@ -45,7 +158,28 @@ func NewLocalNode(
 	logger lager.Logger,
 	volumeRootDir string,
 	nodeId string,
+	options Options,
 ) *LocalNode {
+	defaultBackend := options.DefaultBackend
+	if defaultBackend == "" {
+		defaultBackend = DirectoryBackend
+	}
+
+	usage := options.Usage
+	if usage == nil {
+		usage = NewDirUsageAccountant(filepath, clock.NewClock(), 0, 1)
+	}
+
+	journal := options.Journal
+	if journal == nil {
+		journal = NewMemoryPublishJournal()
+	}
+
+	specs := options.Specs
+	if specs == nil {
+		specs = NewMemoryVolumeSpecs()
+	}
+
 	return &LocalNode{
 		os:             os,
 		filepath:       filepath,
@@ -53,14 +187,216 @@ func NewLocalNode(
 		volumesRootDir: volumeRootDir,
 		osHelper:       osHelper,
 		nodeId:         nodeId,
+		usage:          usage,
+		quotasEnabled:  options.QuotasEnabled,
+		defaultBackend: defaultBackend,
+
+		allowedTargetRoots: options.AllowedTargetRoots,
+		journal:            journal,
+		specs:              specs,
+		controllerService:  options.ControllerService,
+		copyOptions:        options.Copy,
+		published:          map[string]map[string]struct{}{},
+		volumeLocks:        newKeyedLocks(),
+		targetLocks:        newKeyedLocks(),
+		snapshotLocks:      newKeyedLocks(),
 	}
 }
 
 func (ln *LocalNode) NodeStageVolume(ctx context.Context, in *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	logger := ln.logger.Session("node-stage-volume")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetVolumeId()
+	if volId == "" {
+		errorDescription := "Volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if err := validateVolumeId(logger, volId); err != nil {
+		return nil, err
+	}
+
+	stagingPath := in.GetStagingTargetPath()
+	if stagingPath == "" {
+		errorDescription := "Staging target path is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	backend, err := ln.backend(logger, in.GetVolumeContext())
+	if err != nil {
+		return nil, err
+	}
+
+	err = ln.validateTargetPath(logger, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := ln.lockVolume(logger, volId, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	vc := in.GetVolumeCapability()
+	err = ln.validateVolumeCapability(logger, vc, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if vc.GetBlock() != nil {
+		err = ln.stageBlock(logger, volId, in.GetVolumeContext())
+		if err != nil {
+			return nil, err
+		}
+
+		err = ln.recordStage(logger, volId, stagingPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	mounted, err := ln.osHelper.IsMounted(stagingPath)
+	if err != nil {
+		logger.Error("volume-is-mounted-failed", err)
+		errorDescription := "Error checking if volume is mounted"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if mounted {
+		err = ln.recordStage(logger, volId, stagingPath)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("volume-already-staged", lager.Data{"volume id": volId, "staging path": stagingPath})
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	if backend == LoopbackBackend {
+		err = ln.stageImage(logger, volId, stagingPath, vc.GetMount().GetFsType(), in.GetVolumeContext())
+		if err != nil {
+			return nil, err
+		}
+
+		err = ln.recordStage(logger, volId, stagingPath)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("volume-staged", lager.Data{"volume id": volId, "backend": backend, "staging path": stagingPath})
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	volumePath, err := ln.volumePath(logger, volId)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("volume-path", lager.Data{"value": volumePath})
+
+	err = ln.applyCapacity(logger, volId, volumePath, in.GetVolumeContext())
+	if err != nil {
+		return nil, err
+	}
+
+	err = ln.mount(logger, volumePath, stagingPath, false, nil)
+	if err != nil {
+		logger.Error("stage-volume-failed", err)
+		errorDescription := "Error staging volume"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	err = ln.recordStage(logger, volId, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("volume-staged", lager.Data{"volume id": volId, "volume path": volumePath, "staging path": stagingPath})
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
 func (ln *LocalNode) NodeUnstageVolume(ctx context.Context, in *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	logger := ln.logger.Session("node-unstage-volume")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetVolumeId()
+	if volId == "" {
+		errorDescription := "Volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if err := validateVolumeId(logger, volId); err != nil {
+		return nil, err
+	}
+
+	stagingPath := in.GetStagingTargetPath()
+	if stagingPath == "" {
+		errorDescription := "Staging target path is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	err := ln.validateTargetPath(logger, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := ln.lockVolume(logger, volId, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if count := ln.publishCount(volId); count > 0 {
+		logger.Info("volume-still-published", lager.Data{"volume id": volId, "publishes": count})
+		errorDescription := "Volume is still published"
+		return nil, grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	}
+
+	err = ln.unstageBlock(logger, volId)
+	if err != nil {
+		return nil, err
+	}
+
+	mounted, err := ln.osHelper.IsMounted(stagingPath)
+	if err != nil {
+		logger.Error("volume-is-mounted-failed", err)
+		errorDescription := "Error checking if volume is mounted"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	logger.Info("volume-staged", lager.Data{"value": mounted})
+	if mounted {
+		err = ln.osHelper.Unmount(stagingPath)
+		if err != nil {
+			logger.Error("unstage-volume-failed", err)
+			errorDescription := "Error unmounting volume"
+			return nil, grpc.Errorf(codes.Internal, errorDescription)
+		}
+
+		err = ln.os.Remove(stagingPath)
+		if err != nil {
+			logger.Error("remove-staging-path-failed", err)
+			errorDescription := "Error removing volume staging directory"
+			return nil, grpc.Errorf(codes.Internal, errorDescription)
+		}
+	}
+
+	// only once the staging bind is gone, as it keeps the image filesystem busy
+	err = ln.unmountCapacityImage(logger, volId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ln.forgetStage(logger, volId, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
@@ -75,22 +411,78 @@ func (ln *LocalNode) NodePublishVolume(ctx context.Context, in *csi.NodePublishV
 		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
 	}
 
-	volumePath := ln.volumePath(logger, volId)
-	logger.Info("volume-path", lager.Data{"value": volumePath})
+	if err := validateVolumeId(logger, volId); err != nil {
+		return nil, err
+	}
+
+	backend, err := ln.backend(logger, in.GetVolumeContext())
+	if err != nil {
+		return nil, err
+	}
 
 	vc := in.GetVolumeCapability()
-	if vc == nil {
-		errorDescription := "Volume capability is missing in request"
+	err = ln.validateVolumeCapability(logger, vc, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingPath := in.GetStagingTargetPath()
+	if stagingPath == "" {
+		errorDescription := "Staging target path is missing in request"
 		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
 	}
 
-	if vc.GetMount() == nil {
-		errorDescription := "Volume mount capability is not specified"
+	if vc.GetBlock() != nil && in.GetReadonly() {
+		errorDescription := "Read-only access is not supported for block volumes"
 		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
 	}
 
 	mountPath := in.GetTargetPath()
-	logger.Info("mounting-volume", lager.Data{"volume id": volId, "mount point": mountPath})
+	err = ln.validateTargetPath(logger, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// held from before checking the volume is staged, so that it cannot be
+	// unstaged before it is bound to the target
+	unlock, err := ln.lockVolume(logger, volId, mountPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sourcePath := stagingPath
+	if vc.GetBlock() != nil {
+		sourcePath, err = ln.blockDevice(logger, volId)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		staged, err := ln.osHelper.IsMounted(stagingPath)
+		if err != nil {
+			logger.Error("volume-is-staged-failed", err)
+			errorDescription := "Error checking if volume is mounted"
+			return nil, grpc.Errorf(codes.Internal, errorDescription)
+		}
+
+		if !staged {
+			logger.Info("volume-not-staged", lager.Data{"volume id": volId, "staging path": stagingPath})
+			errorDescription := "Volume is not staged"
+			return nil, grpc.Errorf(codes.FailedPrecondition, errorDescription)
+		}
+	}
+
+	readOnly := in.GetReadonly() || vc.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+	logger.Info("mounting-volume", lager.Data{"volume id": volId, "mount point": mountPath, "readonly": readOnly})
+
+	record := PublishRecord{
+		VolumeId:    volId,
+		TargetPath:  mountPath,
+		StagingPath: stagingPath,
+		ReadOnly:    readOnly,
+		MountFlags:  vc.GetMount().GetMountFlags(),
+		Block:       vc.GetBlock() != nil,
+	}
 
 	mounted, err := ln.osHelper.IsMounted(mountPath)
 	if err != nil {
@@ -101,8 +493,42 @@ func (ln *LocalNode) NodePublishVolume(ctx context.Context, in *csi.NodePublishV
 	logger.Info("volume-mounted", lager.Data{"value": mounted})
 
 	if mounted {
-		logger.Info("unmount", lager.Data{"mountPath": mountPath})
-		err := ln.osHelper.Unmount(mountPath)
+		if vc.GetBlock() == nil {
+			sameVolume, err := ln.mountedFrom(logger, mountPath, stagingPath)
+			if err != nil {
+				logger.Error("get-mount-info-failed", err)
+				errorDescription := "Error checking which volume is mounted"
+				return nil, grpc.Errorf(codes.Internal, errorDescription)
+			}
+
+			if !sameVolume {
+				logger.Info("different-volume-mounted", lager.Data{"mountPath": mountPath, "stagingPath": stagingPath})
+				errorDescription := "Target path is already mounted from a different volume"
+				return nil, grpc.Errorf(codes.AlreadyExists, errorDescription)
+			}
+		}
+
+		mismatch, err := ln.checkPublishedMount(logger, mountPath, readOnly, vc.GetMount().GetMountFlags())
+		if err != nil {
+			return nil, err
+		}
+
+		if mismatch == "" {
+			err = ln.recordPublish(logger, record)
+			if err != nil {
+				return nil, err
+			}
+
+			logger.Info("volume-already-published", lager.Data{"volume id": volId, "mount path": mountPath})
+			return &csi.NodePublishVolumeResponse{}, nil
+		}
+
+		if in.GetVolumeContext()[RepairAttribute] != "true" {
+			return nil, grpc.Errorf(codes.AlreadyExists, mismatch)
+		}
+
+		logger.Info("repair-incompatible-mount", lager.Data{"mountPath": mountPath, "reason": mismatch})
+		err = ln.osHelper.Unmount(mountPath)
 		if err != nil {
 			logger.Error("volume-unmount-failed", err)
 			errorDescription := "Error unmounting volume"
@@ -110,14 +536,23 @@ func (ln *LocalNode) NodePublishVolume(ctx context.Context, in *csi.NodePublishV
 		}
 	}
 
-	err = ln.mount(logger, volumePath, mountPath)
+	if vc.GetBlock() != nil {
+		err = ln.mountBlock(logger, sourcePath, mountPath)
+	} else {
+		err = ln.mount(logger, sourcePath, mountPath, readOnly, vc.GetMount().GetMountFlags())
+	}
 	if err != nil {
 		logger.Error("mount-volume-failed", err)
 		errorDescription := "Error mounting volume"
 		return nil, grpc.Errorf(codes.Internal, errorDescription)
 	}
 
-	logger.Info("volume-mounted", lager.Data{"volume id": volId, "volume path": volumePath, "mount path": mountPath})
+	err = ln.recordPublish(logger, record)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("volume-mounted", lager.Data{"volume id": volId, "source path": sourcePath, "mount path": mountPath})
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
@@ -128,12 +563,27 @@ func (ln *LocalNode) NodeUnpublishVolume(ctx context.Context, in *csi.NodeUnpubl
 		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
 	}
 
+	if err := validateVolumeId(ln.logger, volId); err != nil {
+		return nil, err
+	}
+
 	mountPath := in.GetTargetPath()
 	if mountPath == "" {
 		errorDescription := "Mount path is missing in request"
 		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
 	}
 
+	err := ln.validateTargetPath(ln.logger, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := ln.lockVolume(ln.logger, volId, mountPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	ln.logger.Info("unmount", lager.Data{"volume id": volId})
 
 	mounted, err := ln.osHelper.IsMounted(mountPath)
@@ -145,6 +595,10 @@ func (ln *LocalNode) NodeUnpublishVolume(ctx context.Context, in *csi.NodeUnpubl
 
 	ln.logger.Info("volume-mounted", lager.Data{"value": mounted})
 	if !mounted {
+		err = ln.forgetPublish(ln.logger, volId, mountPath)
+		if err != nil {
+			return nil, err
+		}
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
 
@@ -164,15 +618,116 @@ func (ln *LocalNode) NodeUnpublishVolume(ctx context.Context, in *csi.NodeUnpubl
 		return nil, grpc.Errorf(codes.Internal, errorDescription)
 	}
 
+	err = ln.forgetPublish(ln.logger, volId, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
 func (ln *LocalNode) NodeGetVolumeStats(ctx context.Context, in *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
-	return &csi.NodeGetVolumeStatsResponse{}, nil
+	logger := ln.logger.Session("node-get-volume-stats")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	var volId string = in.GetVolumeId()
+	if volId == "" {
+		errorDescription := "Volume ID is missing in request"
+		return nil, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if err := validateVolumeId(logger, volId); err != nil {
+		return nil, err
+	}
+
+	path := in.GetVolumePath()
+	if path == "" {
+		var err error
+		path, err = ln.defaultStatsPath(logger, volId)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := ln.validateTargetPath(logger, path); err != nil {
+			return nil, err
+		}
+
+		if err := ln.checkVolumePathKnown(logger, volId, path); err != nil {
+			return nil, err
+		}
+	}
+
+	exists, err := ln.exists(path)
+	if err != nil {
+		logger.Error("stat-volume-path-failed", err)
+		errorDescription := "Error checking if volume path exists"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !exists {
+		logger.Info("volume-path-not-found", lager.Data{"volume id": volId, "path": path})
+		errorDescription := "Volume path not found"
+		return nil, grpc.Errorf(codes.NotFound, errorDescription)
+	}
+
+	stats, err := ln.osHelper.Statfs(path)
+	if err != nil {
+		logger.Error("statfs-failed", err)
+		errorDescription := "Error getting volume stats"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	stats, err = ln.volumeStats(logger, volId, stats)
+	if err != nil {
+		logger.Error("volume-usage-failed", err)
+		errorDescription := "Error getting volume usage"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+	logger.Info("volume-stats", lager.Data{"volume id": volId, "path": path, "stats": stats})
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     stats.TotalBytes,
+				Available: stats.AvailableBytes,
+				Used:      stats.UsedBytes,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Total:     stats.TotalInodes,
+				Available: stats.FreeInodes,
+				Used:      stats.UsedInodes,
+			},
+		},
+	}, nil
 }
 
 func (ln *LocalNode) NodeGetCapabilities(ctx context.Context, in *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
-	return &csi.NodeGetCapabilitiesResponse{Capabilities: []*csi.NodeServiceCapability{}}, nil
+	return &csi.NodeGetCapabilitiesResponse{Capabilities: []*csi.NodeServiceCapability{
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+				},
+			},
+		},
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+				},
+			},
+		},
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+				},
+			},
+		},
+	}}, nil
 }
 
 func (ln *LocalNode) NodeGetInfo(ctx context.Context, in *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
@@ -182,15 +737,24 @@ func (ln *LocalNode) NodeGetInfo(ctx context.Context, in *csi.NodeGetInfoRequest
 }
 
 // Identity
-//
 func (ln *LocalNode) GetPluginCapabilities(ctx context.Context, in *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
-	return &csi.GetPluginCapabilitiesResponse{Capabilities: []*csi.PluginCapability{}}, nil
+	capabilities := []*csi.PluginCapability{}
+	if ln.controllerService {
+		capabilities = append(capabilities, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
+				},
+			},
+		})
+	}
+	return &csi.GetPluginCapabilitiesResponse{Capabilities: capabilities}, nil
 }
 
 func (ln *LocalNode) GetPluginInfo(ctx context.Context, in *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
 	return &csi.GetPluginInfoResponse{
 		Name:          NODE_PLUGIN_ID,
-		VendorVersion: "0.1.0",
+		VendorVersion: NODE_PLUGIN_VERSION,
 	}, nil
 }
 
@@ -198,27 +762,190 @@ func (ln *LocalNode) Probe(ctx context.Context, in *csi.ProbeRequest) (*csi.Prob
 	return &csi.ProbeResponse{}, nil
 }
 
-func (ns *LocalNode) volumePath(logger lager.Logger, volumeId string) string {
+func (ns *LocalNode) validateVolumeCapability(logger lager.Logger, vc *csi.VolumeCapability, backend string) error {
+	if vc == nil {
+		errorDescription := "Volume capability is missing in request"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	mount := vc.GetMount()
+	if mount == nil && vc.GetBlock() == nil {
+		errorDescription := "Volume mount capability is not specified"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	mode := vc.GetAccessMode().GetMode()
+	if !supportedAccessModes[mode] {
+		logger.Info("unsupported-access-mode", lager.Data{"mode": mode.String()})
+		errorDescription := fmt.Sprintf("Volume access mode %s is not supported", mode.String())
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if mount == nil {
+		// the loop device is shared by every publish and writable, so a
+		// read-only bind of it would not stop writes reaching the image
+		if mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY {
+			logger.Info("read-only-block-volume", lager.Data{"mode": mode.String()})
+			errorDescription := "Read-only access is not supported for block volumes"
+			return grpc.Errorf(codes.InvalidArgument, errorDescription)
+		}
+		return nil
+	}
+
+	fsType := mount.GetFsType()
+	if fsType != "" && !(backend == LoopbackBackend && supportedImageFsTypes[fsType]) {
+		logger.Info("unsupported-fs-type", lager.Data{"fsType": fsType, "backend": backend})
+		errorDescription := fmt.Sprintf("Volume filesystem type %s is not supported", mount.GetFsType())
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	for _, flag := range mount.GetMountFlags() {
+		if !allowedMountFlags[flag] {
+			logger.Info("unsupported-mount-flag", lager.Data{"flag": flag})
+			errorDescription := fmt.Sprintf("Mount flag %s is not supported", flag)
+			return grpc.Errorf(codes.InvalidArgument, errorDescription)
+		}
+	}
+
+	// the kernel keeps only one atime mode, so a mount asked for both could
+	// never be found to match on a retry
+	if hasMountFlag(mount.GetMountFlags(), "noatime") && hasMountFlag(mount.GetMountFlags(), "relatime") {
+		logger.Info("conflicting-atime-mount-flags", lager.Data{"flags": mount.GetMountFlags()})
+		errorDescription := "Mount flags noatime and relatime cannot be combined"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return nil
+}
+
+func hasMountFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (ns *LocalNode) volumePath(logger lager.Logger, volumeId string) (string, error) {
 	volumesPathRoot := filepath.Join(ns.volumesRootDir, volumeId)
-	orig := ns.osHelper.Umask(000)
-	defer ns.osHelper.Umask(orig)
-	err := ns.os.MkdirAll(volumesPathRoot, os.ModePerm)
+	err := ns.mkdirAll(volumesPathRoot, os.ModePerm)
+	if err != nil {
+		logger.Error("create-volume-path-failed", err, lager.Data{"path": volumesPathRoot})
+		return "", createVolumePathError(err)
+	}
+
+	err = ns.confine(logger, volumesPathRoot)
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+
+	return volumesPathRoot, nil
+}
+
+// createVolumePathError tells callers whether creating the volume directory
+// failed because the disk is full, because it can't be written to, or for
+// some other reason.
+func createVolumePathError(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
 	}
 
-	return volumesPathRoot
+	switch err {
+	case syscall.ENOSPC:
+		errorDescription := "Not enough space to create volume directory"
+		return grpc.Errorf(codes.ResourceExhausted, errorDescription)
+	case syscall.EACCES, syscall.EROFS:
+		errorDescription := "Volumes root directory is not writable"
+		return grpc.Errorf(codes.FailedPrecondition, errorDescription)
+	default:
+		errorDescription := "Error creating volume directory"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
 }
 
-func (ns *LocalNode) mount(logger lager.Logger, volumePath, mountPath string) error {
+func (ns *LocalNode) mount(logger lager.Logger, volumePath, mountPath string, readOnly bool, options []string) error {
 	err := ns.createVolumesRootifNotExist(logger, mountPath)
 	if err != nil {
 		logger.Error("create-volumes-root", err)
 		return err
 	}
 
-	logger.Info("mount", lager.Data{"src": volumePath, "tgt": mountPath})
-	return ns.osHelper.Mount(volumePath, mountPath)
+	logger.Info("mount", lager.Data{"src": volumePath, "tgt": mountPath, "readonly": readOnly, "options": options})
+	if readOnly {
+		return ns.osHelper.MountReadOnly(volumePath, mountPath, options)
+	}
+	return ns.osHelper.Mount(volumePath, mountPath, options)
+}
+
+// checkPublishedMount compares a mount already at the target path with the
+// read-only mode and mount flags now being asked for, returning why they
+// differ, or nothing if the mount can be left in place.
+func (ns *LocalNode) checkPublishedMount(logger lager.Logger, mountPath string, readOnly bool, mountFlags []string) (string, error) {
+	mountedReadOnly, err := ns.osHelper.IsReadOnly(mountPath)
+	if err != nil {
+		logger.Error("volume-is-read-only-failed", err)
+		errorDescription := "Error checking if volume is mounted read-only"
+		return "", grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if mountedReadOnly != readOnly {
+		logger.Info("volume-mounted-with-different-mode", lager.Data{"mountPath": mountPath, "readonly": mountedReadOnly})
+		return "Volume is already mounted with a different read-only mode", nil
+	}
+
+	info, found, err := ns.osHelper.GetMountInfo(mountPath)
+	if err != nil {
+		logger.Error("get-mount-info-failed", err)
+		errorDescription := "Error checking which volume is mounted"
+		return "", grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !found {
+		return "", nil
+	}
+
+	requested := map[string]bool{}
+	for _, flag := range mountFlags {
+		requested[flag] = true
+	}
+
+	// the kernel mounts with relatime unless noatime is asked for
+	if !requested["noatime"] {
+		requested["relatime"] = true
+	}
+
+	mounted := map[string]bool{}
+	for _, option := range info.Options {
+		mounted[option] = true
+	}
+
+	for flag := range allowedMountFlags {
+		if requested[flag] != mounted[flag] {
+			logger.Info("volume-mounted-with-different-flags", lager.Data{"mountPath": mountPath, "options": info.Options, "flag": flag})
+			return "Volume is already mounted with different mount flags", nil
+		}
+	}
+
+	return "", nil
+}
+
+// mountedFrom reports whether the mount at targetPath exposes the same
+// directory of the same filesystem as the mount at sourcePath. Mounts that
+// can't be found in the mount table are given the benefit of the doubt.
+func (ns *LocalNode) mountedFrom(logger lager.Logger, targetPath, sourcePath string) (bool, error) {
+	target, found, err := ns.osHelper.GetMountInfo(targetPath)
+	if err != nil || !found {
+		return true, err
+	}
+
+	source, found, err := ns.osHelper.GetMountInfo(sourcePath)
+	if err != nil || !found {
+		return true, err
+	}
+
+	logger.Debug("mount-info", lager.Data{"target": target, "source": source})
+	return target.Device == source.Device && target.Root == source.Root, nil
 }
 
 func (ns *LocalNode) exists(path string) (bool, error) {
@@ -239,9 +966,191 @@ func (ns *LocalNode) createVolumesRootifNotExist(logger lager.Logger, mountPath
 		return err
 	}
 
+	if len(ns.allowedTargetRoots) > 0 {
+		// checked again here as the path may have changed since the request was validated
+		_, ok, err := ns.targetRoot(mountPath)
+		if err != nil {
+			logger.Error("resolve-target-path-failed", err)
+			return err
+		}
+
+		if !ok {
+			return errors.New("path is outside the allowed mount roots")
+		}
+	}
+
 	logger.Debug("mkdir", lager.Data{"mountPath": mountPath})
-	orig := ns.osHelper.Umask(000)
-	defer ns.osHelper.Umask(orig)
+	return ns.mkdirAll(mountPath, os.ModePerm)
+}
+
+// mkdirAll creates path and any missing parents with exactly mode. The
+// process umask is shared by every in-flight request, so the permissions are
+// set with chmod instead.
+func (ns *LocalNode) mkdirAll(path string, mode os.FileMode) error {
+	missing := []string{}
+	for dir := filepath.Clean(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		exists, err := ns.exists(dir)
+		if err != nil {
+			return err
+		}
+		if exists {
+			break
+		}
+		missing = append(missing, dir)
+	}
+
+	err := ns.os.MkdirAll(path, mode)
+	if err != nil {
+		return err
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		err = ns.os.Chmod(missing[i], mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultStatsPath is where stats are taken when the request has no volume
+// path. A loopback volume's filesystem is only mounted while it is staged,
+// so its staging path is used.
+func (ns *LocalNode) defaultStatsPath(logger lager.Logger, volumeId string) (string, error) {
+	loopback, err := ns.exists(ns.imagePath(volumeId))
+	if err != nil {
+		logger.Error("stat-volume-image-failed", err)
+		errorDescription := "Error checking if volume path exists"
+		return "", grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !loopback {
+		return filepath.Join(ns.volumesRootDir, volumeId), nil
+	}
+
+	stages, err := ns.journal.Stages()
+	if err != nil {
+		logger.Error("read-publish-journal-failed", err)
+		errorDescription := "Error checking volume path"
+		return "", grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	for _, stage := range stages {
+		if stage.VolumeId == volumeId {
+			return stage.StagingPath, nil
+		}
+	}
+
+	logger.Info("loopback-volume-not-staged", lager.Data{"volume id": volumeId})
+	errorDescription := "Volume path is required for a loopback volume that is not staged"
+	return "", grpc.Errorf(codes.InvalidArgument, errorDescription)
+}
+
+// checkVolumePathKnown only lets stats be taken at a path the volume was
+// staged or published to, so that they can't be used to probe the host.
+func (ns *LocalNode) checkVolumePathKnown(logger lager.Logger, volumeId, path string) error {
+	stages, err := ns.journal.Stages()
+	if err != nil {
+		logger.Error("read-publish-journal-failed", err)
+		errorDescription := "Error checking volume path"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	records, err := ns.journal.Records()
+	if err != nil {
+		logger.Error("read-publish-journal-failed", err)
+		errorDescription := "Error checking volume path"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	path = filepath.Clean(path)
+	for _, stage := range stages {
+		if stage.VolumeId == volumeId && filepath.Clean(stage.StagingPath) == path {
+			return nil
+		}
+	}
+	for _, record := range records {
+		if record.VolumeId == volumeId && filepath.Clean(record.TargetPath) == path {
+			return nil
+		}
+	}
+
+	logger.Info("volume-path-not-known", lager.Data{"volume id": volumeId, "path": path})
+	errorDescription := "Volume path not found"
+	return grpc.Errorf(codes.NotFound, errorDescription)
+}
+
+// recordStage notes the staging mount in the journal so that it isn't
+// mistaken for an orphan.
+func (ns *LocalNode) recordStage(logger lager.Logger, volumeId, stagingPath string) error {
+	err := ns.journal.RecordStage(StageRecord{VolumeId: volumeId, StagingPath: stagingPath})
+	if err != nil {
+		logger.Error("record-stage-failed", err, lager.Data{"volume id": volumeId, "staging path": stagingPath})
+		errorDescription := "Error recording staged volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+	return nil
+}
+
+func (ns *LocalNode) forgetStage(logger lager.Logger, volumeId, stagingPath string) error {
+	err := ns.journal.RemoveStage(volumeId, stagingPath)
+	if err != nil {
+		logger.Error("remove-stage-record-failed", err, lager.Data{"volume id": volumeId, "staging path": stagingPath})
+		errorDescription := "Error removing staged volume record"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+	return nil
+}
+
+// recordPublish notes the publish both in memory and in the journal, so that
+// it is still known about after a restart.
+func (ns *LocalNode) recordPublish(logger lager.Logger, record PublishRecord) error {
+	err := ns.journal.Record(record)
+	if err != nil {
+		logger.Error("record-publish-failed", err, lager.Data{"volume id": record.VolumeId, "target path": record.TargetPath})
+		errorDescription := "Error recording published volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	ns.addPublish(record.VolumeId, record.TargetPath)
+	return nil
+}
+
+func (ns *LocalNode) forgetPublish(logger lager.Logger, volumeId, targetPath string) error {
+	ns.removePublish(volumeId, targetPath)
+
+	err := ns.journal.Remove(volumeId, targetPath)
+	if err != nil {
+		logger.Error("remove-publish-record-failed", err, lager.Data{"volume id": volumeId, "target path": targetPath})
+		errorDescription := "Error removing published volume record"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+	return nil
+}
+
+func (ns *LocalNode) addPublish(volumeId, targetPath string) {
+	ns.publishedLock.Lock()
+	defer ns.publishedLock.Unlock()
+
+	if ns.published[volumeId] == nil {
+		ns.published[volumeId] = map[string]struct{}{}
+	}
+	ns.published[volumeId][targetPath] = struct{}{}
+}
+
+func (ns *LocalNode) removePublish(volumeId, targetPath string) {
+	ns.publishedLock.Lock()
+	defer ns.publishedLock.Unlock()
+
+	delete(ns.published[volumeId], targetPath)
+	if len(ns.published[volumeId]) == 0 {
+		delete(ns.published, volumeId)
+	}
+}
+
+func (ns *LocalNode) publishCount(volumeId string) int {
+	ns.publishedLock.Lock()
+	defer ns.publishedLock.Unlock()
 
-	return ns.os.MkdirAll(mountPath, os.ModePerm)
+	return len(ns.published[volumeId])
 }
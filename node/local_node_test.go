@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/context"
 
 	"os"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -28,11 +29,14 @@ var _ = Describe("Node Client", func() {
 		err              error
 		fakeFilepath     *filepath_fake.FakeFilepath
 		fakeOs           *os_fake.FakeOs
+		fakeJournal      *nodefakes.FakePublishJournal
 		fakeOsHelper     *nodefakes.FakeOsHelper
+		fakeUsage        *nodefakes.FakeUsageAccountant
 		fileInfo         *FakeFileInfo
 		localNode        *node.LocalNode
 		mountPath        string
 		publishResp      *csi.NodePublishVolumeResponse
+		stagingPath      string
 		testLogger       lager.Logger
 		volumeCapability *csi.VolumeCapability
 		volumeId         string
@@ -43,52 +47,573 @@ var _ = Describe("Node Client", func() {
 		volumesRoot = "/tmp/_volumes"
 		volumeId = "test-volume-id"
 		mountPath = "/path/to/mount/_mounts/test-volume-id"
+		stagingPath = "/path/to/staging/test-volume-id"
 
 		testLogger = lagertest.NewTestLogger("localdriver-local")
 		context = &DummyContext{}
 
 		fakeOs = &os_fake.FakeOs{}
 		fakeFilepath = &filepath_fake.FakeFilepath{}
-		fakeFilepath.AbsReturns(mountPath, nil)
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
 
 		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeUsage = &nodefakes.FakeUsageAccountant{}
+		fakeJournal = &nodefakes.FakePublishJournal{}
 
-		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, volumesRoot, "some-node-id")
-		volumeCapability = &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{}}
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, volumesRoot, "some-node-id", node.Options{Usage: fakeUsage, Journal: fakeJournal})
+		volumeCapability = &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
 
 		fileInfo = newFakeFileInfo()
 		fileInfo.StubMode(os.ModeSymlink)
 	})
 
-	Describe("NodePublishVolume", func() {
-		Context("when the volume and mount directories do not exist", func() {
+	Describe("NodeStageVolume", func() {
+		Context("when the volume is not staged", func() {
 			BeforeEach(func() {
 				fakeOsHelper.IsMountedReturns(false, nil)
 			})
 
-			It("creates the required directories and mounts the volume", func() {
-				publishResp, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-					VolumeId:         volumeId,
-					TargetPath:       mountPath,
-					VolumeCapability: volumeCapability,
-					Readonly:         false,
+			It("creates the volume and staging directories and mounts the volume at the staging path", func() {
+				stageResp, err := localNode.NodeStageVolume(context, &csi.NodeStageVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					VolumeCapability:  volumeCapability,
 				})
 				Expect(err).NotTo(HaveOccurred())
-				Expect(*publishResp).To(Equal(csi.NodePublishVolumeResponse{}))
+				Expect(*stageResp).To(Equal(csi.NodeStageVolumeResponse{}))
 
-				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.IsMountedCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.IsMountedArgsForCall(0)).To(Equal(stagingPath))
 
 				Expect(fakeOs.MkdirAllCallCount()).To(Equal(2))
 				srcPath, _ := fakeOs.MkdirAllArgsForCall(0)
 				Expect(srcPath).To(Equal(filepath.Join(volumesRoot, volumeId)))
 				tgtPath, _ := fakeOs.MkdirAllArgsForCall(1)
-				Expect(tgtPath).To(Equal(mountPath))
+				Expect(tgtPath).To(Equal(stagingPath))
 
 				Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
-				from, to := fakeOsHelper.MountArgsForCall(0)
+				from, to, _ := fakeOsHelper.MountArgsForCall(0)
 				Expect(from).To(Equal(filepath.Join(volumesRoot, volumeId)))
+				Expect(to).To(Equal(stagingPath))
+
+				Expect(fakeJournal.RecordStageCallCount()).To(Equal(1))
+				Expect(fakeJournal.RecordStageArgsForCall(0)).To(Equal(node.StageRecord{VolumeId: volumeId, StagingPath: stagingPath}))
+			})
+
+			Context("when the stage cannot be recorded", func() {
+				BeforeEach(func() {
+					fakeJournal.RecordStageReturns(errors.New("disk full"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, &csi.NodeStageVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error recording staged volume"))
+				})
+			})
+		})
+
+		Context("when the volume directory does not exist yet", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("sets its permissions explicitly rather than relying on the umask", func() {
+				_, err := localNode.NodeStageVolume(context, &csi.NodeStageVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					VolumeCapability:  volumeCapability,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				chmodded := map[string]os.FileMode{}
+				for i := 0; i < fakeOs.ChmodCallCount(); i++ {
+					path, mode := fakeOs.ChmodArgsForCall(i)
+					chmodded[path] = mode
+				}
+				Expect(chmodded).To(HaveKeyWithValue(filepath.Join(volumesRoot, volumeId), os.ModePerm))
+				Expect(chmodded).To(HaveKeyWithValue(stagingPath, os.ModePerm))
+			})
+
+			Context("when parents of the volume directory are missing too", func() {
+				BeforeEach(func() {
+					fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+						if path == "/tmp" || path == "/path/to" {
+							return fileInfo, nil
+						}
+						return nil, os.ErrNotExist
+					}
+				})
+
+				It("gives them the same permissions, from the top down", func() {
+					_, err := localNode.NodeStageVolume(context, &csi.NodeStageVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					paths := []string{}
+					for i := 0; i < fakeOs.ChmodCallCount(); i++ {
+						path, mode := fakeOs.ChmodArgsForCall(i)
+						Expect(mode).To(Equal(os.ModePerm))
+						paths = append(paths, path)
+					}
+					Expect(paths).To(Equal([]string{
+						volumesRoot,
+						filepath.Join(volumesRoot, volumeId),
+						"/path/to/staging",
+						stagingPath,
+					}))
+				})
+			})
+		})
+
+		Context("when the volume is already staged", func() {
+			BeforeEach(func() {
+				fakeOsHelper.IsMountedReturns(true, nil)
+			})
+
+			It("does not mount the volume again", func() {
+				stageResp, err := localNode.NodeStageVolume(context, &csi.NodeStageVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					VolumeCapability:  volumeCapability,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*stageResp).To(Equal(csi.NodeStageVolumeResponse{}))
+
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("failure cases", func() {
+			var request *csi.NodeStageVolumeRequest
+
+			BeforeEach(func() {
+				request = &csi.NodeStageVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					VolumeCapability:  volumeCapability,
+				}
+			})
+
+			Context("when the volume id is missing", func() {
+				BeforeEach(func() {
+					request.VolumeId = ""
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume ID is missing in request"))
+				})
+			})
+
+			Context("when the staging target path is missing", func() {
+				BeforeEach(func() {
+					request.StagingTargetPath = ""
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Staging target path is missing in request"))
+				})
+			})
+
+			Context("when the volume capability is missing", func() {
+				BeforeEach(func() {
+					request.VolumeCapability = nil
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume capability is missing in request"))
+				})
+			})
+
+			Context("when the volume capability is not mount capability", func() {
+				BeforeEach(func() {
+					request.VolumeCapability = &csi.VolumeCapability{}
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume mount capability is not specified"))
+				})
+			})
+
+			Context("when both noatime and relatime are requested", func() {
+				BeforeEach(func() {
+					volumeCapability.GetMount().MountFlags = []string{"noatime", "relatime"}
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Mount flags noatime and relatime cannot be combined"))
+
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the volume access mode is not supported", func() {
+				BeforeEach(func() {
+					request.VolumeCapability.AccessMode.Mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume access mode MULTI_NODE_MULTI_WRITER is not supported"))
+				})
+			})
+
+			Context("when checking if mounted fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(false, errors.New("failed to check if mounted"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error checking if volume is mounted"))
+				})
+			})
+
+			Context("when the volume mount fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.MountReturns(errors.New("failed to mount volume"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, request)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error staging volume"))
+				})
+			})
+
+			Context("when creating the volume directory fails", func() {
+				var mkdirErr error
+
+				JustBeforeEach(func() {
+					fakeOs.MkdirAllReturns(&os.PathError{Op: "mkdir", Path: filepath.Join(volumesRoot, volumeId), Err: mkdirErr})
+				})
+
+				Context("because the disk is full", func() {
+					BeforeEach(func() {
+						mkdirErr = syscall.ENOSPC
+					})
+
+					It("returns a resource exhausted error", func() {
+						_, err := localNode.NodeStageVolume(context, request)
+						Expect(err).To(HaveOccurred())
+						grpcStatus, _ := status.FromError(err)
+						Expect(grpcStatus.Code()).To(Equal(codes.ResourceExhausted))
+						Expect(grpcStatus.Message()).To(Equal("Not enough space to create volume directory"))
+						Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("because the volumes root is read-only", func() {
+					BeforeEach(func() {
+						mkdirErr = syscall.EROFS
+					})
+
+					It("returns a failed precondition error", func() {
+						_, err := localNode.NodeStageVolume(context, request)
+						Expect(err).To(HaveOccurred())
+						grpcStatus, _ := status.FromError(err)
+						Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+						Expect(grpcStatus.Message()).To(Equal("Volumes root directory is not writable"))
+					})
+				})
+
+				Context("because permission is denied", func() {
+					BeforeEach(func() {
+						mkdirErr = syscall.EACCES
+					})
+
+					It("returns a failed precondition error", func() {
+						_, err := localNode.NodeStageVolume(context, request)
+						Expect(err).To(HaveOccurred())
+						grpcStatus, _ := status.FromError(err)
+						Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+					})
+				})
+
+				Context("for any other reason", func() {
+					BeforeEach(func() {
+						mkdirErr = syscall.EIO
+					})
+
+					It("returns an internal error", func() {
+						_, err := localNode.NodeStageVolume(context, request)
+						Expect(err).To(HaveOccurred())
+						grpcStatus, _ := status.FromError(err)
+						Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+						Expect(grpcStatus.Message()).To(Equal("Error creating volume directory"))
+					})
+				})
+			})
+		})
+	})
+
+	Describe("NodeUnstageVolume", func() {
+		Context("when the volume is staged", func() {
+			BeforeEach(func() {
+				fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+					return path != filepath.Join(volumesRoot, volumeId), nil
+				}
+			})
+
+			It("unmounts the staging path and removes it", func() {
+				unstageResp, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*unstageResp).To(Equal(csi.NodeUnstageVolumeResponse{}))
+
+				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.UnmountArgsForCall(0)).To(Equal(stagingPath))
+
+				Expect(fakeOs.RemoveCallCount()).To(Equal(1))
+				Expect(fakeOs.RemoveArgsForCall(0)).To(Equal(stagingPath))
+
+				Expect(fakeJournal.RemoveStageCallCount()).To(Equal(1))
+				removedId, removedPath := fakeJournal.RemoveStageArgsForCall(0)
+				Expect(removedId).To(Equal(volumeId))
+				Expect(removedPath).To(Equal(stagingPath))
+			})
+
+			Context("when the volume is still published", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+						return path == stagingPath, nil
+					}
+
+					_, err := localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("refuses to unstage the volume", func() {
+					_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+					Expect(grpcStatus.Message()).To(Equal("Volume is still published"))
+
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+				})
+
+				It("unstages the volume once it has been unpublished", func() {
+					fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+						return path != filepath.Join(volumesRoot, volumeId), nil
+					}
+
+					_, err := localNode.NodeUnpublishVolume(context, &csi.NodeUnpublishVolumeRequest{
+						VolumeId:   volumeId,
+						TargetPath: mountPath,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(2))
+					Expect(fakeOsHelper.UnmountArgsForCall(1)).To(Equal(stagingPath))
+				})
+			})
+		})
+
+		Context("when the volume is not staged", func() {
+			BeforeEach(func() {
+				fakeOsHelper.IsMountedReturns(false, nil)
+			})
+
+			It("exits early and does not return an error", func() {
+				unstageResp, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*unstageResp).To(Equal(csi.NodeUnstageVolumeResponse{}))
+
+				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("failure cases", func() {
+			Context("when the volume id is missing", func() {
+				It("returns an error", func() {
+					_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+						StagingTargetPath: stagingPath,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume ID is missing in request"))
+				})
+			})
+
+			Context("when the staging target path is missing", func() {
+				It("returns an error", func() {
+					_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+						VolumeId: volumeId,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Staging target path is missing in request"))
+				})
+			})
+
+			Context("when unmounting the staging path fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(true, nil)
+					fakeOsHelper.UnmountReturns(errors.New("failed to unmount"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error unmounting volume"))
+				})
+			})
+
+			Context("when removing the staging path fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(true, nil)
+					fakeOs.RemoveReturns(errors.New("failed to remove"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error removing volume staging directory"))
+				})
+			})
+		})
+	})
+
+	Describe("NodePublishVolume", func() {
+		BeforeEach(func() {
+			fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+				return path == stagingPath, nil
+			}
+		})
+
+		Context("when the mount directory does not exist", func() {
+			It("creates the mount directory and bind mounts the staging path", func() {
+				publishResp, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+					Readonly:          false,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*publishResp).To(Equal(csi.NodePublishVolumeResponse{}))
+
+				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(1))
+				tgtPath, _ := fakeOs.MkdirAllArgsForCall(0)
+				Expect(tgtPath).To(Equal(mountPath))
+
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+				from, to, _ := fakeOsHelper.MountArgsForCall(0)
+				Expect(from).To(Equal(stagingPath))
 				Expect(to).To(Equal(mountPath))
 			})
+
+			It("records the publish in the journal", func() {
+				_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"noexec"}}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+					Readonly:          true,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeJournal.RecordCallCount()).To(Equal(1))
+				Expect(fakeJournal.RecordArgsForCall(0)).To(Equal(node.PublishRecord{
+					VolumeId:    volumeId,
+					TargetPath:  mountPath,
+					StagingPath: stagingPath,
+					ReadOnly:    true,
+					MountFlags:  []string{"noexec"},
+				}))
+			})
 		})
 
 		Context("when the mount path is mounted", func() {
@@ -96,30 +621,322 @@ var _ = Describe("Node Client", func() {
 				fakeOsHelper.IsMountedReturns(true, nil)
 			})
 
-			It("unmounts the destination directory, creates the volume directory and bind mounts the volume path to the mount path", func() {
+			It("leaves the existing mount in place", func() {
 				publishResp, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-					VolumeId:         volumeId,
-					TargetPath:       mountPath,
-					VolumeCapability: volumeCapability,
-					Readonly:         false,
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+					Readonly:          false,
 				})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(*publishResp).To(Equal(csi.NodePublishVolumeResponse{}))
 
-				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(1))
-				tgtPath := fakeOsHelper.UnmountArgsForCall(0)
-				Expect(tgtPath).To(Equal(mountPath))
+				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				Expect(fakeJournal.RecordCallCount()).To(Equal(1))
+			})
 
-				Expect(fakeOs.MkdirAllCallCount()).To(Equal(2))
-				srcPath, _ := fakeOs.MkdirAllArgsForCall(0)
-				Expect(srcPath).To(Equal(filepath.Join(volumesRoot, volumeId)))
-				tgtPath, _ = fakeOs.MkdirAllArgsForCall(1)
-				Expect(tgtPath).To(Equal(mountPath))
+			It("counts the volume as published", func() {
+				_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{VolumeId: volumeId, StagingTargetPath: stagingPath})
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+
+				_, err = localNode.DeleteVolume(context, &csi.DeleteVolumeRequest{VolumeId: volumeId})
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ = status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+				Expect(grpcStatus.Message()).To(Equal("Volume is still published"))
+			})
+
+			Context("when a repair is requested", func() {
+				repair := func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						VolumeContext:     map[string]string{node.RepairAttribute: "true"},
+					})
+				}
+
+				It("leaves a compatible mount in place", func() {
+					repair()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+
+				Context("and the mount is incompatible", func() {
+					BeforeEach(func() {
+						fakeOsHelper.IsReadOnlyReturns(true, nil)
+					})
+
+					It("unmounts the destination directory and bind mounts the staging path to the mount path", func() {
+						repair()
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(fakeOsHelper.UnmountCallCount()).To(Equal(1))
+						Expect(fakeOsHelper.UnmountArgsForCall(0)).To(Equal(mountPath))
+
+						Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+						from, to, _ := fakeOsHelper.MountArgsForCall(0)
+						Expect(from).To(Equal(stagingPath))
+						Expect(to).To(Equal(mountPath))
+					})
+				})
+			})
+
+			Context("when the mount path is mounted with the requested mount flags", func() {
+				BeforeEach(func() {
+					volumeCapability.GetMount().MountFlags = []string{"noexec"}
+					fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+						return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/test-volume-id", MountPoint: path, Options: []string{"rw", "noexec", "relatime"}}, true, nil
+					}
+				})
+
+				It("leaves the existing mount in place", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the mount path is mounted without the requested mount flags", func() {
+				BeforeEach(func() {
+					volumeCapability.GetMount().MountFlags = []string{"noexec", "nosuid"}
+					fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+						return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/test-volume-id", MountPoint: path, Options: []string{"rw", "noexec"}}, true, nil
+					}
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.AlreadyExists))
+					Expect(grpcStatus.Message()).To(Equal("Volume is already mounted with different mount flags"))
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the mount path is mounted with mount flags that were not requested", func() {
+				BeforeEach(func() {
+					volumeCapability.GetMount().MountFlags = []string{"noexec"}
+					fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+						return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/test-volume-id", MountPoint: path, Options: []string{"rw", "nosuid", "noexec", "relatime"}}, true, nil
+					}
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.AlreadyExists))
+					Expect(grpcStatus.Message()).To(Equal("Volume is already mounted with different mount flags"))
+				})
+			})
+
+			Context("when the mount path is mounted with noatime but no flags were requested", func() {
+				BeforeEach(func() {
+					fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+						return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/test-volume-id", MountPoint: path, Options: []string{"rw", "noatime"}}, true, nil
+					}
+				})
+
+				It("expects the relatime the kernel defaults to", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.AlreadyExists))
+				})
+			})
+
+			Context("when a different volume is mounted at the mount path", func() {
+				BeforeEach(func() {
+					fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+						if path == mountPath {
+							return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/other-volume-id", MountPoint: path}, true, nil
+						}
+						return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/test-volume-id", MountPoint: path}, true, nil
+					}
+				})
+
+				It("returns an error without unmounting it", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.AlreadyExists))
+					Expect(grpcStatus.Message()).To(Equal("Target path is already mounted from a different volume"))
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when reading the mount table fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.GetMountInfoReturns(node.MountInfo{}, false, errors.New("permission denied"))
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when mount flags are specified", func() {
+			BeforeEach(func() {
+				volumeCapability.GetMount().MountFlags = []string{"noexec", "nosuid", "nodev", "noatime"}
+			})
+
+			It("applies the mount flags to the bind mount", func() {
+				_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+					Readonly:          false,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+				_, _, options := fakeOsHelper.MountArgsForCall(0)
+				Expect(options).To(Equal([]string{"noexec", "nosuid", "nodev", "noatime"}))
+			})
+
+			It("accepts an identical retry once the mount is in place", func() {
+				mounted := map[string]bool{stagingPath: true}
+				fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+					return mounted[path], nil
+				}
+				fakeOsHelper.MountStub = func(from, to string, options []string) error {
+					mounted[to] = true
+					return nil
+				}
+				fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+					return node.MountInfo{Device: "8:1", Root: "/tmp/_volumes/test-volume-id", MountPoint: path, Options: []string{"rw", "noexec", "nosuid", "nodev", "noatime"}}, true, nil
+				}
+
+				request := &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+				}
+				_, err = localNode.NodePublishVolume(context, request)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = localNode.NodePublishVolume(context, request)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the access mode is SINGLE_NODE_READER_ONLY", func() {
+			BeforeEach(func() {
+				volumeCapability.AccessMode.Mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+			})
+
+			It("bind mounts the staging path read-only", func() {
+				_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+					Readonly:          false,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the volume is published read-only", func() {
+			It("bind mounts the staging path read-only", func() {
+				publishResp, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+					VolumeId:          volumeId,
+					StagingTargetPath: stagingPath,
+					TargetPath:        mountPath,
+					VolumeCapability:  volumeCapability,
+					Readonly:          true,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*publishResp).To(Equal(csi.NodePublishVolumeResponse{}))
+
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(1))
+				from, to, _ := fakeOsHelper.MountReadOnlyArgsForCall(0)
+				Expect(from).To(Equal(stagingPath))
+				Expect(to).To(Equal(mountPath))
+			})
+
+			Context("when the mount path is already mounted read-only", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(true, nil)
+					fakeOsHelper.IsReadOnlyReturns(true, nil)
+				})
 
-				Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
-				from, to := fakeOsHelper.MountArgsForCall(0)
-				Expect(from).To(Equal(filepath.Join(volumesRoot, volumeId)))
-				Expect(to).To(Equal(mountPath))
+				It("leaves the read-only mount in place", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          true,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeOsHelper.IsReadOnlyCallCount()).To(Equal(1))
+					Expect(fakeOsHelper.IsReadOnlyArgsForCall(0)).To(Equal(mountPath))
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(0))
+				})
 			})
 		})
 
@@ -131,10 +948,11 @@ var _ = Describe("Node Client", func() {
 
 				It("returns an error", func() {
 					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-						VolumeId:         volumeId,
-						TargetPath:       mountPath,
-						VolumeCapability: volumeCapability,
-						Readonly:         false,
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
 					})
 					Expect(err).To(HaveOccurred())
 					grpcStatus, _ := status.FromError(err)
@@ -151,10 +969,11 @@ var _ = Describe("Node Client", func() {
 
 				It("returns an error", func() {
 					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-						VolumeId:         volumeId,
-						TargetPath:       mountPath,
-						VolumeCapability: volumeCapability,
-						Readonly:         false,
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
 					})
 					Expect(err).To(HaveOccurred())
 					grpcStatus, _ := status.FromError(err)
@@ -164,6 +983,50 @@ var _ = Describe("Node Client", func() {
 				})
 			})
 
+			Context("when the staging target path is missing", func() {
+				BeforeEach(func() {
+					stagingPath = ""
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Staging target path is missing in request"))
+				})
+			})
+
+			Context("when the volume is not staged", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(false, nil)
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+					Expect(grpcStatus.Message()).To(Equal("Volume is not staged"))
+
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+
 			Context("When the volume capability is not mount capability", func() {
 				BeforeEach(func() {
 					volumeCapability = &csi.VolumeCapability{}
@@ -171,10 +1034,11 @@ var _ = Describe("Node Client", func() {
 
 				It("returns an error", func() {
 					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-						VolumeId:         volumeId,
-						TargetPath:       mountPath,
-						VolumeCapability: volumeCapability,
-						Readonly:         false,
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
 					})
 					Expect(err).To(HaveOccurred())
 					grpcStatus, _ := status.FromError(err)
@@ -184,6 +1048,71 @@ var _ = Describe("Node Client", func() {
 				})
 			})
 
+			Context("when the volume filesystem type is specified", func() {
+				BeforeEach(func() {
+					volumeCapability.GetMount().FsType = "ext4"
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume filesystem type ext4 is not supported"))
+				})
+			})
+
+			Context("when a mount flag is not allowed", func() {
+				BeforeEach(func() {
+					volumeCapability.GetMount().MountFlags = []string{"noexec", "suid"}
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Mount flag suid is not supported"))
+
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the volume access mode is not supported", func() {
+				BeforeEach(func() {
+					volumeCapability.AccessMode.Mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume access mode MULTI_NODE_MULTI_WRITER is not supported"))
+				})
+			})
+
 			Context("when checking if mounted fails", func() {
 				BeforeEach(func() {
 					fakeOsHelper.IsMountedReturns(false, errors.New("failed to check if mounted"))
@@ -191,10 +1120,11 @@ var _ = Describe("Node Client", func() {
 
 				It("returns an error", func() {
 					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-						VolumeId:         volumeId,
-						TargetPath:       mountPath,
-						VolumeCapability: volumeCapability,
-						Readonly:         false,
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
 					})
 					Expect(err).To(HaveOccurred())
 					grpcStatus, _ := status.FromError(err)
@@ -207,15 +1137,18 @@ var _ = Describe("Node Client", func() {
 			Context("when the volume cannot be unmounted", func() {
 				BeforeEach(func() {
 					fakeOsHelper.IsMountedReturns(true, nil)
+					fakeOsHelper.IsReadOnlyReturns(true, nil)
 					fakeOsHelper.UnmountReturns(errors.New("failed to unmount volume"))
 				})
 
 				It("returns an error", func() {
 					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-						VolumeId:         volumeId,
-						TargetPath:       mountPath,
-						VolumeCapability: volumeCapability,
-						Readonly:         false,
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						VolumeContext:     map[string]string{node.RepairAttribute: "true"},
+						Readonly:          false,
 					})
 					Expect(err).To(HaveOccurred())
 					grpcStatus, _ := status.FromError(err)
@@ -225,6 +1158,74 @@ var _ = Describe("Node Client", func() {
 				})
 			})
 
+			Context("when the mount path is mounted with the opposite read-only mode", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(true, nil)
+					fakeOsHelper.IsReadOnlyReturns(true, nil)
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.AlreadyExists))
+					Expect(grpcStatus.Message()).To(Equal("Volume is already mounted with a different read-only mode"))
+
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when checking if the mount path is read-only fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedReturns(true, nil)
+					fakeOsHelper.IsReadOnlyReturns(false, errors.New("failed to statfs"))
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error checking if volume is mounted read-only"))
+				})
+			})
+
+			Context("When the read-only volume mount fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.MountReadOnlyReturns(errors.New("failed to remount read-only"))
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          true,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error mounting volume"))
+				})
+			})
+
 			Context("When the volume mount fails", func() {
 				BeforeEach(func() {
 					fakeOsHelper.MountReturns(errors.New("failed to mount volume"))
@@ -232,16 +1233,37 @@ var _ = Describe("Node Client", func() {
 
 				It("returns an error", func() {
 					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
-						VolumeId:         volumeId,
-						TargetPath:       mountPath,
-						VolumeCapability: volumeCapability,
-						Readonly:         false,
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+						Readonly:          false,
 					})
 					Expect(err).To(HaveOccurred())
 					grpcStatus, _ := status.FromError(err)
 					Expect(grpcStatus).NotTo(BeNil())
 					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
 					Expect(grpcStatus.Message()).To(Equal("Error mounting volume"))
+					Expect(fakeJournal.RecordCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the publish cannot be recorded", func() {
+				BeforeEach(func() {
+					fakeJournal.RecordReturns(errors.New("disk full"))
+				})
+
+				It("returns an error", func() {
+					_, err = localNode.NodePublishVolume(context, &csi.NodePublishVolumeRequest{
+						VolumeId:          volumeId,
+						StagingTargetPath: stagingPath,
+						TargetPath:        mountPath,
+						VolumeCapability:  volumeCapability,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error recording published volume"))
 				})
 			})
 		})
@@ -269,6 +1291,36 @@ var _ = Describe("Node Client", func() {
 				dstPath = fakeOs.RemoveArgsForCall(0)
 				Expect(dstPath).To(Equal(mountPath))
 			})
+
+			It("removes the publish from the journal", func() {
+				_, err := localNode.NodeUnpublishVolume(context, &csi.NodeUnpublishVolumeRequest{
+					VolumeId:   volumeId,
+					TargetPath: mountPath,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
+				removedId, removedPath := fakeJournal.RemoveArgsForCall(0)
+				Expect(removedId).To(Equal(volumeId))
+				Expect(removedPath).To(Equal(mountPath))
+			})
+
+			Context("when the publish cannot be removed from the journal", func() {
+				BeforeEach(func() {
+					fakeJournal.RemoveReturns(errors.New("disk full"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeUnpublishVolume(context, &csi.NodeUnpublishVolumeRequest{
+						VolumeId:   volumeId,
+						TargetPath: mountPath,
+					})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error removing published volume record"))
+				})
+			})
 		})
 
 		Context("when a volume is not mounted", func() {
@@ -287,6 +1339,7 @@ var _ = Describe("Node Client", func() {
 				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
 
 				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+				Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
 			})
 		})
 
@@ -386,11 +1439,188 @@ var _ = Describe("Node Client", func() {
 	})
 
 	Describe("GetNodeVolumeStats", func() {
+		BeforeEach(func() {
+			fakeOsHelper.StatfsReturns(node.FilesystemStats{
+				TotalBytes:     1000,
+				AvailableBytes: 600,
+				UsedBytes:      400,
+				TotalInodes:    100,
+				FreeInodes:     90,
+				UsedInodes:     10,
+			}, nil)
+			fakeUsage.UsageReturns(node.VolumeUsage{UsedBytes: 42, UsedInodes: 3}, nil)
+			fakeJournal.StagesReturns([]node.StageRecord{{VolumeId: volumeId, StagingPath: stagingPath}}, nil)
+			fakeJournal.RecordsReturns([]node.PublishRecord{{VolumeId: volumeId, TargetPath: mountPath, StagingPath: stagingPath}}, nil)
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if filepath.Ext(path) == ".img" {
+					return nil, os.ErrNotExist
+				}
+				return fileInfo, nil
+			}
+		})
+
 		Context("when GetNodeVolumeStats is called with a GetNodeVolumeStatsRequest", func() {
-			It("should return a GetNodeVolumeStatsResponse", func() {
+			It("should return the usage of the volume directory and the space left for it to grow into", func() {
 				expectedResponse, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: mountPath})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expectedResponse).NotTo(BeNil())
+
+				Expect(fakeOs.StatArgsForCall(0)).To(Equal(mountPath))
+				Expect(fakeOsHelper.StatfsCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.StatfsArgsForCall(0)).To(Equal(mountPath))
+				Expect(fakeUsage.UsageCallCount()).To(Equal(1))
+				_, usagePath := fakeUsage.UsageArgsForCall(0)
+				Expect(usagePath).To(Equal(filepath.Join(volumesRoot, volumeId)))
+
+				usage := expectedResponse.GetUsage()
+				Expect(usage).To(HaveLen(2))
+				Expect(usage[0].GetUnit()).To(Equal(csi.VolumeUsage_BYTES))
+				Expect(usage[0].GetTotal()).To(Equal(int64(642)))
+				Expect(usage[0].GetAvailable()).To(Equal(int64(600)))
+				Expect(usage[0].GetUsed()).To(Equal(int64(42)))
+				Expect(usage[1].GetUnit()).To(Equal(csi.VolumeUsage_INODES))
+				Expect(usage[1].GetTotal()).To(Equal(int64(93)))
+				Expect(usage[1].GetAvailable()).To(Equal(int64(90)))
+				Expect(usage[1].GetUsed()).To(Equal(int64(3)))
+			})
+		})
+
+		Context("when the volume path is not specified", func() {
+			It("should return the usage of the volume directory", func() {
+				_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.StatfsCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.StatfsArgsForCall(0)).To(Equal(filepath.Join(volumesRoot, volumeId)))
+			})
+		})
+
+		Context("when the volume path is not specified for a loopback volume", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(fileInfo, nil)
+			})
+
+			It("should return the stats of the staged filesystem", func() {
+				_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.StatfsCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.StatfsArgsForCall(0)).To(Equal(stagingPath))
+				Expect(fakeUsage.UsageCallCount()).To(Equal(0))
+			})
+
+			Context("and the volume is not staged", func() {
+				BeforeEach(func() {
+					fakeJournal.StagesReturns(nil, nil)
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume path is required for a loopback volume that is not staged"))
+
+					Expect(fakeOsHelper.StatfsCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the volume path is the volume's staging path", func() {
+			It("should return the stats at the staging path", func() {
+				_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: stagingPath + "/"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.StatfsArgsForCall(0)).To(Equal(stagingPath + "/"))
+			})
+		})
+
+		Context("failure cases", func() {
+			Context("when the volume id is missing", func() {
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumePath: mountPath})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume ID is missing in request"))
+				})
+			})
+
+			Context("when the volume path does not exist", func() {
+				BeforeEach(func() {
+					fakeOs.StatReturns(nil, os.ErrNotExist)
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: mountPath})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.NotFound))
+					Expect(grpcStatus.Message()).To(Equal("Volume path not found"))
+
+					Expect(fakeOsHelper.StatfsCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the volume path is not one the volume was staged or published to", func() {
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: "/path/to/mount/_mounts/other-volume-id"})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.NotFound))
+					Expect(grpcStatus.Message()).To(Equal("Volume path not found"))
+
+					Expect(fakeOs.StatCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.StatfsCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the publish journal cannot be read", func() {
+				BeforeEach(func() {
+					fakeJournal.RecordsReturns(nil, errors.New("corrupt journal"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: mountPath})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error checking volume path"))
+				})
+			})
+
+			Context("when getting the filesystem stats fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.StatfsReturns(node.FilesystemStats{}, errors.New("failed to statfs"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: mountPath})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error getting volume stats"))
+				})
+			})
+
+			Context("when computing the volume usage fails", func() {
+				BeforeEach(func() {
+					fakeUsage.UsageReturns(node.VolumeUsage{}, errors.New("failed to walk"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: mountPath})
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus).NotTo(BeNil())
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error getting volume usage"))
+				})
 			})
 		})
 	})
@@ -407,12 +1637,15 @@ var _ = Describe("Node Client", func() {
 
 	Describe("NodeGetCapabilities", func() {
 		Context("when NodeGetCapabilities is called with a NodeGetCapabilitiesRequest", func() {
-			It("should return an empty NodeGetCapabilitiesResponse", func() {
+			It("should advertise the STAGE_UNSTAGE_VOLUME, GET_VOLUME_STATS and EXPAND_VOLUME capabilities", func() {
 				expectedResponse, err := localNode.NodeGetCapabilities(context, &csi.NodeGetCapabilitiesRequest{})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expectedResponse).NotTo(BeNil())
 				capabilities := expectedResponse.GetCapabilities()
-				Expect(capabilities).To(HaveLen(0))
+				Expect(capabilities).To(HaveLen(3))
+				Expect(capabilities[0].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME))
+				Expect(capabilities[1].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS))
+				Expect(capabilities[2].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_EXPAND_VOLUME))
 			})
 		})
 	})
@@ -439,6 +1672,27 @@ var _ = Describe("Node Client", func() {
 			})
 		})
 	})
+
+	Describe("GetPluginCapabilities", func() {
+		It("advertises no services", func() {
+			resp, err := localNode.GetPluginCapabilities(context, &csi.GetPluginCapabilitiesRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetCapabilities()).To(BeEmpty())
+		})
+
+		Context("when the controller service is enabled", func() {
+			BeforeEach(func() {
+				localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, volumesRoot, "some-node-id", node.Options{Usage: fakeUsage, Journal: fakeJournal, ControllerService: true})
+			})
+
+			It("advertises the CONTROLLER_SERVICE capability", func() {
+				resp, err := localNode.GetPluginCapabilities(context, &csi.GetPluginCapabilitiesRequest{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.GetCapabilities()).To(HaveLen(1))
+				Expect(resp.GetCapabilities()[0].GetService().GetType()).To(Equal(csi.PluginCapability_Service_CONTROLLER_SERVICE))
+			})
+		})
+	})
 })
 
 type DummyContext struct{}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	BackendAttribute = "backend"
+
+	DirectoryBackend = "directory"
+	LoopbackBackend  = "loopback"
+
+	imagesDir          = ".images"
+	imagesDirMode      = 0700
+	defaultImageFsType = "ext4"
+)
+
+var supportedImageFsTypes = map[string]bool{
+	"ext4": true,
+	"xfs":  true,
+}
+
+func IsValidBackend(backend string) bool {
+	return backend == DirectoryBackend || backend == LoopbackBackend
+}
+
+// backend returns the backend requested in the volume attributes, falling back
+// to the one the plugin was started with.
+func (ns *LocalNode) backend(logger lager.Logger, volumeContext map[string]string) (string, error) {
+	backend, ok := volumeContext[BackendAttribute]
+	if !ok {
+		return ns.defaultBackend, nil
+	}
+
+	if !IsValidBackend(backend) {
+		logger.Info("unsupported-backend", lager.Data{"backend": backend})
+		errorDescription := fmt.Sprintf("Volume backend %s is not supported", backend)
+		return "", grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return backend, nil
+}
+
+// stageImage mounts the volume's own filesystem image directly at the staging
+// path, creating and formatting the image the first time the volume is staged.
+func (ns *LocalNode) stageImage(logger lager.Logger, volumeId, stagingPath, fsType string, volumeContext map[string]string) error {
+	logger = logger.Session("stage-image")
+
+	capacity, ok := volumeContext[CapacityAttribute]
+	if !ok {
+		errorDescription := "Capacity volume attribute is required for loopback volumes"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	bytes, err := parseCapacity(logger, capacity)
+	if err != nil {
+		return err
+	}
+
+	if fsType == "" {
+		fsType = defaultImageFsType
+	}
+
+	err = ns.createVolumesRootifNotExist(logger, stagingPath)
+	if err != nil {
+		logger.Error("create-staging-path-failed", err)
+		errorDescription := "Error staging volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	err = ns.mountImage(logger, volumeId, stagingPath, bytes, fsType)
+	if err != nil {
+		logger.Error("mount-image-failed", err)
+		errorDescription := "Error staging volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return nil
+}
+
+func (ns *LocalNode) mountImage(logger lager.Logger, volumeId, targetPath string, sizeBytes int64, fsType string) error {
+	mounted, err := ns.osHelper.IsMounted(targetPath)
+	if err != nil {
+		return err
+	}
+
+	if mounted {
+		logger.Info("image-already-mounted", lager.Data{"targetPath": targetPath})
+		return nil
+	}
+
+	imagePath := ns.imagePath(volumeId)
+	exists, err := ns.exists(imagePath)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err = ns.os.MkdirAll(filepath.Dir(imagePath), imagesDirMode)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("create-image", lager.Data{"imagePath": imagePath, "size": sizeBytes, "fsType": fsType})
+		err = ns.osHelper.CreateImage(imagePath, sizeBytes, fsType)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("mount-image", lager.Data{"imagePath": imagePath, "targetPath": targetPath})
+	return ns.osHelper.MountImage(imagePath, targetPath)
+}
+
+func (ns *LocalNode) imagePath(volumeId string) string {
+	return filepath.Join(ns.volumesRootDir, imagesDir, volumeId+".img")
+}
@@ -0,0 +1,200 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Loopback Volumes", func() {
+	var (
+		context        context.Context
+		defaultBackend string
+		fakeFilepath   *filepath_fake.FakeFilepath
+		fakeOs         *os_fake.FakeOs
+		fakeOsHelper   *nodefakes.FakeOsHelper
+		imagePath      string
+		localNode      *node.LocalNode
+		stageRequest   *csi.NodeStageVolumeRequest
+		stagingPath    string
+		volumeId       string
+		volumesRoot    string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		volumeId = "test-volume-id"
+		stagingPath = "/path/to/staging/test-volume-id"
+		imagePath = filepath.Join(volumesRoot, ".images", volumeId+".img")
+		defaultBackend = node.LoopbackBackend
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.StatReturns(nil, os.ErrNotExist)
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+
+		stageRequest = &csi.NodeStageVolumeRequest{
+			VolumeId:          volumeId,
+			StagingTargetPath: stagingPath,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "xfs"}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			},
+			VolumeContext: map[string]string{node.CapacityAttribute: "1073741824"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("loopback"), volumesRoot, "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, DefaultBackend: defaultBackend, Journal: &nodefakes.FakePublishJournal{}})
+	})
+
+	Describe("NodeStageVolume", func() {
+		It("creates an image formatted with the requested filesystem and mounts it at the staging path", func() {
+			_, err := localNode.NodeStageVolume(context, stageRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOs.MkdirAllCallCount()).To(Equal(2))
+			path, _ := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(stagingPath))
+			path, _ = fakeOs.MkdirAllArgsForCall(1)
+			Expect(path).To(Equal(filepath.Dir(imagePath)))
+
+			Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(1))
+			path, size, fsType := fakeOsHelper.CreateImageArgsForCall(0)
+			Expect(path).To(Equal(imagePath))
+			Expect(size).To(Equal(int64(1073741824)))
+			Expect(fsType).To(Equal("xfs"))
+
+			Expect(fakeOsHelper.MountImageCallCount()).To(Equal(1))
+			from, to := fakeOsHelper.MountImageArgsForCall(0)
+			Expect(from).To(Equal(imagePath))
+			Expect(to).To(Equal(stagingPath))
+
+			Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+		})
+
+		Context("when no filesystem type is requested", func() {
+			BeforeEach(func() {
+				stageRequest.VolumeCapability.GetMount().FsType = ""
+			})
+
+			It("formats the image as ext4", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, fsType := fakeOsHelper.CreateImageArgsForCall(0)
+				Expect(fsType).To(Equal("ext4"))
+			})
+		})
+
+		Context("when the image already exists", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(newFakeFileInfo(), nil)
+			})
+
+			It("mounts the existing image without formatting it", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountImageCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the plugin defaults to directory volumes", func() {
+			BeforeEach(func() {
+				defaultBackend = node.DirectoryBackend
+			})
+
+			It("uses the backend requested in the volume attributes", func() {
+				stageRequest.VolumeContext[node.BackendAttribute] = node.LoopbackBackend
+
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.MountImageCallCount()).To(Equal(1))
+			})
+
+			It("rejects a filesystem type for directory volumes", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+				Expect(grpcStatus.Message()).To(Equal("Volume filesystem type xfs is not supported"))
+			})
+		})
+
+		Context("failure cases", func() {
+			Context("when the backend attribute is not supported", func() {
+				BeforeEach(func() {
+					stageRequest.VolumeContext[node.BackendAttribute] = "ceph"
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume backend ceph is not supported"))
+				})
+			})
+
+			Context("when the filesystem type is not supported", func() {
+				BeforeEach(func() {
+					stageRequest.VolumeCapability.GetMount().FsType = "btrfs"
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Volume filesystem type btrfs is not supported"))
+				})
+			})
+
+			Context("when the capacity attribute is missing", func() {
+				BeforeEach(func() {
+					delete(stageRequest.VolumeContext, node.CapacityAttribute)
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+					Expect(grpcStatus.Message()).To(Equal("Capacity volume attribute is required for loopback volumes"))
+				})
+			})
+
+			Context("when mounting the image fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.MountImageReturns(errors.New("no free loop devices"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error staging volume"))
+				})
+			})
+		})
+	})
+})
@@ -8,22 +8,12 @@ import (
 )
 
 type FakeOsHelper struct {
-	UmaskStub        func(mask int) (oldmask int)
-	umaskMutex       sync.RWMutex
-	umaskArgsForCall []struct {
-		mask int
-	}
-	umaskReturns struct {
-		result1 int
-	}
-	umaskReturnsOnCall map[int]struct {
-		result1 int
-	}
-	MountStub        func(srcPath string, targetPath string) error
+	MountStub        func(srcPath string, targetPath string, options []string) error
 	mountMutex       sync.RWMutex
 	mountArgsForCall []struct {
 		srcPath    string
 		targetPath string
+		options    []string
 	}
 	mountReturns struct {
 		result1 error
@@ -31,6 +21,19 @@ type FakeOsHelper struct {
 	mountReturnsOnCall map[int]struct {
 		result1 error
 	}
+	MountReadOnlyStub        func(srcPath string, targetPath string, options []string) error
+	mountReadOnlyMutex       sync.RWMutex
+	mountReadOnlyArgsForCall []struct {
+		srcPath    string
+		targetPath string
+		options    []string
+	}
+	mountReadOnlyReturns struct {
+		result1 error
+	}
+	mountReadOnlyReturnsOnCall map[int]struct {
+		result1 error
+	}
 	IsMountedStub        func(targetPath string) (bool, error)
 	isMountedMutex       sync.RWMutex
 	isMountedArgsForCall []struct {
@@ -44,6 +47,19 @@ type FakeOsHelper struct {
 		result1 bool
 		result2 error
 	}
+	IsReadOnlyStub        func(targetPath string) (bool, error)
+	isReadOnlyMutex       sync.RWMutex
+	isReadOnlyArgsForCall []struct {
+		targetPath string
+	}
+	isReadOnlyReturns struct {
+		result1 bool
+		result2 error
+	}
+	isReadOnlyReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
 	UnmountStub        func(targetPath string) error
 	unmountMutex       sync.RWMutex
 	unmountArgsForCall []struct {
@@ -55,69 +71,232 @@ type FakeOsHelper struct {
 	unmountReturnsOnCall map[int]struct {
 		result1 error
 	}
-	invocations      map[string][][]interface{}
-	invocationsMutex sync.RWMutex
-}
-
-func (fake *FakeOsHelper) Umask(mask int) (oldmask int) {
-	fake.umaskMutex.Lock()
-	ret, specificReturn := fake.umaskReturnsOnCall[len(fake.umaskArgsForCall)]
-	fake.umaskArgsForCall = append(fake.umaskArgsForCall, struct {
-		mask int
-	}{mask})
-	fake.recordInvocation("Umask", []interface{}{mask})
-	fake.umaskMutex.Unlock()
-	if fake.UmaskStub != nil {
-		return fake.UmaskStub(mask)
+	StatfsStub        func(path string) (node.FilesystemStats, error)
+	statfsMutex       sync.RWMutex
+	statfsArgsForCall []struct {
+		path string
 	}
-	if specificReturn {
-		return ret.result1
+	statfsReturns struct {
+		result1 node.FilesystemStats
+		result2 error
 	}
-	return fake.umaskReturns.result1
-}
-
-func (fake *FakeOsHelper) UmaskCallCount() int {
-	fake.umaskMutex.RLock()
-	defer fake.umaskMutex.RUnlock()
-	return len(fake.umaskArgsForCall)
-}
-
-func (fake *FakeOsHelper) UmaskArgsForCall(i int) int {
-	fake.umaskMutex.RLock()
-	defer fake.umaskMutex.RUnlock()
-	return fake.umaskArgsForCall[i].mask
-}
-
-func (fake *FakeOsHelper) UmaskReturns(result1 int) {
-	fake.UmaskStub = nil
-	fake.umaskReturns = struct {
-		result1 int
-	}{result1}
-}
-
-func (fake *FakeOsHelper) UmaskReturnsOnCall(i int, result1 int) {
-	fake.UmaskStub = nil
-	if fake.umaskReturnsOnCall == nil {
-		fake.umaskReturnsOnCall = make(map[int]struct {
-			result1 int
-		})
+	statfsReturnsOnCall map[int]struct {
+		result1 node.FilesystemStats
+		result2 error
 	}
-	fake.umaskReturnsOnCall[i] = struct {
-		result1 int
-	}{result1}
+	SupportsProjectQuotaStub        func(path string) (bool, error)
+	supportsProjectQuotaMutex       sync.RWMutex
+	supportsProjectQuotaArgsForCall []struct {
+		path string
+	}
+	supportsProjectQuotaReturns struct {
+		result1 bool
+		result2 error
+	}
+	supportsProjectQuotaReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	GetProjectIdStub        func(path string) (uint32, error)
+	getProjectIdMutex       sync.RWMutex
+	getProjectIdArgsForCall []struct {
+		path string
+	}
+	getProjectIdReturns struct {
+		result1 uint32
+		result2 error
+	}
+	getProjectIdReturnsOnCall map[int]struct {
+		result1 uint32
+		result2 error
+	}
+	SetProjectQuotaStub        func(path string, projectId uint32, limits node.QuotaLimits) error
+	setProjectQuotaMutex       sync.RWMutex
+	setProjectQuotaArgsForCall []struct {
+		path      string
+		projectId uint32
+		limits    node.QuotaLimits
+	}
+	setProjectQuotaReturns struct {
+		result1 error
+	}
+	setProjectQuotaReturnsOnCall map[int]struct {
+		result1 error
+	}
+	GetProjectQuotaStub        func(path string, projectId uint32) (node.QuotaStats, error)
+	getProjectQuotaMutex       sync.RWMutex
+	getProjectQuotaArgsForCall []struct {
+		path      string
+		projectId uint32
+	}
+	getProjectQuotaReturns struct {
+		result1 node.QuotaStats
+		result2 error
+	}
+	getProjectQuotaReturnsOnCall map[int]struct {
+		result1 node.QuotaStats
+		result2 error
+	}
+	CreateImageStub        func(imagePath string, sizeBytes int64, fsType string) error
+	createImageMutex       sync.RWMutex
+	createImageArgsForCall []struct {
+		imagePath string
+		sizeBytes int64
+		fsType    string
+	}
+	createImageReturns struct {
+		result1 error
+	}
+	createImageReturnsOnCall map[int]struct {
+		result1 error
+	}
+	MountImageStub        func(imagePath string, targetPath string) error
+	mountImageMutex       sync.RWMutex
+	mountImageArgsForCall []struct {
+		imagePath  string
+		targetPath string
+	}
+	mountImageReturns struct {
+		result1 error
+	}
+	mountImageReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AttachLoopDeviceStub        func(imagePath string) (string, error)
+	attachLoopDeviceMutex       sync.RWMutex
+	attachLoopDeviceArgsForCall []struct {
+		imagePath string
+	}
+	attachLoopDeviceReturns struct {
+		result1 string
+		result2 error
+	}
+	attachLoopDeviceReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	FindLoopDeviceStub        func(imagePath string) (string, error)
+	findLoopDeviceMutex       sync.RWMutex
+	findLoopDeviceArgsForCall []struct {
+		imagePath string
+	}
+	findLoopDeviceReturns struct {
+		result1 string
+		result2 error
+	}
+	findLoopDeviceReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	DetachLoopDeviceStub        func(devicePath string) error
+	detachLoopDeviceMutex       sync.RWMutex
+	detachLoopDeviceArgsForCall []struct {
+		devicePath string
+	}
+	detachLoopDeviceReturns struct {
+		result1 error
+	}
+	detachLoopDeviceReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ResizeImageStub        func(imagePath string, sizeBytes int64) error
+	resizeImageMutex       sync.RWMutex
+	resizeImageArgsForCall []struct {
+		imagePath string
+		sizeBytes int64
+	}
+	resizeImageReturns struct {
+		result1 error
+	}
+	resizeImageReturnsOnCall map[int]struct {
+		result1 error
+	}
+	GrowFilesystemStub        func(devicePath string, mountPath string) error
+	growFilesystemMutex       sync.RWMutex
+	growFilesystemArgsForCall []struct {
+		devicePath string
+		mountPath  string
+	}
+	growFilesystemReturns struct {
+		result1 error
+	}
+	growFilesystemReturnsOnCall map[int]struct {
+		result1 error
+	}
+	GetMountInfoStub        func(targetPath string) (node.MountInfo, bool, error)
+	getMountInfoMutex       sync.RWMutex
+	getMountInfoArgsForCall []struct {
+		targetPath string
+	}
+	getMountInfoReturns struct {
+		result1 node.MountInfo
+		result2 bool
+		result3 error
+	}
+	getMountInfoReturnsOnCall map[int]struct {
+		result1 node.MountInfo
+		result2 bool
+		result3 error
+	}
+	ListMountsStub        func() ([]node.MountInfo, error)
+	listMountsMutex       sync.RWMutex
+	listMountsArgsForCall []struct {
+	}
+	listMountsReturns struct {
+		result1 []node.MountInfo
+		result2 error
+	}
+	listMountsReturnsOnCall map[int]struct {
+		result1 []node.MountInfo
+		result2 error
+	}
+	CloneFileStub        func(srcPath string, dstPath string, options node.CopyOptions) error
+	cloneFileMutex       sync.RWMutex
+	cloneFileArgsForCall []struct {
+		srcPath string
+		dstPath string
+		options node.CopyOptions
+	}
+	cloneFileReturns struct {
+		result1 error
+	}
+	cloneFileReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CloneTreeStub        func(srcPath string, dstPath string, options node.CopyOptions) error
+	cloneTreeMutex       sync.RWMutex
+	cloneTreeArgsForCall []struct {
+		srcPath string
+		dstPath string
+		options node.CopyOptions
+	}
+	cloneTreeReturns struct {
+		result1 error
+	}
+	cloneTreeReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeOsHelper) Mount(srcPath string, targetPath string) error {
+func (fake *FakeOsHelper) Mount(srcPath string, targetPath string, options []string) error {
+	var optionsCopy []string
+	if options != nil {
+		optionsCopy = make([]string, len(options))
+		copy(optionsCopy, options)
+	}
 	fake.mountMutex.Lock()
 	ret, specificReturn := fake.mountReturnsOnCall[len(fake.mountArgsForCall)]
 	fake.mountArgsForCall = append(fake.mountArgsForCall, struct {
 		srcPath    string
 		targetPath string
-	}{srcPath, targetPath})
-	fake.recordInvocation("Mount", []interface{}{srcPath, targetPath})
+		options    []string
+	}{srcPath, targetPath, optionsCopy})
+	fake.recordInvocation("Mount", []interface{}{srcPath, targetPath, optionsCopy})
 	fake.mountMutex.Unlock()
 	if fake.MountStub != nil {
-		return fake.MountStub(srcPath, targetPath)
+		return fake.MountStub(srcPath, targetPath, options)
 	}
 	if specificReturn {
 		return ret.result1
@@ -131,10 +310,10 @@ func (fake *FakeOsHelper) MountCallCount() int {
 	return len(fake.mountArgsForCall)
 }
 
-func (fake *FakeOsHelper) MountArgsForCall(i int) (string, string) {
+func (fake *FakeOsHelper) MountArgsForCall(i int) (string, string, []string) {
 	fake.mountMutex.RLock()
 	defer fake.mountMutex.RUnlock()
-	return fake.mountArgsForCall[i].srcPath, fake.mountArgsForCall[i].targetPath
+	return fake.mountArgsForCall[i].srcPath, fake.mountArgsForCall[i].targetPath, fake.mountArgsForCall[i].options
 }
 
 func (fake *FakeOsHelper) MountReturns(result1 error) {
@@ -156,6 +335,61 @@ func (fake *FakeOsHelper) MountReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeOsHelper) MountReadOnly(srcPath string, targetPath string, options []string) error {
+	var optionsCopy []string
+	if options != nil {
+		optionsCopy = make([]string, len(options))
+		copy(optionsCopy, options)
+	}
+	fake.mountReadOnlyMutex.Lock()
+	ret, specificReturn := fake.mountReadOnlyReturnsOnCall[len(fake.mountReadOnlyArgsForCall)]
+	fake.mountReadOnlyArgsForCall = append(fake.mountReadOnlyArgsForCall, struct {
+		srcPath    string
+		targetPath string
+		options    []string
+	}{srcPath, targetPath, optionsCopy})
+	fake.recordInvocation("MountReadOnly", []interface{}{srcPath, targetPath, optionsCopy})
+	fake.mountReadOnlyMutex.Unlock()
+	if fake.MountReadOnlyStub != nil {
+		return fake.MountReadOnlyStub(srcPath, targetPath, options)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.mountReadOnlyReturns.result1
+}
+
+func (fake *FakeOsHelper) MountReadOnlyCallCount() int {
+	fake.mountReadOnlyMutex.RLock()
+	defer fake.mountReadOnlyMutex.RUnlock()
+	return len(fake.mountReadOnlyArgsForCall)
+}
+
+func (fake *FakeOsHelper) MountReadOnlyArgsForCall(i int) (string, string, []string) {
+	fake.mountReadOnlyMutex.RLock()
+	defer fake.mountReadOnlyMutex.RUnlock()
+	return fake.mountReadOnlyArgsForCall[i].srcPath, fake.mountReadOnlyArgsForCall[i].targetPath, fake.mountReadOnlyArgsForCall[i].options
+}
+
+func (fake *FakeOsHelper) MountReadOnlyReturns(result1 error) {
+	fake.MountReadOnlyStub = nil
+	fake.mountReadOnlyReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) MountReadOnlyReturnsOnCall(i int, result1 error) {
+	fake.MountReadOnlyStub = nil
+	if fake.mountReadOnlyReturnsOnCall == nil {
+		fake.mountReadOnlyReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.mountReadOnlyReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeOsHelper) IsMounted(targetPath string) (bool, error) {
 	fake.isMountedMutex.Lock()
 	ret, specificReturn := fake.isMountedReturnsOnCall[len(fake.isMountedArgsForCall)]
@@ -207,6 +441,57 @@ func (fake *FakeOsHelper) IsMountedReturnsOnCall(i int, result1 bool, result2 er
 	}{result1, result2}
 }
 
+func (fake *FakeOsHelper) IsReadOnly(targetPath string) (bool, error) {
+	fake.isReadOnlyMutex.Lock()
+	ret, specificReturn := fake.isReadOnlyReturnsOnCall[len(fake.isReadOnlyArgsForCall)]
+	fake.isReadOnlyArgsForCall = append(fake.isReadOnlyArgsForCall, struct {
+		targetPath string
+	}{targetPath})
+	fake.recordInvocation("IsReadOnly", []interface{}{targetPath})
+	fake.isReadOnlyMutex.Unlock()
+	if fake.IsReadOnlyStub != nil {
+		return fake.IsReadOnlyStub(targetPath)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.isReadOnlyReturns.result1, fake.isReadOnlyReturns.result2
+}
+
+func (fake *FakeOsHelper) IsReadOnlyCallCount() int {
+	fake.isReadOnlyMutex.RLock()
+	defer fake.isReadOnlyMutex.RUnlock()
+	return len(fake.isReadOnlyArgsForCall)
+}
+
+func (fake *FakeOsHelper) IsReadOnlyArgsForCall(i int) string {
+	fake.isReadOnlyMutex.RLock()
+	defer fake.isReadOnlyMutex.RUnlock()
+	return fake.isReadOnlyArgsForCall[i].targetPath
+}
+
+func (fake *FakeOsHelper) IsReadOnlyReturns(result1 bool, result2 error) {
+	fake.IsReadOnlyStub = nil
+	fake.isReadOnlyReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) IsReadOnlyReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.IsReadOnlyStub = nil
+	if fake.isReadOnlyReturnsOnCall == nil {
+		fake.isReadOnlyReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.isReadOnlyReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeOsHelper) Unmount(targetPath string) error {
 	fake.unmountMutex.Lock()
 	ret, specificReturn := fake.unmountReturnsOnCall[len(fake.unmountArgsForCall)]
@@ -255,17 +540,851 @@ func (fake *FakeOsHelper) UnmountReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeOsHelper) Statfs(path string) (node.FilesystemStats, error) {
+	fake.statfsMutex.Lock()
+	ret, specificReturn := fake.statfsReturnsOnCall[len(fake.statfsArgsForCall)]
+	fake.statfsArgsForCall = append(fake.statfsArgsForCall, struct {
+		path string
+	}{path})
+	fake.recordInvocation("Statfs", []interface{}{path})
+	fake.statfsMutex.Unlock()
+	if fake.StatfsStub != nil {
+		return fake.StatfsStub(path)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.statfsReturns.result1, fake.statfsReturns.result2
+}
+
+func (fake *FakeOsHelper) StatfsCallCount() int {
+	fake.statfsMutex.RLock()
+	defer fake.statfsMutex.RUnlock()
+	return len(fake.statfsArgsForCall)
+}
+
+func (fake *FakeOsHelper) StatfsArgsForCall(i int) string {
+	fake.statfsMutex.RLock()
+	defer fake.statfsMutex.RUnlock()
+	return fake.statfsArgsForCall[i].path
+}
+
+func (fake *FakeOsHelper) StatfsReturns(result1 node.FilesystemStats, result2 error) {
+	fake.StatfsStub = nil
+	fake.statfsReturns = struct {
+		result1 node.FilesystemStats
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) StatfsReturnsOnCall(i int, result1 node.FilesystemStats, result2 error) {
+	fake.StatfsStub = nil
+	if fake.statfsReturnsOnCall == nil {
+		fake.statfsReturnsOnCall = make(map[int]struct {
+			result1 node.FilesystemStats
+			result2 error
+		})
+	}
+	fake.statfsReturnsOnCall[i] = struct {
+		result1 node.FilesystemStats
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) SupportsProjectQuota(path string) (bool, error) {
+	fake.supportsProjectQuotaMutex.Lock()
+	ret, specificReturn := fake.supportsProjectQuotaReturnsOnCall[len(fake.supportsProjectQuotaArgsForCall)]
+	fake.supportsProjectQuotaArgsForCall = append(fake.supportsProjectQuotaArgsForCall, struct {
+		path string
+	}{path})
+	fake.recordInvocation("SupportsProjectQuota", []interface{}{path})
+	fake.supportsProjectQuotaMutex.Unlock()
+	if fake.SupportsProjectQuotaStub != nil {
+		return fake.SupportsProjectQuotaStub(path)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.supportsProjectQuotaReturns.result1, fake.supportsProjectQuotaReturns.result2
+}
+
+func (fake *FakeOsHelper) SupportsProjectQuotaCallCount() int {
+	fake.supportsProjectQuotaMutex.RLock()
+	defer fake.supportsProjectQuotaMutex.RUnlock()
+	return len(fake.supportsProjectQuotaArgsForCall)
+}
+
+func (fake *FakeOsHelper) SupportsProjectQuotaArgsForCall(i int) string {
+	fake.supportsProjectQuotaMutex.RLock()
+	defer fake.supportsProjectQuotaMutex.RUnlock()
+	return fake.supportsProjectQuotaArgsForCall[i].path
+}
+
+func (fake *FakeOsHelper) SupportsProjectQuotaReturns(result1 bool, result2 error) {
+	fake.SupportsProjectQuotaStub = nil
+	fake.supportsProjectQuotaReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) SupportsProjectQuotaReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.SupportsProjectQuotaStub = nil
+	if fake.supportsProjectQuotaReturnsOnCall == nil {
+		fake.supportsProjectQuotaReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.supportsProjectQuotaReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) GetProjectId(path string) (uint32, error) {
+	fake.getProjectIdMutex.Lock()
+	ret, specificReturn := fake.getProjectIdReturnsOnCall[len(fake.getProjectIdArgsForCall)]
+	fake.getProjectIdArgsForCall = append(fake.getProjectIdArgsForCall, struct {
+		path string
+	}{path})
+	fake.recordInvocation("GetProjectId", []interface{}{path})
+	fake.getProjectIdMutex.Unlock()
+	if fake.GetProjectIdStub != nil {
+		return fake.GetProjectIdStub(path)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getProjectIdReturns.result1, fake.getProjectIdReturns.result2
+}
+
+func (fake *FakeOsHelper) GetProjectIdCallCount() int {
+	fake.getProjectIdMutex.RLock()
+	defer fake.getProjectIdMutex.RUnlock()
+	return len(fake.getProjectIdArgsForCall)
+}
+
+func (fake *FakeOsHelper) GetProjectIdArgsForCall(i int) string {
+	fake.getProjectIdMutex.RLock()
+	defer fake.getProjectIdMutex.RUnlock()
+	return fake.getProjectIdArgsForCall[i].path
+}
+
+func (fake *FakeOsHelper) GetProjectIdReturns(result1 uint32, result2 error) {
+	fake.GetProjectIdStub = nil
+	fake.getProjectIdReturns = struct {
+		result1 uint32
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) GetProjectIdReturnsOnCall(i int, result1 uint32, result2 error) {
+	fake.GetProjectIdStub = nil
+	if fake.getProjectIdReturnsOnCall == nil {
+		fake.getProjectIdReturnsOnCall = make(map[int]struct {
+			result1 uint32
+			result2 error
+		})
+	}
+	fake.getProjectIdReturnsOnCall[i] = struct {
+		result1 uint32
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) SetProjectQuota(path string, projectId uint32, limits node.QuotaLimits) error {
+	fake.setProjectQuotaMutex.Lock()
+	ret, specificReturn := fake.setProjectQuotaReturnsOnCall[len(fake.setProjectQuotaArgsForCall)]
+	fake.setProjectQuotaArgsForCall = append(fake.setProjectQuotaArgsForCall, struct {
+		path      string
+		projectId uint32
+		limits    node.QuotaLimits
+	}{path, projectId, limits})
+	fake.recordInvocation("SetProjectQuota", []interface{}{path, projectId, limits})
+	fake.setProjectQuotaMutex.Unlock()
+	if fake.SetProjectQuotaStub != nil {
+		return fake.SetProjectQuotaStub(path, projectId, limits)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.setProjectQuotaReturns.result1
+}
+
+func (fake *FakeOsHelper) SetProjectQuotaCallCount() int {
+	fake.setProjectQuotaMutex.RLock()
+	defer fake.setProjectQuotaMutex.RUnlock()
+	return len(fake.setProjectQuotaArgsForCall)
+}
+
+func (fake *FakeOsHelper) SetProjectQuotaArgsForCall(i int) (string, uint32, node.QuotaLimits) {
+	fake.setProjectQuotaMutex.RLock()
+	defer fake.setProjectQuotaMutex.RUnlock()
+	return fake.setProjectQuotaArgsForCall[i].path, fake.setProjectQuotaArgsForCall[i].projectId, fake.setProjectQuotaArgsForCall[i].limits
+}
+
+func (fake *FakeOsHelper) SetProjectQuotaReturns(result1 error) {
+	fake.SetProjectQuotaStub = nil
+	fake.setProjectQuotaReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) SetProjectQuotaReturnsOnCall(i int, result1 error) {
+	fake.SetProjectQuotaStub = nil
+	if fake.setProjectQuotaReturnsOnCall == nil {
+		fake.setProjectQuotaReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setProjectQuotaReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) GetProjectQuota(path string, projectId uint32) (node.QuotaStats, error) {
+	fake.getProjectQuotaMutex.Lock()
+	ret, specificReturn := fake.getProjectQuotaReturnsOnCall[len(fake.getProjectQuotaArgsForCall)]
+	fake.getProjectQuotaArgsForCall = append(fake.getProjectQuotaArgsForCall, struct {
+		path      string
+		projectId uint32
+	}{path, projectId})
+	fake.recordInvocation("GetProjectQuota", []interface{}{path, projectId})
+	fake.getProjectQuotaMutex.Unlock()
+	if fake.GetProjectQuotaStub != nil {
+		return fake.GetProjectQuotaStub(path, projectId)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getProjectQuotaReturns.result1, fake.getProjectQuotaReturns.result2
+}
+
+func (fake *FakeOsHelper) GetProjectQuotaCallCount() int {
+	fake.getProjectQuotaMutex.RLock()
+	defer fake.getProjectQuotaMutex.RUnlock()
+	return len(fake.getProjectQuotaArgsForCall)
+}
+
+func (fake *FakeOsHelper) GetProjectQuotaArgsForCall(i int) (string, uint32) {
+	fake.getProjectQuotaMutex.RLock()
+	defer fake.getProjectQuotaMutex.RUnlock()
+	return fake.getProjectQuotaArgsForCall[i].path, fake.getProjectQuotaArgsForCall[i].projectId
+}
+
+func (fake *FakeOsHelper) GetProjectQuotaReturns(result1 node.QuotaStats, result2 error) {
+	fake.GetProjectQuotaStub = nil
+	fake.getProjectQuotaReturns = struct {
+		result1 node.QuotaStats
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) GetProjectQuotaReturnsOnCall(i int, result1 node.QuotaStats, result2 error) {
+	fake.GetProjectQuotaStub = nil
+	if fake.getProjectQuotaReturnsOnCall == nil {
+		fake.getProjectQuotaReturnsOnCall = make(map[int]struct {
+			result1 node.QuotaStats
+			result2 error
+		})
+	}
+	fake.getProjectQuotaReturnsOnCall[i] = struct {
+		result1 node.QuotaStats
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) CreateImage(imagePath string, sizeBytes int64, fsType string) error {
+	fake.createImageMutex.Lock()
+	ret, specificReturn := fake.createImageReturnsOnCall[len(fake.createImageArgsForCall)]
+	fake.createImageArgsForCall = append(fake.createImageArgsForCall, struct {
+		imagePath string
+		sizeBytes int64
+		fsType    string
+	}{imagePath, sizeBytes, fsType})
+	fake.recordInvocation("CreateImage", []interface{}{imagePath, sizeBytes, fsType})
+	fake.createImageMutex.Unlock()
+	if fake.CreateImageStub != nil {
+		return fake.CreateImageStub(imagePath, sizeBytes, fsType)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.createImageReturns.result1
+}
+
+func (fake *FakeOsHelper) CreateImageCallCount() int {
+	fake.createImageMutex.RLock()
+	defer fake.createImageMutex.RUnlock()
+	return len(fake.createImageArgsForCall)
+}
+
+func (fake *FakeOsHelper) CreateImageArgsForCall(i int) (string, int64, string) {
+	fake.createImageMutex.RLock()
+	defer fake.createImageMutex.RUnlock()
+	return fake.createImageArgsForCall[i].imagePath, fake.createImageArgsForCall[i].sizeBytes, fake.createImageArgsForCall[i].fsType
+}
+
+func (fake *FakeOsHelper) CreateImageReturns(result1 error) {
+	fake.CreateImageStub = nil
+	fake.createImageReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) CreateImageReturnsOnCall(i int, result1 error) {
+	fake.CreateImageStub = nil
+	if fake.createImageReturnsOnCall == nil {
+		fake.createImageReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.createImageReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) MountImage(imagePath string, targetPath string) error {
+	fake.mountImageMutex.Lock()
+	ret, specificReturn := fake.mountImageReturnsOnCall[len(fake.mountImageArgsForCall)]
+	fake.mountImageArgsForCall = append(fake.mountImageArgsForCall, struct {
+		imagePath  string
+		targetPath string
+	}{imagePath, targetPath})
+	fake.recordInvocation("MountImage", []interface{}{imagePath, targetPath})
+	fake.mountImageMutex.Unlock()
+	if fake.MountImageStub != nil {
+		return fake.MountImageStub(imagePath, targetPath)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.mountImageReturns.result1
+}
+
+func (fake *FakeOsHelper) MountImageCallCount() int {
+	fake.mountImageMutex.RLock()
+	defer fake.mountImageMutex.RUnlock()
+	return len(fake.mountImageArgsForCall)
+}
+
+func (fake *FakeOsHelper) MountImageArgsForCall(i int) (string, string) {
+	fake.mountImageMutex.RLock()
+	defer fake.mountImageMutex.RUnlock()
+	return fake.mountImageArgsForCall[i].imagePath, fake.mountImageArgsForCall[i].targetPath
+}
+
+func (fake *FakeOsHelper) MountImageReturns(result1 error) {
+	fake.MountImageStub = nil
+	fake.mountImageReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) MountImageReturnsOnCall(i int, result1 error) {
+	fake.MountImageStub = nil
+	if fake.mountImageReturnsOnCall == nil {
+		fake.mountImageReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.mountImageReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) AttachLoopDevice(imagePath string) (string, error) {
+	fake.attachLoopDeviceMutex.Lock()
+	ret, specificReturn := fake.attachLoopDeviceReturnsOnCall[len(fake.attachLoopDeviceArgsForCall)]
+	fake.attachLoopDeviceArgsForCall = append(fake.attachLoopDeviceArgsForCall, struct {
+		imagePath string
+	}{imagePath})
+	fake.recordInvocation("AttachLoopDevice", []interface{}{imagePath})
+	fake.attachLoopDeviceMutex.Unlock()
+	if fake.AttachLoopDeviceStub != nil {
+		return fake.AttachLoopDeviceStub(imagePath)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.attachLoopDeviceReturns.result1, fake.attachLoopDeviceReturns.result2
+}
+
+func (fake *FakeOsHelper) AttachLoopDeviceCallCount() int {
+	fake.attachLoopDeviceMutex.RLock()
+	defer fake.attachLoopDeviceMutex.RUnlock()
+	return len(fake.attachLoopDeviceArgsForCall)
+}
+
+func (fake *FakeOsHelper) AttachLoopDeviceArgsForCall(i int) string {
+	fake.attachLoopDeviceMutex.RLock()
+	defer fake.attachLoopDeviceMutex.RUnlock()
+	return fake.attachLoopDeviceArgsForCall[i].imagePath
+}
+
+func (fake *FakeOsHelper) AttachLoopDeviceReturns(result1 string, result2 error) {
+	fake.AttachLoopDeviceStub = nil
+	fake.attachLoopDeviceReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) AttachLoopDeviceReturnsOnCall(i int, result1 string, result2 error) {
+	fake.AttachLoopDeviceStub = nil
+	if fake.attachLoopDeviceReturnsOnCall == nil {
+		fake.attachLoopDeviceReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.attachLoopDeviceReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) FindLoopDevice(imagePath string) (string, error) {
+	fake.findLoopDeviceMutex.Lock()
+	ret, specificReturn := fake.findLoopDeviceReturnsOnCall[len(fake.findLoopDeviceArgsForCall)]
+	fake.findLoopDeviceArgsForCall = append(fake.findLoopDeviceArgsForCall, struct {
+		imagePath string
+	}{imagePath})
+	fake.recordInvocation("FindLoopDevice", []interface{}{imagePath})
+	fake.findLoopDeviceMutex.Unlock()
+	if fake.FindLoopDeviceStub != nil {
+		return fake.FindLoopDeviceStub(imagePath)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.findLoopDeviceReturns.result1, fake.findLoopDeviceReturns.result2
+}
+
+func (fake *FakeOsHelper) FindLoopDeviceCallCount() int {
+	fake.findLoopDeviceMutex.RLock()
+	defer fake.findLoopDeviceMutex.RUnlock()
+	return len(fake.findLoopDeviceArgsForCall)
+}
+
+func (fake *FakeOsHelper) FindLoopDeviceArgsForCall(i int) string {
+	fake.findLoopDeviceMutex.RLock()
+	defer fake.findLoopDeviceMutex.RUnlock()
+	return fake.findLoopDeviceArgsForCall[i].imagePath
+}
+
+func (fake *FakeOsHelper) FindLoopDeviceReturns(result1 string, result2 error) {
+	fake.FindLoopDeviceStub = nil
+	fake.findLoopDeviceReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) FindLoopDeviceReturnsOnCall(i int, result1 string, result2 error) {
+	fake.FindLoopDeviceStub = nil
+	if fake.findLoopDeviceReturnsOnCall == nil {
+		fake.findLoopDeviceReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.findLoopDeviceReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) DetachLoopDevice(devicePath string) error {
+	fake.detachLoopDeviceMutex.Lock()
+	ret, specificReturn := fake.detachLoopDeviceReturnsOnCall[len(fake.detachLoopDeviceArgsForCall)]
+	fake.detachLoopDeviceArgsForCall = append(fake.detachLoopDeviceArgsForCall, struct {
+		devicePath string
+	}{devicePath})
+	fake.recordInvocation("DetachLoopDevice", []interface{}{devicePath})
+	fake.detachLoopDeviceMutex.Unlock()
+	if fake.DetachLoopDeviceStub != nil {
+		return fake.DetachLoopDeviceStub(devicePath)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.detachLoopDeviceReturns.result1
+}
+
+func (fake *FakeOsHelper) DetachLoopDeviceCallCount() int {
+	fake.detachLoopDeviceMutex.RLock()
+	defer fake.detachLoopDeviceMutex.RUnlock()
+	return len(fake.detachLoopDeviceArgsForCall)
+}
+
+func (fake *FakeOsHelper) DetachLoopDeviceArgsForCall(i int) string {
+	fake.detachLoopDeviceMutex.RLock()
+	defer fake.detachLoopDeviceMutex.RUnlock()
+	return fake.detachLoopDeviceArgsForCall[i].devicePath
+}
+
+func (fake *FakeOsHelper) DetachLoopDeviceReturns(result1 error) {
+	fake.DetachLoopDeviceStub = nil
+	fake.detachLoopDeviceReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) DetachLoopDeviceReturnsOnCall(i int, result1 error) {
+	fake.DetachLoopDeviceStub = nil
+	if fake.detachLoopDeviceReturnsOnCall == nil {
+		fake.detachLoopDeviceReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.detachLoopDeviceReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) ResizeImage(imagePath string, sizeBytes int64) error {
+	fake.resizeImageMutex.Lock()
+	ret, specificReturn := fake.resizeImageReturnsOnCall[len(fake.resizeImageArgsForCall)]
+	fake.resizeImageArgsForCall = append(fake.resizeImageArgsForCall, struct {
+		imagePath string
+		sizeBytes int64
+	}{imagePath, sizeBytes})
+	fake.recordInvocation("ResizeImage", []interface{}{imagePath, sizeBytes})
+	fake.resizeImageMutex.Unlock()
+	if fake.ResizeImageStub != nil {
+		return fake.ResizeImageStub(imagePath, sizeBytes)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.resizeImageReturns.result1
+}
+
+func (fake *FakeOsHelper) ResizeImageCallCount() int {
+	fake.resizeImageMutex.RLock()
+	defer fake.resizeImageMutex.RUnlock()
+	return len(fake.resizeImageArgsForCall)
+}
+
+func (fake *FakeOsHelper) ResizeImageArgsForCall(i int) (string, int64) {
+	fake.resizeImageMutex.RLock()
+	defer fake.resizeImageMutex.RUnlock()
+	return fake.resizeImageArgsForCall[i].imagePath, fake.resizeImageArgsForCall[i].sizeBytes
+}
+
+func (fake *FakeOsHelper) ResizeImageReturns(result1 error) {
+	fake.ResizeImageStub = nil
+	fake.resizeImageReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) ResizeImageReturnsOnCall(i int, result1 error) {
+	fake.ResizeImageStub = nil
+	if fake.resizeImageReturnsOnCall == nil {
+		fake.resizeImageReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.resizeImageReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) GrowFilesystem(devicePath string, mountPath string) error {
+	fake.growFilesystemMutex.Lock()
+	ret, specificReturn := fake.growFilesystemReturnsOnCall[len(fake.growFilesystemArgsForCall)]
+	fake.growFilesystemArgsForCall = append(fake.growFilesystemArgsForCall, struct {
+		devicePath string
+		mountPath  string
+	}{devicePath, mountPath})
+	fake.recordInvocation("GrowFilesystem", []interface{}{devicePath, mountPath})
+	fake.growFilesystemMutex.Unlock()
+	if fake.GrowFilesystemStub != nil {
+		return fake.GrowFilesystemStub(devicePath, mountPath)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.growFilesystemReturns.result1
+}
+
+func (fake *FakeOsHelper) GrowFilesystemCallCount() int {
+	fake.growFilesystemMutex.RLock()
+	defer fake.growFilesystemMutex.RUnlock()
+	return len(fake.growFilesystemArgsForCall)
+}
+
+func (fake *FakeOsHelper) GrowFilesystemArgsForCall(i int) (string, string) {
+	fake.growFilesystemMutex.RLock()
+	defer fake.growFilesystemMutex.RUnlock()
+	return fake.growFilesystemArgsForCall[i].devicePath, fake.growFilesystemArgsForCall[i].mountPath
+}
+
+func (fake *FakeOsHelper) GrowFilesystemReturns(result1 error) {
+	fake.GrowFilesystemStub = nil
+	fake.growFilesystemReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) GrowFilesystemReturnsOnCall(i int, result1 error) {
+	fake.GrowFilesystemStub = nil
+	if fake.growFilesystemReturnsOnCall == nil {
+		fake.growFilesystemReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.growFilesystemReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) GetMountInfo(targetPath string) (node.MountInfo, bool, error) {
+	fake.getMountInfoMutex.Lock()
+	ret, specificReturn := fake.getMountInfoReturnsOnCall[len(fake.getMountInfoArgsForCall)]
+	fake.getMountInfoArgsForCall = append(fake.getMountInfoArgsForCall, struct {
+		targetPath string
+	}{targetPath})
+	fake.recordInvocation("GetMountInfo", []interface{}{targetPath})
+	fake.getMountInfoMutex.Unlock()
+	if fake.GetMountInfoStub != nil {
+		return fake.GetMountInfoStub(targetPath)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fake.getMountInfoReturns.result1, fake.getMountInfoReturns.result2, fake.getMountInfoReturns.result3
+}
+
+func (fake *FakeOsHelper) GetMountInfoCallCount() int {
+	fake.getMountInfoMutex.RLock()
+	defer fake.getMountInfoMutex.RUnlock()
+	return len(fake.getMountInfoArgsForCall)
+}
+
+func (fake *FakeOsHelper) GetMountInfoArgsForCall(i int) string {
+	fake.getMountInfoMutex.RLock()
+	defer fake.getMountInfoMutex.RUnlock()
+	return fake.getMountInfoArgsForCall[i].targetPath
+}
+
+func (fake *FakeOsHelper) GetMountInfoReturns(result1 node.MountInfo, result2 bool, result3 error) {
+	fake.GetMountInfoStub = nil
+	fake.getMountInfoReturns = struct {
+		result1 node.MountInfo
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeOsHelper) GetMountInfoReturnsOnCall(i int, result1 node.MountInfo, result2 bool, result3 error) {
+	fake.GetMountInfoStub = nil
+	if fake.getMountInfoReturnsOnCall == nil {
+		fake.getMountInfoReturnsOnCall = make(map[int]struct {
+			result1 node.MountInfo
+			result2 bool
+			result3 error
+		})
+	}
+	fake.getMountInfoReturnsOnCall[i] = struct {
+		result1 node.MountInfo
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeOsHelper) ListMounts() ([]node.MountInfo, error) {
+	fake.listMountsMutex.Lock()
+	ret, specificReturn := fake.listMountsReturnsOnCall[len(fake.listMountsArgsForCall)]
+	fake.listMountsArgsForCall = append(fake.listMountsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("ListMounts", []interface{}{})
+	fake.listMountsMutex.Unlock()
+	if fake.ListMountsStub != nil {
+		return fake.ListMountsStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.listMountsReturns.result1, fake.listMountsReturns.result2
+}
+
+func (fake *FakeOsHelper) ListMountsCallCount() int {
+	fake.listMountsMutex.RLock()
+	defer fake.listMountsMutex.RUnlock()
+	return len(fake.listMountsArgsForCall)
+}
+
+func (fake *FakeOsHelper) ListMountsReturns(result1 []node.MountInfo, result2 error) {
+	fake.ListMountsStub = nil
+	fake.listMountsReturns = struct {
+		result1 []node.MountInfo
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) ListMountsReturnsOnCall(i int, result1 []node.MountInfo, result2 error) {
+	fake.ListMountsStub = nil
+	if fake.listMountsReturnsOnCall == nil {
+		fake.listMountsReturnsOnCall = make(map[int]struct {
+			result1 []node.MountInfo
+			result2 error
+		})
+	}
+	fake.listMountsReturnsOnCall[i] = struct {
+		result1 []node.MountInfo
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOsHelper) CloneFile(srcPath string, dstPath string, options node.CopyOptions) error {
+	fake.cloneFileMutex.Lock()
+	ret, specificReturn := fake.cloneFileReturnsOnCall[len(fake.cloneFileArgsForCall)]
+	fake.cloneFileArgsForCall = append(fake.cloneFileArgsForCall, struct {
+		srcPath string
+		dstPath string
+		options node.CopyOptions
+	}{srcPath, dstPath, options})
+	fake.recordInvocation("CloneFile", []interface{}{srcPath, dstPath, options})
+	fake.cloneFileMutex.Unlock()
+	if fake.CloneFileStub != nil {
+		return fake.CloneFileStub(srcPath, dstPath, options)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.cloneFileReturns.result1
+}
+
+func (fake *FakeOsHelper) CloneFileCallCount() int {
+	fake.cloneFileMutex.RLock()
+	defer fake.cloneFileMutex.RUnlock()
+	return len(fake.cloneFileArgsForCall)
+}
+
+func (fake *FakeOsHelper) CloneFileArgsForCall(i int) (string, string, node.CopyOptions) {
+	fake.cloneFileMutex.RLock()
+	defer fake.cloneFileMutex.RUnlock()
+	return fake.cloneFileArgsForCall[i].srcPath, fake.cloneFileArgsForCall[i].dstPath, fake.cloneFileArgsForCall[i].options
+}
+
+func (fake *FakeOsHelper) CloneFileReturns(result1 error) {
+	fake.CloneFileStub = nil
+	fake.cloneFileReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) CloneFileReturnsOnCall(i int, result1 error) {
+	fake.CloneFileStub = nil
+	if fake.cloneFileReturnsOnCall == nil {
+		fake.cloneFileReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.cloneFileReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) CloneTree(srcPath string, dstPath string, options node.CopyOptions) error {
+	fake.cloneTreeMutex.Lock()
+	ret, specificReturn := fake.cloneTreeReturnsOnCall[len(fake.cloneTreeArgsForCall)]
+	fake.cloneTreeArgsForCall = append(fake.cloneTreeArgsForCall, struct {
+		srcPath string
+		dstPath string
+		options node.CopyOptions
+	}{srcPath, dstPath, options})
+	fake.recordInvocation("CloneTree", []interface{}{srcPath, dstPath, options})
+	fake.cloneTreeMutex.Unlock()
+	if fake.CloneTreeStub != nil {
+		return fake.CloneTreeStub(srcPath, dstPath, options)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.cloneTreeReturns.result1
+}
+
+func (fake *FakeOsHelper) CloneTreeCallCount() int {
+	fake.cloneTreeMutex.RLock()
+	defer fake.cloneTreeMutex.RUnlock()
+	return len(fake.cloneTreeArgsForCall)
+}
+
+func (fake *FakeOsHelper) CloneTreeArgsForCall(i int) (string, string, node.CopyOptions) {
+	fake.cloneTreeMutex.RLock()
+	defer fake.cloneTreeMutex.RUnlock()
+	return fake.cloneTreeArgsForCall[i].srcPath, fake.cloneTreeArgsForCall[i].dstPath, fake.cloneTreeArgsForCall[i].options
+}
+
+func (fake *FakeOsHelper) CloneTreeReturns(result1 error) {
+	fake.CloneTreeStub = nil
+	fake.cloneTreeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOsHelper) CloneTreeReturnsOnCall(i int, result1 error) {
+	fake.CloneTreeStub = nil
+	if fake.cloneTreeReturnsOnCall == nil {
+		fake.cloneTreeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.cloneTreeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeOsHelper) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.umaskMutex.RLock()
-	defer fake.umaskMutex.RUnlock()
 	fake.mountMutex.RLock()
 	defer fake.mountMutex.RUnlock()
+	fake.mountReadOnlyMutex.RLock()
+	defer fake.mountReadOnlyMutex.RUnlock()
 	fake.isMountedMutex.RLock()
 	defer fake.isMountedMutex.RUnlock()
+	fake.isReadOnlyMutex.RLock()
+	defer fake.isReadOnlyMutex.RUnlock()
 	fake.unmountMutex.RLock()
 	defer fake.unmountMutex.RUnlock()
+	fake.statfsMutex.RLock()
+	defer fake.statfsMutex.RUnlock()
+	fake.supportsProjectQuotaMutex.RLock()
+	defer fake.supportsProjectQuotaMutex.RUnlock()
+	fake.getProjectIdMutex.RLock()
+	defer fake.getProjectIdMutex.RUnlock()
+	fake.setProjectQuotaMutex.RLock()
+	defer fake.setProjectQuotaMutex.RUnlock()
+	fake.getProjectQuotaMutex.RLock()
+	defer fake.getProjectQuotaMutex.RUnlock()
+	fake.createImageMutex.RLock()
+	defer fake.createImageMutex.RUnlock()
+	fake.mountImageMutex.RLock()
+	defer fake.mountImageMutex.RUnlock()
+	fake.attachLoopDeviceMutex.RLock()
+	defer fake.attachLoopDeviceMutex.RUnlock()
+	fake.findLoopDeviceMutex.RLock()
+	defer fake.findLoopDeviceMutex.RUnlock()
+	fake.detachLoopDeviceMutex.RLock()
+	defer fake.detachLoopDeviceMutex.RUnlock()
+	fake.resizeImageMutex.RLock()
+	defer fake.resizeImageMutex.RUnlock()
+	fake.growFilesystemMutex.RLock()
+	defer fake.growFilesystemMutex.RUnlock()
+	fake.getMountInfoMutex.RLock()
+	defer fake.getMountInfoMutex.RUnlock()
+	fake.listMountsMutex.RLock()
+	defer fake.listMountsMutex.RUnlock()
+	fake.cloneFileMutex.RLock()
+	defer fake.cloneFileMutex.RUnlock()
+	fake.cloneTreeMutex.RLock()
+	defer fake.cloneTreeMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
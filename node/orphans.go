@@ -0,0 +1,197 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// A crash part way through staging or publishing can leave bind mounts of
+// volume directories behind that nothing will ever unmount. The orphan
+// collector looks for mounts taken from under the volumes root that the
+// journal does not account for, and unmounts them.
+
+// CollectOrphans unmounts and removes every orphaned mount of a volume
+// directory. With dryRun set it only logs what it would have done.
+//
+// Nothing is collected when the journal did not exist at startup, as after
+// an upgrade from a plugin that did not keep one, since every mount would
+// look orphaned. Without allowed target roots a mount could be anywhere on
+// the host, so orphans are only logged.
+func (ln *LocalNode) CollectOrphans(logger lager.Logger, dryRun bool) error {
+	if len(ln.allowedTargetRoots) == 0 {
+		dryRun = true
+	}
+
+	logger = logger.Session("collect-orphans", lager.Data{"dry run": dryRun})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if !ln.journal.Existed() {
+		logger.Info("skipped-publish-journal-did-not-exist-at-startup")
+		return nil
+	}
+
+	mounts, err := ln.osHelper.ListMounts()
+	if err != nil {
+		logger.Error("list-mounts-failed", err)
+		return err
+	}
+
+	root, err := ln.filepath.EvalSymlinks(ln.volumesRootDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		logger.Error("eval-volumes-root-symlinks-failed", err)
+		return err
+	}
+
+	device, rootInFs, found := filesystemPath(mounts, root)
+	if !found {
+		logger.Info("volumes-root-filesystem-not-found", lager.Data{"root": root})
+		return nil
+	}
+
+	for _, mount := range mounts {
+		volumeId, ok := mountedVolume(mount, device, rootInFs)
+		if !ok {
+			continue
+		}
+
+		ln.collectOrphan(logger, volumeId, mount.MountPoint, dryRun)
+	}
+
+	return nil
+}
+
+func (ln *LocalNode) collectOrphan(logger lager.Logger, volumeId, mountPoint string, dryRun bool) {
+	data := lager.Data{"volume id": volumeId, "mount point": mountPoint}
+
+	if len(ln.allowedTargetRoots) > 0 {
+		_, ok, err := ln.targetRoot(mountPoint)
+		if err != nil || !ok {
+			logger.Debug("mount-outside-allowed-roots", data)
+			return
+		}
+	}
+
+	// a mount an RPC is still working on is not recorded in the journal yet
+	unlock, err := ln.lockVolume(logger, volumeId, mountPoint)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	known, err := ln.journaled(mountPoint)
+	if err != nil {
+		logger.Error("read-publish-journal-failed", err)
+		return
+	}
+
+	if known {
+		return
+	}
+
+	if dryRun {
+		logger.Info("would-unmount-orphan", data)
+		return
+	}
+
+	logger.Info("unmounting-orphan", data)
+	err = ln.osHelper.Unmount(mountPoint)
+	if err != nil {
+		logger.Error("unmount-orphan-failed", err, data)
+		return
+	}
+
+	err = ln.os.Remove(mountPoint)
+	if err != nil {
+		logger.Error("remove-orphan-mount-point-failed", err, data)
+		return
+	}
+
+	logger.Info("orphan-removed", data)
+}
+
+// journaled reports whether mountPoint is the staging or target path of a
+// stage or publish in the journal.
+func (ln *LocalNode) journaled(mountPoint string) (bool, error) {
+	paths := []string{}
+
+	stages, err := ln.journal.Stages()
+	if err != nil {
+		return false, err
+	}
+	for _, stage := range stages {
+		paths = append(paths, stage.StagingPath)
+	}
+
+	publishes, err := ln.journal.Records()
+	if err != nil {
+		return false, err
+	}
+	for _, publish := range publishes {
+		paths = append(paths, publish.TargetPath)
+	}
+
+	for _, path := range paths {
+		if path == mountPoint {
+			return true, nil
+		}
+
+		// mountinfo lists mount points with symlinks resolved
+		resolved, err := ln.resolvePath(path)
+		if err == nil && resolved == mountPoint {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// filesystemPath finds the mount that path lives on and returns its device
+// along with where path is within that filesystem.
+func filesystemPath(mounts []MountInfo, path string) (string, string, bool) {
+	var device, fsPath string
+	longest := -1
+
+	for _, mount := range mounts {
+		rel, err := filepath.Rel(mount.MountPoint, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		// later mounts at the same mount point are stacked on top
+		if len(mount.MountPoint) >= longest {
+			longest = len(mount.MountPoint)
+			device = mount.Device
+			fsPath = filepath.Join(mount.Root, rel)
+		}
+	}
+
+	return device, fsPath, longest >= 0
+}
+
+// mountedVolume reports which volume a mount was taken from, if its source
+// is a directory beneath the volumes root.
+func mountedVolume(mount MountInfo, device, rootInFs string) (string, bool) {
+	if mount.Device != device {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(rootInFs, mount.Root)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	volumeId := strings.Split(rel, string(filepath.Separator))[0]
+	if strings.HasPrefix(volumeId, ".") {
+		// the plugin's own directories, such as .images and .state
+		return "", false
+	}
+
+	return volumeId, true
+}
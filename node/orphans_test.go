@@ -0,0 +1,159 @@
+package node_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("CollectOrphans", func() {
+	var (
+		dryRun       bool
+		err          error
+		fakeFilepath *filepath_fake.FakeFilepath
+		fakeJournal  *nodefakes.FakePublishJournal
+		fakeOs       *os_fake.FakeOs
+		fakeOsHelper *nodefakes.FakeOsHelper
+		localNode    *node.LocalNode
+		testLogger   *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		dryRun = false
+		testLogger = lagertest.NewTestLogger("collect-orphans")
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+			return path, nil
+		}
+
+		fakeJournal = &nodefakes.FakePublishJournal{}
+		fakeJournal.ExistedReturns(true)
+		fakeJournal.StagesReturns([]node.StageRecord{{VolumeId: "staged-volume", StagingPath: "/path/to/staging/staged-volume"}}, nil)
+		fakeJournal.RecordsReturns([]node.PublishRecord{{VolumeId: "staged-volume", TargetPath: "/path/to/mount/staged-volume"}}, nil)
+
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeOsHelper.ListMountsReturns([]node.MountInfo{
+			{Device: "8:1", Root: "/", MountPoint: "/"},
+			{Device: "8:2", Root: "/", MountPoint: "/var/vcap/data"},
+			{Device: "8:2", Root: "/volumes/staged-volume", MountPoint: "/path/to/staging/staged-volume"},
+			{Device: "8:2", Root: "/volumes/staged-volume", MountPoint: "/path/to/mount/staged-volume"},
+			{Device: "8:2", Root: "/volumes/leaked-volume", MountPoint: "/path/to/mount/leaked-volume"},
+			{Device: "8:2", Root: "/volumes/.images", MountPoint: "/path/to/images"},
+			{Device: "8:2", Root: "/packages", MountPoint: "/path/to/packages"},
+			{Device: "8:1", Root: "/volumes/other-volume", MountPoint: "/path/to/mount/other-volume"},
+		}, nil)
+
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, "/var/vcap/data/volumes", "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, AllowedTargetRoots: []string{"/path/to"}, Journal: fakeJournal})
+	})
+
+	JustBeforeEach(func() {
+		err = localNode.CollectOrphans(testLogger, dryRun)
+	})
+
+	It("unmounts and removes bind mounts of volume directories that are not in the journal", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeOsHelper.UnmountCallCount()).To(Equal(1))
+		Expect(fakeOsHelper.UnmountArgsForCall(0)).To(Equal("/path/to/mount/leaked-volume"))
+		Expect(fakeOs.RemoveCallCount()).To(Equal(1))
+		Expect(fakeOs.RemoveArgsForCall(0)).To(Equal("/path/to/mount/leaked-volume"))
+
+		Expect(testLogger.Buffer()).To(gbytes.Say("unmounting-orphan"))
+		Expect(testLogger.Buffer()).To(gbytes.Say("orphan-removed"))
+	})
+
+	Context("in dry run mode", func() {
+		BeforeEach(func() {
+			dryRun = true
+		})
+
+		It("only logs the orphans", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			Expect(testLogger.Buffer()).To(gbytes.Say("would-unmount-orphan.*leaked-volume"))
+		})
+	})
+
+	Context("when the orphan cannot be unmounted", func() {
+		BeforeEach(func() {
+			fakeOsHelper.UnmountReturns(errors.New("device busy"))
+		})
+
+		It("leaves its mount point in place", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the journal did not exist at startup", func() {
+		BeforeEach(func() {
+			fakeJournal.ExistedReturns(false)
+			fakeJournal.StagesReturns([]node.StageRecord{}, nil)
+			fakeJournal.RecordsReturns([]node.PublishRecord{}, nil)
+		})
+
+		It("does not unmount anything, as mounts made before the upgrade are not in it", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.ListMountsCallCount()).To(Equal(0))
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			Expect(testLogger.Buffer()).To(gbytes.Say("skipped-publish-journal-did-not-exist-at-startup"))
+		})
+	})
+
+	Context("when no allowed target roots are configured", func() {
+		BeforeEach(func() {
+			localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, "/var/vcap/data/volumes", "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, Journal: fakeJournal})
+		})
+
+		It("only logs the orphans, as they could be mounted anywhere on the host", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			Expect(testLogger.Buffer()).To(gbytes.Say("would-unmount-orphan.*leaked-volume"))
+		})
+	})
+
+	Context("when the journal cannot be read", func() {
+		BeforeEach(func() {
+			fakeJournal.StagesReturns(nil, errors.New("corrupt journal"))
+		})
+
+		It("does not unmount anything", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the orphan is outside the allowed target roots", func() {
+		BeforeEach(func() {
+			localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, "/var/vcap/data/volumes", "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, AllowedTargetRoots: []string{"/var/vcap/data/mounts"}, Journal: fakeJournal})
+		})
+
+		It("leaves it alone", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the mount table cannot be read", func() {
+		BeforeEach(func() {
+			fakeOsHelper.ListMountsReturns(nil, errors.New("permission denied"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("permission denied"))
+		})
+	})
+})
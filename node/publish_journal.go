@@ -0,0 +1,268 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The set of staged and published volumes is otherwise only held in memory,
+// so a restarted plugin would forget which mounts it is responsible for. The
+// publish journal keeps a copy on disk that is reconciled with the mount
+// table at startup.
+
+const (
+	// StateDir is where the journal is kept under the volumes root unless
+	// another directory is configured
+	StateDir = ".state"
+
+	publishJournalFile = "publishes.json"
+)
+
+//go:generate counterfeiter -o nodefakes/fake_publish_journal.go . PublishJournal
+type PublishJournal interface {
+	Record(record PublishRecord) error
+	Remove(volumeId, targetPath string) error
+	Records() ([]PublishRecord, error)
+	RecordStage(record StageRecord) error
+	RemoveStage(volumeId, stagingPath string) error
+	Stages() ([]StageRecord, error)
+	// Existed reports whether the journal was already on disk when it was
+	// opened. Until it was, mounts made by earlier plugins are not in it.
+	Existed() bool
+}
+
+type PublishRecord struct {
+	VolumeId    string   `json:"volume_id"`
+	TargetPath  string   `json:"target_path"`
+	StagingPath string   `json:"staging_path"`
+	ReadOnly    bool     `json:"readonly"`
+	MountFlags  []string `json:"mount_flags,omitempty"`
+	Block       bool     `json:"block,omitempty"`
+}
+
+type StageRecord struct {
+	VolumeId    string `json:"volume_id"`
+	StagingPath string `json:"staging_path"`
+}
+
+type journalContents struct {
+	Stages    []StageRecord   `json:"stages"`
+	Publishes []PublishRecord `json:"publishes"`
+}
+
+type filePublishJournal struct {
+	path    string
+	existed bool
+
+	lock sync.Mutex
+}
+
+// NewFilePublishJournal keeps the journal as a JSON file in stateDir. The file
+// is replaced with a rename on every change so a crash mid-write leaves either
+// the old or the new contents behind. Only stateDir itself is created; its
+// parent, usually the volumes root, must already exist so its mode is left
+// alone.
+func NewFilePublishJournal(stateDir string) (PublishJournal, error) {
+	err := os.Mkdir(stateDir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	path := filepath.Join(stateDir, publishJournalFile)
+	_, err = os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &filePublishJournal{path: path, existed: err == nil}, nil
+}
+
+func (j *filePublishJournal) Record(record PublishRecord) error {
+	return j.update(func(contents *journalContents) {
+		contents.Publishes = append(withoutPublish(contents.Publishes, record.VolumeId, record.TargetPath), record)
+	})
+}
+
+func (j *filePublishJournal) Remove(volumeId, targetPath string) error {
+	return j.update(func(contents *journalContents) {
+		contents.Publishes = withoutPublish(contents.Publishes, volumeId, targetPath)
+	})
+}
+
+func (j *filePublishJournal) Records() ([]PublishRecord, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	contents, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	return contents.Publishes, nil
+}
+
+func (j *filePublishJournal) RecordStage(record StageRecord) error {
+	return j.update(func(contents *journalContents) {
+		contents.Stages = append(withoutStage(contents.Stages, record.VolumeId, record.StagingPath), record)
+	})
+}
+
+func (j *filePublishJournal) RemoveStage(volumeId, stagingPath string) error {
+	return j.update(func(contents *journalContents) {
+		contents.Stages = withoutStage(contents.Stages, volumeId, stagingPath)
+	})
+}
+
+func (j *filePublishJournal) Stages() ([]StageRecord, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	contents, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	return contents.Stages, nil
+}
+
+func (j *filePublishJournal) Existed() bool {
+	return j.existed
+}
+
+func (j *filePublishJournal) update(change func(*journalContents)) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	contents, err := j.load()
+	if err != nil {
+		return err
+	}
+
+	change(&contents)
+	return j.save(contents)
+}
+
+func (j *filePublishJournal) load() (journalContents, error) {
+	contents := journalContents{Stages: []StageRecord{}, Publishes: []PublishRecord{}}
+
+	data, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return contents, nil
+	}
+	if err != nil {
+		return contents, err
+	}
+
+	err = json.Unmarshal(data, &contents)
+	return contents, err
+}
+
+func (j *filePublishJournal) save(contents journalContents) error {
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(j.path), publishJournalFile+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), j.path)
+}
+
+type memoryPublishJournal struct {
+	lock     sync.Mutex
+	contents journalContents
+}
+
+// NewMemoryPublishJournal keeps the journal in memory only, so nothing is
+// remembered across restarts and no mount is ever taken to be an orphan.
+func NewMemoryPublishJournal() PublishJournal {
+	return &memoryPublishJournal{
+		contents: journalContents{Stages: []StageRecord{}, Publishes: []PublishRecord{}},
+	}
+}
+
+func (j *memoryPublishJournal) Record(record PublishRecord) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.contents.Publishes = append(withoutPublish(j.contents.Publishes, record.VolumeId, record.TargetPath), record)
+	return nil
+}
+
+func (j *memoryPublishJournal) Remove(volumeId, targetPath string) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.contents.Publishes = withoutPublish(j.contents.Publishes, volumeId, targetPath)
+	return nil
+}
+
+func (j *memoryPublishJournal) Records() ([]PublishRecord, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return append([]PublishRecord{}, j.contents.Publishes...), nil
+}
+
+func (j *memoryPublishJournal) RecordStage(record StageRecord) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.contents.Stages = append(withoutStage(j.contents.Stages, record.VolumeId, record.StagingPath), record)
+	return nil
+}
+
+func (j *memoryPublishJournal) RemoveStage(volumeId, stagingPath string) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.contents.Stages = withoutStage(j.contents.Stages, volumeId, stagingPath)
+	return nil
+}
+
+func (j *memoryPublishJournal) Stages() ([]StageRecord, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return append([]StageRecord{}, j.contents.Stages...), nil
+}
+
+func (j *memoryPublishJournal) Existed() bool {
+	return false
+}
+
+func withoutPublish(records []PublishRecord, volumeId, targetPath string) []PublishRecord {
+	remaining := []PublishRecord{}
+	for _, record := range records {
+		if record.VolumeId != volumeId || record.TargetPath != targetPath {
+			remaining = append(remaining, record)
+		}
+	}
+	return remaining
+}
+
+func withoutStage(records []StageRecord, volumeId, stagingPath string) []StageRecord {
+	remaining := []StageRecord{}
+	for _, record := range records {
+		if record.VolumeId != volumeId || record.StagingPath != stagingPath {
+			remaining = append(remaining, record)
+		}
+	}
+	return remaining
+}
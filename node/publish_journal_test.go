@@ -0,0 +1,176 @@
+package node_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FilePublishJournal", func() {
+	var (
+		journal  node.PublishJournal
+		stateDir string
+		record   node.PublishRecord
+	)
+
+	BeforeEach(func() {
+		tempDir, err := ioutil.TempDir("", "publish-journal")
+		Expect(err).NotTo(HaveOccurred())
+		stateDir = filepath.Join(tempDir, "state")
+
+		journal, err = node.NewFilePublishJournal(stateDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		record = node.PublishRecord{
+			VolumeId:    "test-volume-id",
+			TargetPath:  "/path/to/mount/test-volume-id",
+			StagingPath: "/path/to/staging/test-volume-id",
+			ReadOnly:    true,
+			MountFlags:  []string{"noexec"},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Dir(stateDir))
+	})
+
+	It("creates the state directory readable only by the plugin", func() {
+		info, err := os.Stat(stateDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+	})
+
+	It("leaves the mode of the parent directory alone", func() {
+		Expect(os.Chmod(filepath.Dir(stateDir), 0755)).To(Succeed())
+		_, err := node.NewFilePublishJournal(stateDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := os.Stat(filepath.Dir(stateDir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+	})
+
+	It("does not create a missing parent directory", func() {
+		_, err := node.NewFilePublishJournal(filepath.Join(stateDir, "missing", "state"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("starts out empty", func() {
+		records, err := journal.Records()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(BeEmpty())
+	})
+
+	It("reports whether it was on disk when it was opened", func() {
+		Expect(journal.Existed()).To(BeFalse())
+
+		Expect(journal.Record(record)).To(Succeed())
+		Expect(journal.Existed()).To(BeFalse())
+
+		reopened, err := node.NewFilePublishJournal(stateDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Existed()).To(BeTrue())
+	})
+
+	It("keeps recorded publishes across instances", func() {
+		Expect(journal.Record(record)).To(Succeed())
+
+		reopened, err := node.NewFilePublishJournal(stateDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Records()).To(Equal([]node.PublishRecord{record}))
+	})
+
+	It("replaces the record for the same volume and target path", func() {
+		Expect(journal.Record(record)).To(Succeed())
+		record.ReadOnly = false
+		Expect(journal.Record(record)).To(Succeed())
+
+		Expect(journal.Records()).To(Equal([]node.PublishRecord{record}))
+	})
+
+	It("removes records", func() {
+		other := record
+		other.TargetPath = "/path/to/mount/other"
+		Expect(journal.Record(record)).To(Succeed())
+		Expect(journal.Record(other)).To(Succeed())
+
+		Expect(journal.Remove(record.VolumeId, record.TargetPath)).To(Succeed())
+		Expect(journal.Records()).To(Equal([]node.PublishRecord{other}))
+
+		Expect(journal.Remove("unknown-volume", "/unknown")).To(Succeed())
+	})
+
+	It("keeps stages separately from publishes", func() {
+		stage := node.StageRecord{VolumeId: "test-volume-id", StagingPath: "/path/to/staging/test-volume-id"}
+		Expect(journal.RecordStage(stage)).To(Succeed())
+		Expect(journal.Record(record)).To(Succeed())
+
+		Expect(journal.Stages()).To(Equal([]node.StageRecord{stage}))
+		Expect(journal.Records()).To(Equal([]node.PublishRecord{record}))
+
+		Expect(journal.RemoveStage(stage.VolumeId, stage.StagingPath)).To(Succeed())
+		Expect(journal.Stages()).To(BeEmpty())
+		Expect(journal.Records()).To(Equal([]node.PublishRecord{record}))
+	})
+
+	It("leaves no temporary files behind", func() {
+		Expect(journal.Record(record)).To(Succeed())
+		Expect(journal.Remove(record.VolumeId, record.TargetPath)).To(Succeed())
+
+		entries, err := ioutil.ReadDir(stateDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("publishes.json"))
+	})
+
+	Context("when the journal file is corrupt", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(stateDir, "publishes.json"), []byte("{"), 0600)).To(Succeed())
+		})
+
+		It("returns an error rather than losing the records", func() {
+			_, err := journal.Records()
+			Expect(err).To(HaveOccurred())
+
+			Expect(journal.Record(record)).NotTo(Succeed())
+		})
+	})
+})
+
+var _ = Describe("MemoryPublishJournal", func() {
+	var (
+		journal node.PublishJournal
+		record  node.PublishRecord
+		stage   node.StageRecord
+	)
+
+	BeforeEach(func() {
+		journal = node.NewMemoryPublishJournal()
+		record = node.PublishRecord{VolumeId: "test-volume-id", TargetPath: "/path/to/mount/test-volume-id"}
+		stage = node.StageRecord{VolumeId: "test-volume-id", StagingPath: "/path/to/staging/test-volume-id"}
+	})
+
+	It("starts out empty and never reports having existed", func() {
+		Expect(journal.Records()).To(BeEmpty())
+		Expect(journal.Stages()).To(BeEmpty())
+		Expect(journal.Existed()).To(BeFalse())
+	})
+
+	It("keeps stages and publishes until they are removed", func() {
+		Expect(journal.RecordStage(stage)).To(Succeed())
+		Expect(journal.Record(record)).To(Succeed())
+		Expect(journal.Record(record)).To(Succeed())
+
+		Expect(journal.Stages()).To(Equal([]node.StageRecord{stage}))
+		Expect(journal.Records()).To(Equal([]node.PublishRecord{record}))
+
+		Expect(journal.Remove(record.VolumeId, record.TargetPath)).To(Succeed())
+		Expect(journal.RemoveStage(stage.VolumeId, stage.StagingPath)).To(Succeed())
+		Expect(journal.Records()).To(BeEmpty())
+		Expect(journal.Stages()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,246 @@
+package node
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	CapacityAttribute = "capacity"
+
+	// same bytes-per-inode ratio mke2fs uses by default
+	bytesPerInode = 16384
+)
+
+type QuotaLimits struct {
+	Bytes  int64
+	Inodes int64
+}
+
+type QuotaStats struct {
+	LimitBytes  int64
+	UsedBytes   int64
+	LimitInodes int64
+	UsedInodes  int64
+}
+
+// applyCapacity limits the volume directory to the size requested in the
+// capacity volume attribute. Project quotas are used when the filesystem under
+// the volumes root supports them, otherwise the volume directory is backed by
+// a loopback image of the requested size.
+func (ns *LocalNode) applyCapacity(logger lager.Logger, volumeId, volumePath string, volumeContext map[string]string) error {
+	logger = logger.Session("apply-capacity")
+
+	capacity, ok := volumeContext[CapacityAttribute]
+	if !ns.quotasEnabled || !ok {
+		return nil
+	}
+
+	bytes, err := parseCapacity(logger, capacity)
+	if err != nil {
+		return err
+	}
+	limits := QuotaLimits{Bytes: bytes, Inodes: bytes / bytesPerInode}
+
+	supported, err := ns.osHelper.SupportsProjectQuota(ns.volumesRootDir)
+	if err != nil {
+		logger.Error("supports-project-quota-failed", err)
+		errorDescription := "Error checking for project quota support"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if supported {
+		// held until the quota is set, as that is what marks the ID as used
+		ns.projectIdLock.Lock()
+		defer ns.projectIdLock.Unlock()
+
+		projectId, err := ns.projectId(logger, volumeId, volumePath)
+		if err != nil {
+			logger.Error("project-id-failed", err)
+			errorDescription := "Error allocating project ID"
+			return grpc.Errorf(codes.Internal, errorDescription)
+		}
+
+		quota, err := ns.osHelper.GetProjectQuota(volumePath, projectId)
+		if err != nil {
+			logger.Error("get-project-quota-failed", err)
+			errorDescription := "Error getting volume quota"
+			return grpc.Errorf(codes.Internal, errorDescription)
+		}
+
+		// a volume expanded since it was created keeps its larger quota
+		if quota.LimitBytes > limits.Bytes {
+			logger.Info("project-quota-already-larger", lager.Data{"projectId": projectId, "quota": quota})
+			return nil
+		}
+
+		logger.Info("set-project-quota", lager.Data{"projectId": projectId, "limits": limits})
+		err = ns.osHelper.SetProjectQuota(volumePath, projectId, limits)
+		if err != nil {
+			logger.Error("set-project-quota-failed", err)
+			errorDescription := "Error setting volume quota"
+			return grpc.Errorf(codes.Internal, errorDescription)
+		}
+		return nil
+	}
+
+	err = ns.mountImage(logger, volumeId, volumePath, bytes, defaultImageFsType)
+	if err != nil {
+		logger.Error("mount-image-failed", err)
+		errorDescription := "Error creating loopback volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+	return nil
+}
+
+// projectId returns the project ID already assigned to the volume directory,
+// or allocates one that no other volume directory is using. The caller holds
+// projectIdLock until the ID is set on the directory.
+func (ns *LocalNode) projectId(logger lager.Logger, volumeId, volumePath string) (uint32, error) {
+	projectId, err := ns.osHelper.GetProjectId(volumePath)
+	if err != nil {
+		return 0, err
+	}
+
+	if projectId != 0 {
+		return projectId, nil
+	}
+
+	paths, err := ns.filepath.Glob(filepath.Join(ns.volumesRootDir, "*"))
+	if err != nil {
+		return 0, err
+	}
+
+	used := map[uint32]bool{}
+	for _, path := range paths {
+		if path == volumePath {
+			continue
+		}
+
+		id, err := ns.osHelper.GetProjectId(path)
+		if err != nil {
+			logger.Error("get-project-id-failed", err, lager.Data{"path": path})
+			continue
+		}
+		used[id] = true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(volumeId))
+	projectId = hash.Sum32()
+	for projectId == 0 || used[projectId] {
+		projectId++
+	}
+
+	return projectId, nil
+}
+
+// unmountCapacityImage unmounts the loopback image that limits a volume
+// directory on filesystems without project quotas, which also releases its
+// loop device. The image is mounted again the next time the volume is staged.
+func (ns *LocalNode) unmountCapacityImage(logger lager.Logger, volumeId string) error {
+	volumePath := filepath.Join(ns.volumesRootDir, volumeId)
+	mounted, err := ns.osHelper.IsMounted(volumePath)
+	if err != nil {
+		logger.Error("volume-image-is-mounted-failed", err)
+		errorDescription := "Error checking if volume image is mounted"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !mounted {
+		return nil
+	}
+
+	logger.Info("unmount-volume-image", lager.Data{"volume path": volumePath})
+	err = ns.osHelper.Unmount(volumePath)
+	if err != nil {
+		logger.Error("unmount-volume-image-failed", err)
+		errorDescription := "Error unmounting volume image"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return nil
+}
+
+// volumeStats narrows the filesystem wide stats down to what the volume
+// itself is allowed to use and is using.
+func (ns *LocalNode) volumeStats(logger lager.Logger, volumeId string, stats FilesystemStats) (FilesystemStats, error) {
+	volumePath := filepath.Join(ns.volumesRootDir, volumeId)
+
+	loopback, err := ns.exists(ns.imagePath(volumeId))
+	if err != nil {
+		return FilesystemStats{}, err
+	}
+
+	if loopback {
+		// the volume has a filesystem of its own, so statfs is already accurate
+		return stats, nil
+	}
+
+	if ns.quotasEnabled {
+		projectId, err := ns.osHelper.GetProjectId(volumePath)
+		if err != nil {
+			// not every filesystem supports project IDs, fall back to the other sources
+			logger.Error("get-project-id-failed", err)
+			projectId = 0
+		}
+
+		if projectId != 0 {
+			quota, err := ns.osHelper.GetProjectQuota(volumePath, projectId)
+			if err != nil {
+				return FilesystemStats{}, err
+			}
+			logger.Info("project-quota", lager.Data{"projectId": projectId, "quota": quota})
+
+			return FilesystemStats{
+				TotalBytes:     quota.LimitBytes,
+				AvailableBytes: remaining(quota.LimitBytes, quota.UsedBytes),
+				UsedBytes:      quota.UsedBytes,
+				TotalInodes:    quota.LimitInodes,
+				FreeInodes:     remaining(quota.LimitInodes, quota.UsedInodes),
+				UsedInodes:     quota.UsedInodes,
+			}, nil
+		}
+	}
+
+	// statfs reports the whole filesystem shared by every volume, so the used
+	// figures come from walking the volume's own directory. The volume can
+	// grow into whatever is free on that filesystem, so its total is what it
+	// uses plus that.
+	usage, err := ns.usage.Usage(logger, volumePath)
+	if err != nil {
+		return FilesystemStats{}, err
+	}
+
+	return FilesystemStats{
+		TotalBytes:     usage.UsedBytes + stats.AvailableBytes,
+		AvailableBytes: stats.AvailableBytes,
+		UsedBytes:      usage.UsedBytes,
+		TotalInodes:    usage.UsedInodes + stats.FreeInodes,
+		FreeInodes:     stats.FreeInodes,
+		UsedInodes:     usage.UsedInodes,
+	}, nil
+}
+
+func parseCapacity(logger lager.Logger, capacity string) (int64, error) {
+	bytes, err := strconv.ParseInt(capacity, 10, 64)
+	if err != nil || bytes <= 0 {
+		logger.Info("invalid-capacity", lager.Data{"capacity": capacity})
+		errorDescription := "Invalid capacity volume attribute"
+		return 0, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return bytes, nil
+}
+
+func remaining(limit, used int64) int64 {
+	if used > limit {
+		return 0
+	}
+	return limit - used
+}
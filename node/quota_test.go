@@ -0,0 +1,372 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Volume Capacity", func() {
+	var (
+		context          context.Context
+		fakeFilepath     *filepath_fake.FakeFilepath
+		fakeJournal      *nodefakes.FakePublishJournal
+		fakeOs           *os_fake.FakeOs
+		fakeOsHelper     *nodefakes.FakeOsHelper
+		fakeUsage        *nodefakes.FakeUsageAccountant
+		localNode        *node.LocalNode
+		stageRequest     *csi.NodeStageVolumeRequest
+		volumeId         string
+		volumePath       string
+		volumesRoot      string
+		volumeCapability *csi.VolumeCapability
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		volumeId = "test-volume-id"
+		volumePath = filepath.Join(volumesRoot, volumeId)
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeUsage = &nodefakes.FakeUsageAccountant{}
+		fakeJournal = &nodefakes.FakePublishJournal{}
+
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("volume-capacity"), volumesRoot, "some-node-id", node.Options{Usage: fakeUsage, QuotasEnabled: true, Journal: fakeJournal})
+		volumeCapability = &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
+
+		stageRequest = &csi.NodeStageVolumeRequest{
+			VolumeId:          volumeId,
+			StagingTargetPath: "/path/to/staging/test-volume-id",
+			VolumeCapability:  volumeCapability,
+			VolumeContext:     map[string]string{node.CapacityAttribute: "1073741824"},
+		}
+	})
+
+	Describe("NodeStageVolume", func() {
+		Context("when the filesystem supports project quotas", func() {
+			BeforeEach(func() {
+				fakeOsHelper.SupportsProjectQuotaReturns(true, nil)
+			})
+
+			It("allocates a project ID and limits the volume directory to its capacity", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.SupportsProjectQuotaArgsForCall(0)).To(Equal(volumesRoot))
+				Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(1))
+				path, projectId, limits := fakeOsHelper.SetProjectQuotaArgsForCall(0)
+				Expect(path).To(Equal(volumePath))
+				Expect(projectId).NotTo(BeZero())
+				Expect(limits).To(Equal(node.QuotaLimits{Bytes: 1073741824, Inodes: 65536}))
+
+				Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(0))
+			})
+
+			Context("when the volume directory already has a project ID", func() {
+				BeforeEach(func() {
+					fakeOsHelper.GetProjectIdReturns(1234, nil)
+				})
+
+				It("keeps the existing project ID", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, projectId, _ := fakeOsHelper.SetProjectQuotaArgsForCall(0)
+					Expect(projectId).To(Equal(uint32(1234)))
+					Expect(fakeFilepath.GlobCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the volume has since been expanded", func() {
+				BeforeEach(func() {
+					fakeOsHelper.GetProjectIdReturns(1234, nil)
+					fakeOsHelper.GetProjectQuotaReturns(node.QuotaStats{LimitBytes: 2147483648}, nil)
+				})
+
+				It("keeps the larger quota", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when another volume already uses the same project ID", func() {
+				var otherProjectId uint32
+
+				BeforeEach(func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).NotTo(HaveOccurred())
+					_, otherProjectId, _ = fakeOsHelper.SetProjectQuotaArgsForCall(0)
+
+					fakeFilepath.GlobReturns([]string{volumePath, filepath.Join(volumesRoot, "other-volume-id")}, nil)
+					fakeOsHelper.GetProjectIdStub = func(path string) (uint32, error) {
+						if path == volumePath {
+							return 0, nil
+						}
+						return otherProjectId, nil
+					}
+				})
+
+				It("allocates a different project ID", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, projectId, _ := fakeOsHelper.SetProjectQuotaArgsForCall(1)
+					Expect(projectId).NotTo(Equal(otherProjectId))
+					Expect(projectId).NotTo(BeZero())
+				})
+			})
+
+			Context("when setting the quota fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.SetProjectQuotaReturns(errors.New("quotactl failed"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error setting volume quota"))
+
+					Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the filesystem does not support project quotas", func() {
+			BeforeEach(func() {
+				fakeOsHelper.SupportsProjectQuotaReturns(false, nil)
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("creates a loopback image of the requested capacity and mounts it on the volume directory", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				imagePath := filepath.Join(volumesRoot, ".images", volumeId+".img")
+				Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(1))
+				path, size, fsType := fakeOsHelper.CreateImageArgsForCall(0)
+				Expect(path).To(Equal(imagePath))
+				Expect(size).To(Equal(int64(1073741824)))
+				Expect(fsType).To(Equal("ext4"))
+
+				Expect(fakeOsHelper.MountImageCallCount()).To(Equal(1))
+				from, to := fakeOsHelper.MountImageArgsForCall(0)
+				Expect(from).To(Equal(imagePath))
+				Expect(to).To(Equal(volumePath))
+
+				Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(0))
+			})
+
+			Context("when the image already exists", func() {
+				BeforeEach(func() {
+					fakeOs.StatReturns(nil, nil)
+				})
+
+				It("mounts the existing image", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(0))
+					Expect(fakeOsHelper.MountImageCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when creating the image fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.CreateImageReturns(errors.New("mkfs failed"))
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeStageVolume(context, stageRequest)
+					Expect(err).To(HaveOccurred())
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error creating loopback volume"))
+				})
+			})
+		})
+
+		Context("when the capacity attribute is not a number", func() {
+			BeforeEach(func() {
+				stageRequest.VolumeContext[node.CapacityAttribute] = "lots"
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+				Expect(grpcStatus.Message()).To(Equal("Invalid capacity volume attribute"))
+			})
+		})
+
+		Context("when the capacity attribute is not specified", func() {
+			BeforeEach(func() {
+				stageRequest.VolumeContext = nil
+			})
+
+			It("does not limit the volume", func() {
+				_, err := localNode.NodeStageVolume(context, stageRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.SupportsProjectQuotaCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.SetProjectQuotaCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.CreateImageCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("NodeUnstageVolume", func() {
+		var unstageRequest *csi.NodeUnstageVolumeRequest
+
+		BeforeEach(func() {
+			unstageRequest = &csi.NodeUnstageVolumeRequest{VolumeId: volumeId, StagingTargetPath: stageRequest.StagingTargetPath}
+		})
+
+		Context("when the volume directory is backed by a loopback image", func() {
+			BeforeEach(func() {
+				fakeOsHelper.IsMountedReturns(true, nil)
+			})
+
+			It("unmounts the image after the staging path, releasing its loop device", func() {
+				_, err := localNode.NodeUnstageVolume(context, unstageRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.UnmountCallCount()).To(Equal(2))
+				Expect(fakeOsHelper.UnmountArgsForCall(0)).To(Equal(stageRequest.StagingTargetPath))
+				Expect(fakeOsHelper.UnmountArgsForCall(1)).To(Equal(volumePath))
+			})
+
+			Context("when a retry finds the staging path already unmounted", func() {
+				BeforeEach(func() {
+					fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+						return path == volumePath, nil
+					}
+				})
+
+				It("still unmounts the image", func() {
+					_, err := localNode.NodeUnstageVolume(context, unstageRequest)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeOsHelper.UnmountCallCount()).To(Equal(1))
+					Expect(fakeOsHelper.UnmountArgsForCall(0)).To(Equal(volumePath))
+				})
+			})
+
+			Context("when unmounting the image fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.UnmountStub = func(path string) error {
+						if path == volumePath {
+							return errors.New("device busy")
+						}
+						return nil
+					}
+				})
+
+				It("returns an error", func() {
+					_, err := localNode.NodeUnstageVolume(context, unstageRequest)
+					Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error unmounting volume image"))
+				})
+			})
+		})
+	})
+
+	Describe("NodeGetVolumeStats", func() {
+		BeforeEach(func() {
+			fakeJournal.RecordsReturns([]node.PublishRecord{{VolumeId: volumeId, TargetPath: "/some/target"}}, nil)
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if filepath.Ext(path) == ".img" {
+					return nil, os.ErrNotExist
+				}
+				return newFakeFileInfo(), nil
+			}
+		})
+
+		Context("when the volume has a project quota", func() {
+			BeforeEach(func() {
+				fakeOsHelper.GetProjectIdReturns(1234, nil)
+				fakeOsHelper.GetProjectQuotaReturns(node.QuotaStats{
+					LimitBytes:  1000,
+					UsedBytes:   250,
+					LimitInodes: 100,
+					UsedInodes:  5,
+				}, nil)
+			})
+
+			It("reports the quota limits and usage", func() {
+				resp, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: "/some/target"})
+				Expect(err).NotTo(HaveOccurred())
+
+				path, projectId := fakeOsHelper.GetProjectQuotaArgsForCall(0)
+				Expect(path).To(Equal(volumePath))
+				Expect(projectId).To(Equal(uint32(1234)))
+
+				usage := resp.GetUsage()
+				Expect(usage[0].GetTotal()).To(Equal(int64(1000)))
+				Expect(usage[0].GetAvailable()).To(Equal(int64(750)))
+				Expect(usage[0].GetUsed()).To(Equal(int64(250)))
+				Expect(usage[1].GetTotal()).To(Equal(int64(100)))
+				Expect(usage[1].GetAvailable()).To(Equal(int64(95)))
+				Expect(usage[1].GetUsed()).To(Equal(int64(5)))
+
+				Expect(fakeUsage.UsageCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume is backed by a loopback image", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(newFakeFileInfo(), nil)
+				fakeOsHelper.StatfsReturns(node.FilesystemStats{TotalBytes: 500, AvailableBytes: 400, UsedBytes: 100}, nil)
+			})
+
+			It("reports the stats of the image filesystem", func() {
+				resp, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: "/some/target"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.StatfsCallCount()).To(Equal(1))
+				Expect(fakeOsHelper.StatfsArgsForCall(0)).To(Equal("/some/target"))
+				Expect(resp.GetUsage()[0].GetTotal()).To(Equal(int64(500)))
+				Expect(resp.GetUsage()[0].GetUsed()).To(Equal(int64(100)))
+				Expect(fakeOsHelper.GetProjectIdCallCount()).To(Equal(0))
+				Expect(fakeUsage.UsageCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when getting the project quota fails", func() {
+			BeforeEach(func() {
+				fakeOsHelper.GetProjectIdReturns(1234, nil)
+				fakeOsHelper.GetProjectQuotaReturns(node.QuotaStats{}, errors.New("quotactl failed"))
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: volumeId, VolumePath: "/some/target"})
+				Expect(err).To(HaveOccurred())
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+				Expect(grpcStatus.Message()).To(Equal("Error getting volume usage"))
+			})
+		})
+	})
+})
@@ -0,0 +1,121 @@
+package node
+
+import (
+	"code.cloudfoundry.org/lager"
+)
+
+// Reconcile compares the publish journal with the mount table when the plugin
+// starts. Publishes that are still mounted are tracked again, targets that
+// lost their mount are mounted again if the volume is still staged, and
+// anything that can't be repaired is reported and dropped from the journal.
+func (ln *LocalNode) Reconcile(logger lager.Logger) error {
+	logger = logger.Session("reconcile")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	records, err := ln.journal.Records()
+	if err != nil {
+		logger.Error("read-publish-journal-failed", err)
+		return err
+	}
+
+	for _, record := range records {
+		ln.reconcilePublish(logger, record)
+	}
+
+	return nil
+}
+
+func (ln *LocalNode) reconcilePublish(logger lager.Logger, record PublishRecord) {
+	data := lager.Data{"volume id": record.VolumeId, "target path": record.TargetPath}
+
+	if validateVolumeId(logger, record.VolumeId) != nil || ln.validateTargetPath(logger, record.TargetPath) != nil {
+		ln.dropPublish(logger, record, "invalid publish record")
+		return
+	}
+
+	mounted, err := ln.osHelper.IsMounted(record.TargetPath)
+	if err != nil {
+		// the target may well still be mounted, so keep unstage from pulling the volume out from under it
+		logger.Error("volume-is-mounted-failed", err, data)
+		ln.addPublish(record.VolumeId, record.TargetPath)
+		return
+	}
+
+	if mounted {
+		if !record.Block {
+			sameVolume, err := ln.mountedFrom(logger, record.TargetPath, record.StagingPath)
+			if err != nil {
+				logger.Error("get-mount-info-failed", err, data)
+				ln.addPublish(record.VolumeId, record.TargetPath)
+				return
+			}
+
+			if !sameVolume {
+				ln.dropPublish(logger, record, "target path is mounted from a different volume")
+				return
+			}
+		}
+
+		ln.addPublish(record.VolumeId, record.TargetPath)
+		logger.Info("publish-intact", data)
+		return
+	}
+
+	sourcePath, err := ln.stagedSource(record)
+	if err != nil {
+		logger.Error("volume-is-staged-failed", err, data)
+		ln.addPublish(record.VolumeId, record.TargetPath)
+		return
+	}
+
+	if sourcePath == "" {
+		ln.dropPublish(logger, record, "volume is no longer staged")
+		return
+	}
+
+	if record.Block && record.ReadOnly {
+		// recorded by an earlier plugin, which bound the writable device
+		ln.dropPublish(logger, record, "read-only block volumes are not supported")
+		return
+	}
+
+	if record.Block {
+		err = ln.mountBlock(logger, sourcePath, record.TargetPath)
+	} else {
+		err = ln.mount(logger, sourcePath, record.TargetPath, record.ReadOnly, record.MountFlags)
+	}
+	if err != nil {
+		logger.Error("remount-volume-failed", err, data)
+		ln.dropPublish(logger, record, "target path could not be mounted again")
+		return
+	}
+
+	ln.addPublish(record.VolumeId, record.TargetPath)
+	logger.Info("publish-repaired", data)
+}
+
+// stagedSource returns what the target of a publish is mounted from, or an
+// empty string when the volume is not staged any more.
+func (ln *LocalNode) stagedSource(record PublishRecord) (string, error) {
+	if record.Block {
+		return ln.osHelper.FindLoopDevice(ln.blockImagePath(record.VolumeId))
+	}
+
+	staged, err := ln.osHelper.IsMounted(record.StagingPath)
+	if err != nil || !staged {
+		return "", err
+	}
+	return record.StagingPath, nil
+}
+
+// dropPublish reports a publish whose mount has drifted beyond repair and
+// stops tracking it. Nothing is unmounted.
+func (ln *LocalNode) dropPublish(logger lager.Logger, record PublishRecord, reason string) {
+	logger.Info("publish-drifted", lager.Data{"volume id": record.VolumeId, "target path": record.TargetPath, "reason": reason})
+
+	err := ln.journal.Remove(record.VolumeId, record.TargetPath)
+	if err != nil {
+		logger.Error("remove-publish-record-failed", err, lager.Data{"volume id": record.VolumeId, "target path": record.TargetPath})
+	}
+}
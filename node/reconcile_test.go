@@ -0,0 +1,219 @@
+package node_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Reconcile", func() {
+	var (
+		context      context.Context
+		fakeFilepath *filepath_fake.FakeFilepath
+		fakeJournal  *nodefakes.FakePublishJournal
+		fakeOs       *os_fake.FakeOs
+		fakeOsHelper *nodefakes.FakeOsHelper
+		localNode    *node.LocalNode
+		record       node.PublishRecord
+		testLogger   *lagertest.TestLogger
+		mounted      map[string]bool
+	)
+
+	BeforeEach(func() {
+		context = &DummyContext{}
+		testLogger = lagertest.NewTestLogger("reconcile")
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+
+		record = node.PublishRecord{
+			VolumeId:    "test-volume-id",
+			TargetPath:  "/path/to/mount/test-volume-id",
+			StagingPath: "/path/to/staging/test-volume-id",
+			ReadOnly:    true,
+			MountFlags:  []string{"noexec"},
+		}
+		fakeJournal = &nodefakes.FakePublishJournal{}
+		fakeJournal.RecordsReturns([]node.PublishRecord{record}, nil)
+
+		mounted = map[string]bool{record.StagingPath: true}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+			return mounted[path], nil
+		}
+
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, "/tmp/_volumes", "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, Journal: fakeJournal})
+	})
+
+	expectStillPublished := func() {
+		_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{VolumeId: record.VolumeId, StagingTargetPath: record.StagingPath})
+		Expect(err).To(HaveOccurred())
+		grpcStatus, _ := status.FromError(err)
+		Expect(grpcStatus.Code()).To(Equal(codes.FailedPrecondition))
+	}
+
+	Context("when the target is still mounted from the volume", func() {
+		BeforeEach(func() {
+			mounted[record.TargetPath] = true
+		})
+
+		It("tracks the publish again without remounting", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(0))
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(0))
+			expectStillPublished()
+		})
+	})
+
+	Context("when the target is mounted from a different volume", func() {
+		BeforeEach(func() {
+			mounted[record.TargetPath] = true
+			fakeOsHelper.GetMountInfoStub = func(path string) (node.MountInfo, bool, error) {
+				if path == record.TargetPath {
+					return node.MountInfo{Device: "8:1", Root: "/other-volume"}, true, nil
+				}
+				return node.MountInfo{Device: "8:1", Root: "/test-volume-id"}, true, nil
+			}
+		})
+
+		It("reports the drift and drops the record without unmounting", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
+			volumeId, targetPath := fakeJournal.RemoveArgsForCall(0)
+			Expect(volumeId).To(Equal(record.VolumeId))
+			Expect(targetPath).To(Equal(record.TargetPath))
+			Expect(testLogger.Buffer()).To(gbytes.Say("publish-drifted"))
+		})
+	})
+
+	Context("when the target has lost its mount but the volume is still staged", func() {
+		It("mounts it again as it was published", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(1))
+			from, to, options := fakeOsHelper.MountReadOnlyArgsForCall(0)
+			Expect(from).To(Equal(record.StagingPath))
+			Expect(to).To(Equal(record.TargetPath))
+			Expect(options).To(Equal([]string{"noexec"}))
+
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(0))
+			expectStillPublished()
+		})
+
+		Context("when mounting fails", func() {
+			BeforeEach(func() {
+				fakeOsHelper.MountReadOnlyReturns(errors.New("mount failed"))
+			})
+
+			It("reports the drift and drops the record", func() {
+				Expect(localNode.Reconcile(testLogger)).To(Succeed())
+				Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when a read-only block publish recorded by an earlier plugin has lost its mount", func() {
+		BeforeEach(func() {
+			record.Block = true
+			record.MountFlags = nil
+			fakeJournal.RecordsReturns([]node.PublishRecord{record}, nil)
+			fakeOsHelper.FindLoopDeviceReturns("/dev/loop3", nil)
+		})
+
+		It("drops the record rather than binding the writable device", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+			Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(0))
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
+			Expect(testLogger.Buffer()).To(gbytes.Say("publish-drifted.*read-only block volumes are not supported"))
+		})
+	})
+
+	Context("when the volume is no longer staged", func() {
+		BeforeEach(func() {
+			mounted[record.StagingPath] = false
+		})
+
+		It("reports the drift and drops the record", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			Expect(fakeOsHelper.MountReadOnlyCallCount()).To(Equal(0))
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when a record has an invalid volume id", func() {
+		BeforeEach(func() {
+			record.VolumeId = "../etc"
+			fakeJournal.RecordsReturns([]node.PublishRecord{record}, nil)
+		})
+
+		It("drops the record without mounting anything", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			Expect(fakeOsHelper.IsMountedCallCount()).To(Equal(0))
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when checking the mount fails", func() {
+		BeforeEach(func() {
+			fakeOsHelper.IsMountedReturns(false, errors.New("mountinfo unreadable"))
+		})
+
+		It("keeps the record for the next start", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(0))
+		})
+
+		It("still refuses to unstage the volume", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+
+			fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+				return mounted[path], nil
+			}
+			expectStillPublished()
+		})
+	})
+
+	Context("when reading the target's mount fails", func() {
+		BeforeEach(func() {
+			mounted[record.TargetPath] = true
+			fakeOsHelper.GetMountInfoReturns(node.MountInfo{}, false, errors.New("mountinfo unreadable"))
+		})
+
+		It("keeps the volume published", func() {
+			Expect(localNode.Reconcile(testLogger)).To(Succeed())
+			Expect(fakeJournal.RemoveCallCount()).To(Equal(0))
+			expectStillPublished()
+		})
+	})
+
+	Context("when the journal cannot be read", func() {
+		BeforeEach(func() {
+			fakeJournal.RecordsReturns(nil, errors.New("corrupt journal"))
+		})
+
+		It("returns the error", func() {
+			Expect(localNode.Reconcile(testLogger)).To(MatchError("corrupt journal"))
+		})
+	})
+})
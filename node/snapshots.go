@@ -0,0 +1,349 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// A snapshot is a copy of a volume's directory or image kept under the
+// snapshots root as <snapshot id>/<source volume id>, with .img or .block
+// appended for images. Copies are reflinked where the filesystem allows, so
+// they are cheap and point-in-time. Otherwise a directory is copied file by
+// file while the volume may still be written to.
+
+const (
+	SnapshotsDir     = ".snapshots"
+	snapshotsDirMode = 0700
+)
+
+type Snapshot struct {
+	SnapshotId     string
+	SourceVolumeId string
+	CreationTime   time.Time
+	SizeBytes      int64
+}
+
+// CreateSnapshot copies the source volume into a new snapshot. Creating a
+// snapshot that already exists for the same volume returns it again.
+func (ln *LocalNode) CreateSnapshot(logger lager.Logger, snapshotId, sourceVolumeId string) (Snapshot, error) {
+	logger = logger.Session("create-snapshot", lager.Data{"snapshot id": snapshotId, "source volume id": sourceVolumeId})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if err := validateSnapshotId(logger, snapshotId); err != nil {
+		return Snapshot{}, err
+	}
+	if err := validateVolumeId(logger, sourceVolumeId); err != nil {
+		return Snapshot{}, err
+	}
+
+	unlockSnapshot, err := ln.lockSnapshot(logger, snapshotId)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer unlockSnapshot()
+
+	unlockVolume, err := ln.lockVolume(logger, sourceVolumeId, "")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer unlockVolume()
+
+	snapshot, found, err := ln.snapshot(logger, snapshotId)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if found {
+		if snapshot.SourceVolumeId != sourceVolumeId {
+			logger.Info("snapshot-exists-for-another-volume", lager.Data{"existing source volume id": snapshot.SourceVolumeId})
+			errorDescription := "Snapshot already exists for another volume"
+			return Snapshot{}, grpc.Errorf(codes.AlreadyExists, errorDescription)
+		}
+		return snapshot, nil
+	}
+
+	sourcePath, name, err := ln.volumeContent(logger, sourceVolumeId)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	tempPath := filepath.Join(ln.snapshotsRoot(), "."+snapshotId+".tmp")
+	err = ln.os.RemoveAll(tempPath)
+	if err == nil {
+		err = ln.os.MkdirAll(tempPath, snapshotsDirMode)
+	}
+	if err != nil {
+		logger.Error("create-snapshot-directory-failed", err)
+		errorDescription := "Error creating snapshot directory"
+		return Snapshot{}, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	logger.Info("copy-volume", lager.Data{"source path": sourcePath})
+	if name == sourceVolumeId {
+		err = ln.osHelper.CloneTree(sourcePath, filepath.Join(tempPath, name), ln.copyOptionsFor(logger, ln.copyOptions.LinkFallback))
+	} else {
+		err = ln.osHelper.CloneFile(sourcePath, filepath.Join(tempPath, name), ln.copyOptionsFor(logger, false))
+	}
+	if err == nil {
+		// the snapshot only appears once it is complete
+		err = ln.os.Rename(tempPath, ln.snapshotPath(snapshotId))
+	}
+	if err != nil {
+		logger.Error("copy-volume-failed", err)
+		ln.os.RemoveAll(tempPath)
+		errorDescription := "Error creating snapshot"
+		return Snapshot{}, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	snapshot, _, err = ln.snapshot(logger, snapshotId)
+	return snapshot, err
+}
+
+// DeleteSnapshot removes the snapshot. Volumes created from it are copies
+// and are left alone. Deleting a snapshot that does not exist succeeds.
+func (ln *LocalNode) DeleteSnapshot(logger lager.Logger, snapshotId string) error {
+	logger = logger.Session("delete-snapshot", lager.Data{"snapshot id": snapshotId})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if err := validateSnapshotId(logger, snapshotId); err != nil {
+		return err
+	}
+
+	unlock, err := ln.lockSnapshot(logger, snapshotId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = ln.os.RemoveAll(ln.snapshotPath(snapshotId))
+	if err != nil {
+		logger.Error("remove-snapshot-failed", err)
+		errorDescription := "Error deleting snapshot"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	ln.usage.Invalidate(ln.snapshotPath(snapshotId))
+	return nil
+}
+
+// Snapshots lists the snapshots under the snapshots root in ID order.
+func (ln *LocalNode) Snapshots(logger lager.Logger) ([]Snapshot, error) {
+	paths, err := ln.filepath.Glob(filepath.Join(ln.snapshotsRoot(), "*"))
+	if err != nil {
+		logger.Error("list-snapshots-failed", err)
+		errorDescription := "Error listing snapshots"
+		return nil, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	snapshots := []Snapshot{}
+	for _, path := range paths {
+		snapshotId := filepath.Base(path)
+		if strings.HasPrefix(snapshotId, ".") {
+			// snapshots still being copied
+			continue
+		}
+
+		snapshot, found, err := ln.snapshot(logger, snapshotId)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].SnapshotId < snapshots[j].SnapshotId })
+	return snapshots, nil
+}
+
+// snapshotSource returns the copy kept in the snapshot for a volume to be
+// restored from. The snapshot must be locked until the copy is made.
+func (ln *LocalNode) snapshotSource(logger lager.Logger, snapshotId string) (string, error) {
+	contentPath, found, err := ln.snapshotContent(logger, snapshotId)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		logger.Info("snapshot-not-found", lager.Data{"snapshot id": snapshotId})
+		errorDescription := "Snapshot does not exist"
+		return "", grpc.Errorf(codes.NotFound, errorDescription)
+	}
+
+	return contentPath, nil
+}
+
+// copyVolume creates the volume as a copy of a volume directory or image,
+// whichever srcPath is. The copy is made beside its final path and moved
+// into place once complete. It is never hard linked, or writes to the new
+// volume would change the original.
+func (ln *LocalNode) copyVolume(logger lager.Logger, volumeId, srcPath string) error {
+	srcInfo, err := ln.os.Stat(srcPath)
+	if err != nil {
+		logger.Error("stat-copy-source-failed", err)
+		errorDescription := "Error reading volume to copy"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	var volumePath, tempPath string
+	if srcInfo.IsDir() {
+		volumePath = filepath.Join(ln.volumesRootDir, volumeId)
+		tempPath = filepath.Join(ln.volumesRootDir, "."+volumeId+".tmp")
+		err = ln.mkdirAll(ln.volumesRootDir, os.ModePerm)
+	} else {
+		ext := filepath.Ext(srcPath)
+		volumePath = filepath.Join(ln.volumesRootDir, imagesDir, volumeId+ext)
+		tempPath = filepath.Join(ln.volumesRootDir, imagesDir, "."+volumeId+ext+".tmp")
+		err = ln.os.MkdirAll(filepath.Dir(volumePath), imagesDirMode)
+	}
+	if err == nil {
+		err = ln.os.RemoveAll(tempPath)
+	}
+	if err != nil {
+		logger.Error("prepare-copy-failed", err)
+		errorDescription := "Error copying volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	logger.Info("copy-volume", lager.Data{"source path": srcPath, "volume path": volumePath})
+	if srcInfo.IsDir() {
+		err = ln.osHelper.CloneTree(srcPath, tempPath, ln.copyOptionsFor(logger, false))
+	} else {
+		err = ln.osHelper.CloneFile(srcPath, tempPath, ln.copyOptionsFor(logger, false))
+	}
+	if err == nil {
+		err = ln.os.Rename(tempPath, volumePath)
+	}
+	if err != nil {
+		logger.Error("copy-volume-failed", err)
+		ln.os.RemoveAll(tempPath)
+		errorDescription := "Error copying volume"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return nil
+}
+
+// copyOptionsFor logs the progress of a copy, which can take a while for
+// large volumes on filesystems without reflinks.
+func (ln *LocalNode) copyOptionsFor(logger lager.Logger, linkFallback bool) CopyOptions {
+	options := ln.copyOptions
+	options.LinkFallback = linkFallback
+	options.Progress = func(files, bytes int64) {
+		logger.Info("copy-progress", lager.Data{"files": files, "bytes": bytes})
+	}
+	options.Skipped = func(path string, mode os.FileMode) {
+		logger.Info("copy-skipped-special-file", lager.Data{"path": path, "mode": mode.String()})
+	}
+	return options
+}
+
+// volumeContent finds what to copy for a volume: the block image of a raw
+// block volume, the directory of a directory volume, or the image of a
+// loopback volume. It returns the path along with the name to keep a copy
+// under.
+func (ln *LocalNode) volumeContent(logger lager.Logger, volumeId string) (string, string, error) {
+	volumePath := filepath.Join(ln.volumesRootDir, volumeId)
+	candidates := []struct{ path, name string }{
+		{ln.blockImagePath(volumeId), volumeId + ".block"},
+		{volumePath, volumeId},
+		{ln.imagePath(volumeId), volumeId + ".img"},
+	}
+
+	for _, candidate := range candidates {
+		exists, err := ln.exists(candidate.path)
+		if err != nil {
+			logger.Error("stat-volume-failed", err, lager.Data{"path": candidate.path})
+			errorDescription := "Error checking if volume exists"
+			return "", "", grpc.Errorf(codes.Internal, errorDescription)
+		}
+		if !exists {
+			continue
+		}
+
+		if candidate.path == volumePath {
+			err = ln.confine(logger, volumePath)
+			if err != nil {
+				return "", "", err
+			}
+		}
+		return candidate.path, candidate.name, nil
+	}
+
+	logger.Info("source-volume-not-found")
+	errorDescription := "Source volume does not exist"
+	return "", "", grpc.Errorf(codes.NotFound, errorDescription)
+}
+
+func (ln *LocalNode) snapshot(logger lager.Logger, snapshotId string) (Snapshot, bool, error) {
+	contentPath, found, err := ln.snapshotContent(logger, snapshotId)
+	if err != nil || !found {
+		return Snapshot{}, found, err
+	}
+
+	dirInfo, err := ln.os.Stat(ln.snapshotPath(snapshotId))
+	if err != nil {
+		logger.Error("stat-snapshot-failed", err)
+		errorDescription := "Error reading snapshot"
+		return Snapshot{}, false, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	contentInfo, err := ln.os.Stat(contentPath)
+	if err != nil {
+		logger.Error("stat-snapshot-content-failed", err)
+		errorDescription := "Error reading snapshot"
+		return Snapshot{}, false, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	snapshot := Snapshot{
+		SnapshotId:     snapshotId,
+		SourceVolumeId: filepath.Base(contentPath),
+		// the snapshot directory is last written when its copy is made
+		CreationTime: dirInfo.ModTime(),
+		SizeBytes:    contentInfo.Size(),
+	}
+
+	if !contentInfo.IsDir() {
+		snapshot.SourceVolumeId = strings.TrimSuffix(snapshot.SourceVolumeId, filepath.Ext(snapshot.SourceVolumeId))
+	} else {
+		usage, err := ln.usage.Usage(logger, contentPath)
+		if err != nil {
+			logger.Error("snapshot-usage-failed", err)
+			errorDescription := "Error reading snapshot size"
+			return Snapshot{}, false, grpc.Errorf(codes.Internal, errorDescription)
+		}
+		snapshot.SizeBytes = usage.UsedBytes
+	}
+
+	return snapshot, true, nil
+}
+
+// snapshotContent returns the path of the copy kept in a snapshot.
+func (ln *LocalNode) snapshotContent(logger lager.Logger, snapshotId string) (string, bool, error) {
+	paths, err := ln.filepath.Glob(filepath.Join(ln.snapshotPath(snapshotId), "*"))
+	if err != nil {
+		logger.Error("read-snapshot-failed", err)
+		errorDescription := "Error reading snapshot"
+		return "", false, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if len(paths) != 1 {
+		return "", false, nil
+	}
+	return paths[0], true, nil
+}
+
+func (ln *LocalNode) snapshotsRoot() string {
+	return filepath.Join(ln.volumesRootDir, SnapshotsDir)
+}
+
+func (ln *LocalNode) snapshotPath(snapshotId string) string {
+	return filepath.Join(ln.snapshotsRoot(), snapshotId)
+}
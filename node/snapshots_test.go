@@ -0,0 +1,296 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+)
+
+var _ = Describe("Snapshots", func() {
+	var (
+		err           error
+		fakeFilepath  *filepath_fake.FakeFilepath
+		fakeOs        *os_fake.FakeOs
+		fakeOsHelper  *nodefakes.FakeOsHelper
+		fakeUsage     *nodefakes.FakeUsageAccountant
+		linkSnapshots bool
+		localNode     *node.LocalNode
+		snapshotsRoot string
+		testLogger    *lagertest.TestLogger
+		volumesRoot   string
+		existing      map[string]os.FileInfo
+		snapshotFiles map[string][]string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		snapshotsRoot = filepath.Join(volumesRoot, ".snapshots")
+		testLogger = lagertest.NewTestLogger("snapshots")
+		linkSnapshots = false
+
+		existing = map[string]os.FileInfo{}
+		snapshotFiles = map[string][]string{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+			if info, ok := existing[path]; ok {
+				return info, nil
+			}
+			return nil, os.ErrNotExist
+		}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeFilepath.GlobStub = func(pattern string) ([]string, error) {
+			return snapshotFiles[pattern], nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeUsage = &nodefakes.FakeUsageAccountant{}
+	})
+
+	JustBeforeEach(func() {
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, volumesRoot, "some-node-id", node.Options{Usage: fakeUsage, Journal: &nodefakes.FakePublishJournal{}, ControllerService: true, Copy: node.CopyOptions{LinkFallback: linkSnapshots, Workers: 4}})
+	})
+
+	// storeSnapshot makes a snapshot appear on disk once it is renamed into place
+	storeSnapshot := func(name string, info os.FileInfo) {
+		fakeOs.RenameStub = func(oldpath, newpath string) error {
+			existing[newpath] = &FakeFileInfo{FileMode: os.ModeDir}
+			existing[filepath.Join(newpath, name)] = info
+			snapshotFiles[filepath.Join(newpath, "*")] = []string{filepath.Join(newpath, name)}
+			return nil
+		}
+	}
+
+	Describe("CreateSnapshot", func() {
+		var snapshot node.Snapshot
+
+		JustBeforeEach(func() {
+			snapshot, err = localNode.CreateSnapshot(testLogger, "test-snapshot-id", "test-volume-id")
+		})
+
+		Context("when the volume is a directory", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, "test-volume-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+				storeSnapshot("test-volume-id", &FakeFileInfo{FileMode: os.ModeDir})
+				fakeUsage.UsageReturns(node.VolumeUsage{UsedBytes: 4096}, nil)
+			})
+
+			It("copies the directory into a temporary directory and moves it into place", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				tempPath := filepath.Join(snapshotsRoot, ".test-snapshot-id.tmp")
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(1))
+				path, perm := fakeOs.MkdirAllArgsForCall(0)
+				Expect(path).To(Equal(tempPath))
+				Expect(perm).To(Equal(os.FileMode(0700)))
+
+				Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(1))
+				src, dst, options := fakeOsHelper.CloneTreeArgsForCall(0)
+				Expect(src).To(Equal(filepath.Join(volumesRoot, "test-volume-id")))
+				Expect(dst).To(Equal(filepath.Join(tempPath, "test-volume-id")))
+				Expect(options.LinkFallback).To(BeFalse())
+				Expect(options.Workers).To(Equal(4))
+
+				Expect(fakeOs.RenameCallCount()).To(Equal(1))
+				oldpath, newpath := fakeOs.RenameArgsForCall(0)
+				Expect(oldpath).To(Equal(tempPath))
+				Expect(newpath).To(Equal(filepath.Join(snapshotsRoot, "test-snapshot-id")))
+
+				Expect(snapshot.SnapshotId).To(Equal("test-snapshot-id"))
+				Expect(snapshot.SourceVolumeId).To(Equal("test-volume-id"))
+				Expect(snapshot.SizeBytes).To(Equal(int64(4096)))
+			})
+
+			Context("when hard link snapshots are enabled", func() {
+				BeforeEach(func() {
+					linkSnapshots = true
+				})
+
+				It("lets the copy fall back to hard links", func() {
+					_, _, options := fakeOsHelper.CloneTreeArgsForCall(0)
+					Expect(options.LinkFallback).To(BeTrue())
+				})
+			})
+
+			Context("when the copy fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.CloneTreeReturns(errors.New("no space left on device"))
+				})
+
+				It("cleans up the partial copy", func() {
+					Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error creating snapshot"))
+					Expect(fakeOs.RenameCallCount()).To(Equal(0))
+					Expect(fakeOs.RemoveAllArgsForCall(fakeOs.RemoveAllCallCount() - 1)).To(Equal(filepath.Join(snapshotsRoot, ".test-snapshot-id.tmp")))
+				})
+			})
+		})
+
+		Context("when the volume is a loopback image", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, ".images", "test-volume-id.img")] = &sizedFileInfo{size: 1073741824}
+				storeSnapshot("test-volume-id.img", &sizedFileInfo{size: 1073741824})
+			})
+
+			It("copies the image", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.CloneFileCallCount()).To(Equal(1))
+				src, dst, _ := fakeOsHelper.CloneFileArgsForCall(0)
+				Expect(src).To(Equal(filepath.Join(volumesRoot, ".images", "test-volume-id.img")))
+				Expect(dst).To(Equal(filepath.Join(snapshotsRoot, ".test-snapshot-id.tmp", "test-volume-id.img")))
+
+				Expect(snapshot.SourceVolumeId).To(Equal("test-volume-id"))
+				Expect(snapshot.SizeBytes).To(Equal(int64(1073741824)))
+			})
+		})
+
+		Context("when the snapshot already exists", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(snapshotsRoot, "test-snapshot-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+				existing[filepath.Join(snapshotsRoot, "test-snapshot-id", "other-volume-id.img")] = &sizedFileInfo{}
+				snapshotFiles[filepath.Join(snapshotsRoot, "test-snapshot-id", "*")] = []string{filepath.Join(snapshotsRoot, "test-snapshot-id", "other-volume-id.img")}
+			})
+
+			It("refuses to reuse it for another volume", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.AlreadyExists, "Snapshot already exists for another volume"))
+				Expect(fakeOsHelper.CloneFileCallCount()).To(Equal(0))
+			})
+
+			Context("for the same volume", func() {
+				BeforeEach(func() {
+					existing[filepath.Join(snapshotsRoot, "test-snapshot-id", "test-volume-id.img")] = &sizedFileInfo{}
+					snapshotFiles[filepath.Join(snapshotsRoot, "test-snapshot-id", "*")] = []string{filepath.Join(snapshotsRoot, "test-snapshot-id", "test-volume-id.img")}
+				})
+
+				It("returns it without copying the volume again", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(snapshot.SourceVolumeId).To(Equal("test-volume-id"))
+					Expect(fakeOsHelper.CloneFileCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the volume does not exist", func() {
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.NotFound, "Source volume does not exist"))
+			})
+		})
+	})
+
+	Describe("DeleteSnapshot", func() {
+		It("removes the snapshot directory", func() {
+			Expect(localNode.DeleteSnapshot(testLogger, "test-snapshot-id")).To(Succeed())
+			Expect(fakeOs.RemoveAllArgsForCall(0)).To(Equal(filepath.Join(snapshotsRoot, "test-snapshot-id")))
+			Expect(fakeUsage.InvalidateArgsForCall(0)).To(Equal(filepath.Join(snapshotsRoot, "test-snapshot-id")))
+		})
+
+		It("rejects unsafe snapshot IDs", func() {
+			err = localNode.DeleteSnapshot(testLogger, "../test-volume-id")
+			Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Snapshot ID is invalid"))
+			Expect(fakeOs.RemoveAllCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Snapshots", func() {
+		BeforeEach(func() {
+			snapshotFiles[filepath.Join(snapshotsRoot, "*")] = []string{
+				filepath.Join(snapshotsRoot, "b-snapshot"),
+				filepath.Join(snapshotsRoot, ".c-snapshot.tmp"),
+				filepath.Join(snapshotsRoot, "a-snapshot"),
+			}
+			for _, snapshotId := range []string{"a-snapshot", "b-snapshot"} {
+				contentPath := filepath.Join(snapshotsRoot, snapshotId, "test-volume-id.block")
+				existing[filepath.Join(snapshotsRoot, snapshotId)] = &FakeFileInfo{FileMode: os.ModeDir}
+				existing[contentPath] = &sizedFileInfo{}
+				snapshotFiles[filepath.Join(snapshotsRoot, snapshotId, "*")] = []string{contentPath}
+			}
+		})
+
+		It("lists completed snapshots in ID order", func() {
+			snapshots, err := localNode.Snapshots(testLogger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(HaveLen(2))
+			Expect(snapshots[0].SnapshotId).To(Equal("a-snapshot"))
+			Expect(snapshots[1].SnapshotId).To(Equal("b-snapshot"))
+			Expect(snapshots[1].SourceVolumeId).To(Equal("test-volume-id"))
+		})
+	})
+
+	Describe("ProvisionVolume from a snapshot", func() {
+		JustBeforeEach(func() {
+			_, err = localNode.ProvisionVolume(testLogger, "new-volume-id", node.VolumeSpec{SnapshotId: "test-snapshot-id"})
+		})
+
+		Context("when the snapshot is of a directory", func() {
+			BeforeEach(func() {
+				contentPath := filepath.Join(snapshotsRoot, "test-snapshot-id", "test-volume-id")
+				existing[contentPath] = &FakeFileInfo{FileMode: os.ModeDir}
+				snapshotFiles[filepath.Join(snapshotsRoot, "test-snapshot-id", "*")] = []string{contentPath}
+			})
+
+			It("copies the snapshot into the new volume without hard linking", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				tempPath := filepath.Join(volumesRoot, ".new-volume-id.tmp")
+				Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(1))
+				src, dst, options := fakeOsHelper.CloneTreeArgsForCall(0)
+				Expect(src).To(Equal(filepath.Join(snapshotsRoot, "test-snapshot-id", "test-volume-id")))
+				Expect(dst).To(Equal(tempPath))
+				Expect(options.LinkFallback).To(BeFalse())
+
+				oldpath, newpath := fakeOs.RenameArgsForCall(0)
+				Expect(oldpath).To(Equal(tempPath))
+				Expect(newpath).To(Equal(filepath.Join(volumesRoot, "new-volume-id")))
+			})
+		})
+
+		Context("when the snapshot is of an image", func() {
+			BeforeEach(func() {
+				contentPath := filepath.Join(snapshotsRoot, "test-snapshot-id", "test-volume-id.block")
+				existing[contentPath] = &sizedFileInfo{}
+				snapshotFiles[filepath.Join(snapshotsRoot, "test-snapshot-id", "*")] = []string{contentPath}
+			})
+
+			It("copies the image into the new volume's image", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				_, dst, _ := fakeOsHelper.CloneFileArgsForCall(0)
+				Expect(dst).To(Equal(filepath.Join(volumesRoot, ".images", ".new-volume-id.block.tmp")))
+
+				_, newpath := fakeOs.RenameArgsForCall(0)
+				Expect(newpath).To(Equal(filepath.Join(volumesRoot, ".images", "new-volume-id.block")))
+			})
+		})
+
+		Context("when the volume already exists", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, "new-volume-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+			})
+
+			It("leaves it alone", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.CloneFileCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the snapshot does not exist", func() {
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.NotFound, "Snapshot does not exist"))
+			})
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// validateTargetPath rejects staging and target paths that are not strictly
+// beneath one of the allowed target roots. Every path is allowed when no
+// roots are configured.
+func (ns *LocalNode) validateTargetPath(logger lager.Logger, path string) error {
+	if len(ns.allowedTargetRoots) == 0 {
+		return nil
+	}
+
+	rel, ok, err := ns.targetRoot(path)
+	if err != nil {
+		logger.Error("resolve-target-path-failed", err, lager.Data{"path": path})
+		errorDescription := "Error resolving target path"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	if !ok || rel == "." {
+		logger.Info("target-path-not-allowed", lager.Data{"path": path, "allowed": ns.allowedTargetRoots})
+		errorDescription := "Target path is outside the allowed mount roots"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return nil
+}
+
+// targetRoot resolves symlinks in path and in each allowed root and reports
+// where path lies relative to the first root that contains it.
+func (ns *LocalNode) targetRoot(path string) (string, bool, error) {
+	if !filepath.IsAbs(path) {
+		return "", false, nil
+	}
+
+	resolved, err := ns.resolvePath(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, root := range ns.allowedTargetRoots {
+		resolvedRoot, err := ns.resolvePath(root)
+		if err != nil {
+			return "", false, err
+		}
+
+		rel, err := filepath.Rel(resolvedRoot, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		return rel, true, nil
+	}
+
+	return "", false, nil
+}
+
+// resolvePath evaluates symlinks in the longest existing prefix of path, so
+// that paths which are about to be created can be checked too.
+func (ns *LocalNode) resolvePath(path string) (string, error) {
+	path = filepath.Clean(path)
+	rest := ""
+	for {
+		resolved, err := ns.filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
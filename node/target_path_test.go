@@ -0,0 +1,219 @@
+package node_test
+
+import (
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Allowed Target Roots", func() {
+	var (
+		context          context.Context
+		fakeFilepath     *filepath_fake.FakeFilepath
+		fakeOs           *os_fake.FakeOs
+		fakeOsHelper     *nodefakes.FakeOsHelper
+		localNode        *node.LocalNode
+		publishRequest   *csi.NodePublishVolumeRequest
+		volumeCapability *csi.VolumeCapability
+		mountRoot        string
+	)
+
+	BeforeEach(func() {
+		mountRoot = "/var/vcap/data/volumes"
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeOsHelper.IsMountedStub = func(path string) (bool, error) {
+			return strings.Contains(path, "staging"), nil
+		}
+
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("target-roots"), "/tmp/_volumes", "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, AllowedTargetRoots: []string{mountRoot}, Journal: &nodefakes.FakePublishJournal{}})
+		volumeCapability = &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}
+
+		publishRequest = &csi.NodePublishVolumeRequest{
+			VolumeId:          "test-volume-id",
+			StagingTargetPath: mountRoot + "/staging/test-volume-id",
+			TargetPath:        mountRoot + "/mounts/test-volume-id",
+			VolumeCapability:  volumeCapability,
+		}
+	})
+
+	expectRejected := func(err error) {
+		Expect(err).To(HaveOccurred())
+		grpcStatus, _ := status.FromError(err)
+		Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+		Expect(grpcStatus.Message()).To(Equal("Target path is outside the allowed mount roots"))
+	}
+
+	Describe("NodePublishVolume", func() {
+		It("mounts targets beneath an allowed root", func() {
+			_, err := localNode.NodePublishVolume(context, publishRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+		})
+
+		Context("when the target does not exist yet", func() {
+			BeforeEach(func() {
+				fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+					if strings.HasPrefix(path, mountRoot+"/mounts") {
+						return "", os.ErrNotExist
+					}
+					return path, nil
+				}
+			})
+
+			It("resolves it through its closest existing parent", func() {
+				_, err := localNode.NodePublishVolume(context, publishRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the target is outside every allowed root", func() {
+			BeforeEach(func() {
+				publishRequest.TargetPath = "/etc/test-volume-id"
+			})
+
+			It("returns an error without creating or mounting it", func() {
+				_, err := localNode.NodePublishVolume(context, publishRequest)
+				expectRejected(err)
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the target climbs out of the root", func() {
+			BeforeEach(func() {
+				publishRequest.TargetPath = mountRoot + "/../../../etc"
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodePublishVolume(context, publishRequest)
+				expectRejected(err)
+			})
+		})
+
+		Context("when the target is the allowed root itself", func() {
+			BeforeEach(func() {
+				publishRequest.TargetPath = mountRoot
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodePublishVolume(context, publishRequest)
+				expectRejected(err)
+			})
+		})
+
+		Context("when the target is relative", func() {
+			BeforeEach(func() {
+				publishRequest.TargetPath = "mounts/test-volume-id"
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodePublishVolume(context, publishRequest)
+				expectRejected(err)
+			})
+		})
+
+		Context("when a directory beneath the root is a symlink out of it", func() {
+			BeforeEach(func() {
+				fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+					if strings.HasPrefix(path, mountRoot+"/mounts") {
+						return "/etc" + strings.TrimPrefix(path, mountRoot+"/mounts"), nil
+					}
+					return path, nil
+				}
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.NodePublishVolume(context, publishRequest)
+				expectRejected(err)
+				Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("NodeUnpublishVolume", func() {
+		It("does not unmount or remove targets outside the allowed roots", func() {
+			fakeOsHelper.IsMountedReturns(true, nil)
+
+			_, err := localNode.NodeUnpublishVolume(context, &csi.NodeUnpublishVolumeRequest{VolumeId: "test-volume-id", TargetPath: "/etc"})
+			expectRejected(err)
+			Expect(fakeOsHelper.UnmountCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("NodeStageVolume", func() {
+		It("rejects staging paths outside the allowed roots", func() {
+			_, err := localNode.NodeStageVolume(context, &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume-id",
+				StagingTargetPath: "/etc/staging",
+				VolumeCapability:  volumeCapability,
+			})
+			expectRejected(err)
+			Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("NodeUnstageVolume", func() {
+		It("does not remove staging paths outside the allowed roots", func() {
+			_, err := localNode.NodeUnstageVolume(context, &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "test-volume-id",
+				StagingTargetPath: "/etc/staging",
+			})
+			expectRejected(err)
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("NodeGetVolumeStats", func() {
+		It("does not stat paths outside the allowed roots", func() {
+			_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: "test-volume-id", VolumePath: "/etc"})
+			expectRejected(err)
+			Expect(fakeOsHelper.StatfsCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("NodeExpandVolume", func() {
+		It("does not grow filesystems mounted outside the allowed roots", func() {
+			_, err := localNode.NodeExpandVolume(context, &csi.NodeExpandVolumeRequest{
+				VolumeId:      "test-volume-id",
+				VolumePath:    "/etc",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2147483648},
+			})
+			expectRejected(err)
+			Expect(fakeOsHelper.GrowFilesystemCallCount()).To(Equal(0))
+		})
+
+		It("does not grow staging paths outside the allowed roots", func() {
+			_, err := localNode.NodeExpandVolume(context, &csi.NodeExpandVolumeRequest{
+				VolumeId:          "test-volume-id",
+				VolumePath:        mountRoot + "/mounts/test-volume-id",
+				StagingTargetPath: "/etc",
+				CapacityRange:     &csi.CapacityRange{RequiredBytes: 2147483648},
+			})
+			expectRejected(err)
+			Expect(fakeOsHelper.GrowFilesystemCallCount()).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,161 @@
+package node
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/goshims/filepathshim"
+	"code.cloudfoundry.org/lager"
+)
+
+// Local volumes are plain directories sharing the filesystem under the volumes
+// root, so statfs only reports host-wide numbers. The usage accountant walks
+// each volume directory to work out what the volume itself is consuming,
+// counting the blocks allocated to its files, so sparse files count for what
+// they take up on disk, and files hard linked more than once only once.
+
+//go:generate counterfeiter -o nodefakes/fake_usage_accountant.go . UsageAccountant
+type UsageAccountant interface {
+	Usage(logger lager.Logger, volumePath string) (VolumeUsage, error)
+	// Invalidate forgets the usage of the path and of any path beneath it,
+	// so that a volume or snapshot created there later is walked afresh.
+	Invalidate(path string)
+}
+
+type VolumeUsage struct {
+	UsedBytes  int64
+	UsedInodes int64
+}
+
+type usageEntry struct {
+	usage      VolumeUsage
+	computedAt time.Time
+}
+
+type dirUsageAccountant struct {
+	filepath        filepathshim.Filepath
+	clock           clock.Clock
+	refreshInterval time.Duration
+	walkSlots       chan struct{}
+
+	cacheLock sync.Mutex
+	cache     map[string]usageEntry
+}
+
+func NewDirUsageAccountant(
+	filepath filepathshim.Filepath,
+	clock clock.Clock,
+	refreshInterval time.Duration,
+	maxConcurrentWalks int,
+) UsageAccountant {
+	if maxConcurrentWalks < 1 {
+		maxConcurrentWalks = 1
+	}
+
+	return &dirUsageAccountant{
+		filepath:        filepath,
+		clock:           clock,
+		refreshInterval: refreshInterval,
+		walkSlots:       make(chan struct{}, maxConcurrentWalks),
+		cache:           map[string]usageEntry{},
+	}
+}
+
+func (a *dirUsageAccountant) Usage(logger lager.Logger, volumePath string) (VolumeUsage, error) {
+	logger = logger.Session("usage", lager.Data{"volumePath": volumePath})
+
+	entry, cached := a.cached(volumePath)
+	if cached && a.clock.Since(entry.computedAt) < a.refreshInterval {
+		logger.Debug("cache-hit", lager.Data{"usage": entry.usage})
+		return entry.usage, nil
+	}
+
+	select {
+	case a.walkSlots <- struct{}{}:
+	default:
+		if cached {
+			// other walks are already hammering the disk, a slightly stale answer will do
+			logger.Info("walk-throttled-returning-stale-usage", lager.Data{"usage": entry.usage})
+			return entry.usage, nil
+		}
+		a.walkSlots <- struct{}{}
+	}
+	defer func() { <-a.walkSlots }()
+
+	// another caller may have refreshed the entry while we were waiting for a slot
+	entry, cached = a.cached(volumePath)
+	if cached && a.clock.Since(entry.computedAt) < a.refreshInterval {
+		return entry.usage, nil
+	}
+
+	started := a.clock.Now()
+	usage, err := a.walk(volumePath)
+	if err != nil {
+		logger.Error("walk-failed", err)
+		return VolumeUsage{}, err
+	}
+	logger.Info("walked", lager.Data{"usage": usage, "duration": a.clock.Since(started).String()})
+
+	a.cacheLock.Lock()
+	a.cache[volumePath] = usageEntry{usage: usage, computedAt: a.clock.Now()}
+	a.cacheLock.Unlock()
+
+	return usage, nil
+}
+
+func (a *dirUsageAccountant) Invalidate(path string) {
+	a.cacheLock.Lock()
+	defer a.cacheLock.Unlock()
+
+	for cachedPath := range a.cache {
+		if cachedPath == path || strings.HasPrefix(cachedPath, path+"/") {
+			delete(a.cache, cachedPath)
+		}
+	}
+}
+
+func (a *dirUsageAccountant) cached(volumePath string) (usageEntry, bool) {
+	a.cacheLock.Lock()
+	defer a.cacheLock.Unlock()
+
+	entry, ok := a.cache[volumePath]
+	return entry, ok
+}
+
+func (a *dirUsageAccountant) walk(volumePath string) (VolumeUsage, error) {
+	usage := VolumeUsage{}
+	linked := map[fileKey]bool{}
+	err := a.filepath.Walk(volumePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files can disappear while the application is running, that is not an error
+			if os.IsNotExist(err) && path != volumePath {
+				return nil
+			}
+			return err
+		}
+
+		bytes, key, hardLinked := diskUsage(info)
+		if hardLinked && !info.IsDir() {
+			if linked[key] {
+				return nil
+			}
+			linked[key] = true
+		}
+
+		usage.UsedInodes++
+		usage.UsedBytes += bytes
+		return nil
+	})
+
+	return usage, err
+}
+
+func apparentSize(info os.FileInfo) int64 {
+	if !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,138 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DirUsageAccountant", func() {
+	var (
+		accountant   node.UsageAccountant
+		fakeClock    *fakeclock.FakeClock
+		fakeFilepath *filepath_fake.FakeFilepath
+		testLogger   lager.Logger
+		usage        node.VolumeUsage
+		err          error
+		volumePath   string
+	)
+
+	BeforeEach(func() {
+		volumePath = "/tmp/_volumes/test-volume-id"
+		testLogger = lagertest.NewTestLogger("usage-accountant")
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.WalkStub = func(root string, walkFn filepath.WalkFunc) error {
+			dir := newFakeFileInfo()
+			dir.StubMode(os.ModeDir)
+			Expect(walkFn(root, dir, nil)).To(Succeed())
+			Expect(walkFn(filepath.Join(root, "a"), &sizedFileInfo{size: 100}, nil)).To(Succeed())
+			Expect(walkFn(filepath.Join(root, "b"), &sizedFileInfo{size: 23}, nil)).To(Succeed())
+			return nil
+		}
+
+		accountant = node.NewDirUsageAccountant(fakeFilepath, fakeClock, time.Minute, 1)
+	})
+
+	JustBeforeEach(func() {
+		usage, err = accountant.Usage(testLogger, volumePath)
+	})
+
+	It("walks the volume directory and sums the bytes and inodes", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage).To(Equal(node.VolumeUsage{UsedBytes: 123, UsedInodes: 3}))
+
+		Expect(fakeFilepath.WalkCallCount()).To(Equal(1))
+		root, _ := fakeFilepath.WalkArgsForCall(0)
+		Expect(root).To(Equal(volumePath))
+	})
+
+	Context("when the usage was computed within the refresh interval", func() {
+		It("returns the cached usage without walking again", func() {
+			fakeClock.Increment(30 * time.Second)
+
+			usage, err = accountant.Usage(testLogger, volumePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(usage).To(Equal(node.VolumeUsage{UsedBytes: 123, UsedInodes: 3}))
+			Expect(fakeFilepath.WalkCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when the refresh interval has elapsed", func() {
+		It("walks the volume directory again", func() {
+			fakeClock.Increment(2 * time.Minute)
+
+			_, err = accountant.Usage(testLogger, volumePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFilepath.WalkCallCount()).To(Equal(2))
+		})
+	})
+
+	Context("when the usage is invalidated", func() {
+		It("walks the volume directory again", func() {
+			accountant.Invalidate(volumePath)
+
+			_, err = accountant.Usage(testLogger, volumePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeFilepath.WalkCallCount()).To(Equal(2))
+		})
+
+		It("forgets the usage of paths beneath the invalidated one", func() {
+			accountant.Invalidate("/tmp/_volumes")
+
+			_, err = accountant.Usage(testLogger, volumePath)
+			Expect(fakeFilepath.WalkCallCount()).To(Equal(2))
+		})
+
+		It("keeps the usage of paths that only share a prefix", func() {
+			accountant.Invalidate("/tmp/_volumes/test-volume")
+
+			_, err = accountant.Usage(testLogger, volumePath)
+			Expect(fakeFilepath.WalkCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when a file disappears during the walk", func() {
+		BeforeEach(func() {
+			fakeFilepath.WalkStub = func(root string, walkFn filepath.WalkFunc) error {
+				Expect(walkFn(filepath.Join(root, "gone"), nil, os.ErrNotExist)).To(Succeed())
+				return walkFn(filepath.Join(root, "a"), &sizedFileInfo{size: 7}, nil)
+			}
+		})
+
+		It("skips the file", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(usage).To(Equal(node.VolumeUsage{UsedBytes: 7, UsedInodes: 1}))
+		})
+	})
+
+	Context("when the walk fails", func() {
+		BeforeEach(func() {
+			fakeFilepath.WalkReturns(errors.New("permission denied"))
+		})
+
+		It("returns the error and does not cache anything", func() {
+			Expect(err).To(MatchError("permission denied"))
+
+			_, err = accountant.Usage(testLogger, volumePath)
+			Expect(fakeFilepath.WalkCallCount()).To(Equal(2))
+		})
+	})
+})
+
+type sizedFileInfo struct {
+	FakeFileInfo
+	size int64
+}
+
+func (fi *sizedFileInfo) Size() int64 { return fi.size }
@@ -0,0 +1,25 @@
+// +build linux darwin
+
+package node
+
+import (
+	"os"
+	"syscall"
+)
+
+type fileKey struct {
+	device uint64
+	inode  uint64
+}
+
+// diskUsage returns the bytes allocated to the file, its device and inode,
+// and whether other hard links may share them.
+func diskUsage(info os.FileInfo) (int64, fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return apparentSize(info), fileKey{}, false
+	}
+
+	// st_blocks is always counted in 512 byte units, whatever the filesystem's block size
+	return stat.Blocks * 512, fileKey{device: uint64(stat.Dev), inode: uint64(stat.Ino)}, stat.Nlink > 1
+}
@@ -0,0 +1,67 @@
+// +build linux darwin
+
+package node_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DirUsageAccountant on unix", func() {
+	var (
+		accountant   node.UsageAccountant
+		fakeFilepath *filepath_fake.FakeFilepath
+		files        []os.FileInfo
+	)
+
+	BeforeEach(func() {
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.WalkStub = func(root string, walkFn filepath.WalkFunc) error {
+			for i, info := range files {
+				Expect(walkFn(filepath.Join(root, fmt.Sprintf("file-%d", i)), info, nil)).To(Succeed())
+			}
+			return nil
+		}
+
+		accountant = node.NewDirUsageAccountant(fakeFilepath, fakeclock.NewFakeClock(time.Now()), time.Minute, 1)
+	})
+
+	usage := func() node.VolumeUsage {
+		usage, err := accountant.Usage(lagertest.NewTestLogger("usage-accountant"), "/tmp/_volumes/test-volume-id")
+		Expect(err).NotTo(HaveOccurred())
+		return usage
+	}
+
+	It("counts the blocks allocated to sparse files rather than their size", func() {
+		files = []os.FileInfo{&statFileInfo{size: 1 << 30, stat: syscall.Stat_t{Dev: 1, Ino: 10, Nlink: 1, Blocks: 8}}}
+		Expect(usage()).To(Equal(node.VolumeUsage{UsedBytes: 4096, UsedInodes: 1}))
+	})
+
+	It("counts files hard linked more than once only once", func() {
+		files = []os.FileInfo{
+			&statFileInfo{stat: syscall.Stat_t{Dev: 1, Ino: 10, Nlink: 2, Blocks: 8}},
+			&statFileInfo{stat: syscall.Stat_t{Dev: 1, Ino: 11, Nlink: 1, Blocks: 16}},
+			&statFileInfo{stat: syscall.Stat_t{Dev: 1, Ino: 10, Nlink: 2, Blocks: 8}},
+		}
+		Expect(usage()).To(Equal(node.VolumeUsage{UsedBytes: 12288, UsedInodes: 2}))
+	})
+})
+
+type statFileInfo struct {
+	FakeFileInfo
+	size int64
+	stat syscall.Stat_t
+}
+
+func (fi *statFileInfo) Size() int64      { return fi.size }
+func (fi *statFileInfo) Sys() interface{} { return &fi.stat }
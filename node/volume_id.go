@@ -0,0 +1,75 @@
+package node
+
+import (
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// CSI caps volume IDs at 128 bytes, which also keeps image file names well
+// under NAME_MAX
+const maxVolumeIdLength = 128
+
+// validateVolumeId rejects volume IDs that could not safely be used as a
+// single file name under the volumes root. Names starting with a dot are kept
+// for the plugin's own directories there, such as .images, .snapshots and
+// .state.
+func validateVolumeId(logger lager.Logger, volumeId string) error {
+	if !isSafeName(volumeId) {
+		logger.Info("invalid-volume-id", lager.Data{"volume id": volumeId})
+		errorDescription := "Volume ID is invalid"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return nil
+}
+
+// validateSnapshotId holds snapshot IDs to the same rules, as they name a
+// directory under the snapshots root.
+func validateSnapshotId(logger lager.Logger, snapshotId string) error {
+	if !isSafeName(snapshotId) {
+		logger.Info("invalid-snapshot-id", lager.Data{"snapshot id": snapshotId})
+		errorDescription := "Snapshot ID is invalid"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return nil
+}
+
+func isSafeName(name string) bool {
+	return len(name) <= maxVolumeIdLength &&
+		!strings.ContainsAny(name, "/\\\x00") &&
+		!strings.Contains(name, "..") &&
+		!strings.HasPrefix(name, ".")
+}
+
+// confine checks that path, once symlinks are resolved, is still inside the
+// volumes root. A volume directory that has been replaced with a symlink
+// would otherwise let a volume write anywhere on the host.
+func (ns *LocalNode) confine(logger lager.Logger, path string) error {
+	root, err := ns.filepath.EvalSymlinks(ns.volumesRootDir)
+	if err != nil {
+		logger.Error("eval-volumes-root-symlinks-failed", err)
+		errorDescription := "Error resolving volumes root directory"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	resolved, err := ns.filepath.EvalSymlinks(path)
+	if err != nil {
+		logger.Error("eval-volume-path-symlinks-failed", err, lager.Data{"path": path})
+		errorDescription := "Error resolving volume path"
+		return grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		logger.Info("volume-path-outside-root", lager.Data{"path": path, "resolved": resolved, "root": root})
+		errorDescription := "Volume path is outside the volumes root directory"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package node_test
+
+import (
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Volume IDs", func() {
+	var (
+		context      context.Context
+		fakeFilepath *filepath_fake.FakeFilepath
+		fakeOs       *os_fake.FakeOs
+		fakeOsHelper *nodefakes.FakeOsHelper
+		localNode    *node.LocalNode
+		request      *csi.NodeStageVolumeRequest
+		volumesRoot  string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		context = &DummyContext{}
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.AbsStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, lagertest.NewTestLogger("volume-ids"), volumesRoot, "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, Journal: &nodefakes.FakePublishJournal{}})
+
+		request = &csi.NodeStageVolumeRequest{
+			VolumeId:          "test-volume-id",
+			StagingTargetPath: "/path/to/staging/test-volume-id",
+			VolumeCapability:  &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+		}
+	})
+
+	expectInvalid := func(volumeId string) {
+		request.VolumeId = volumeId
+		_, err := localNode.NodeStageVolume(context, request)
+		Expect(err).To(HaveOccurred())
+		grpcStatus, _ := status.FromError(err)
+		Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+		Expect(grpcStatus.Message()).To(Equal("Volume ID is invalid"))
+		Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+		Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+	}
+
+	It("accepts plain volume IDs", func() {
+		_, err := localNode.NodeStageVolume(context, request)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("when the volume ID contains a path separator", func() {
+		It("returns an error", func() {
+			expectInvalid("../../etc")
+			expectInvalid("a/b")
+			expectInvalid(`a\b`)
+		})
+	})
+
+	Context("when the volume ID is a relative path element", func() {
+		It("returns an error", func() {
+			expectInvalid("..")
+			expectInvalid(".")
+		})
+	})
+
+	Context("when the volume ID contains a NUL byte", func() {
+		It("returns an error", func() {
+			expectInvalid("volume\x00id")
+		})
+	})
+
+	Context("when the volume ID is too long", func() {
+		It("returns an error", func() {
+			expectInvalid(strings.Repeat("a", 129))
+		})
+	})
+
+	Context("when the volume ID names the images directory", func() {
+		It("returns an error", func() {
+			expectInvalid(".images")
+		})
+	})
+
+	Context("when the volume directory is a symlink out of the volumes root", func() {
+		BeforeEach(func() {
+			fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+				if path == filepath.Join(volumesRoot, "test-volume-id") {
+					return "/etc", nil
+				}
+				return path, nil
+			}
+		})
+
+		It("returns an error without mounting it", func() {
+			_, err := localNode.NodeStageVolume(context, request)
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+			Expect(grpcStatus.Message()).To(Equal("Volume path is outside the volumes root directory"))
+			Expect(fakeOsHelper.MountCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the volume ID is invalid on another RPC", func() {
+		It("returns an error", func() {
+			_, err := localNode.NodeGetVolumeStats(context, &csi.NodeGetVolumeStatsRequest{VolumeId: "../other"})
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+
+			_, err = localNode.NodeUnpublishVolume(context, &csi.NodeUnpublishVolumeRequest{VolumeId: "../other", TargetPath: "/some/target"})
+			Expect(err).To(HaveOccurred())
+			grpcStatus, _ = status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+		})
+	})
+})
@@ -0,0 +1,136 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Nothing on disk says which snapshot or volume a volume was copied from, or
+// which backend and capacity it was created for, so they are kept beside the
+// publish journal. Creating the volume again is checked against them.
+
+// VolumeSpecsDir is where volume specs are kept under the state directory
+const VolumeSpecsDir = "volumes"
+
+type VolumeSpec struct {
+	SnapshotId     string `json:"snapshot_id,omitempty"`
+	SourceVolumeId string `json:"source_volume_id,omitempty"`
+	Backend        string `json:"backend,omitempty"`
+	CapacityBytes  int64  `json:"capacity_bytes,omitempty"`
+}
+
+//go:generate counterfeiter -o nodefakes/fake_volume_specs.go . VolumeSpecs
+type VolumeSpecs interface {
+	Spec(volumeId string) (VolumeSpec, bool, error)
+	Record(volumeId string, spec VolumeSpec) error
+	Remove(volumeId string) error
+}
+
+type fileVolumeSpecs struct {
+	dir string
+}
+
+// NewFileVolumeSpecs keeps each volume's spec as a JSON file in dir, which is
+// created when the first spec is recorded.
+func NewFileVolumeSpecs(dir string) VolumeSpecs {
+	return &fileVolumeSpecs{dir: dir}
+}
+
+func (s *fileVolumeSpecs) Spec(volumeId string) (VolumeSpec, bool, error) {
+	var spec VolumeSpec
+
+	data, err := ioutil.ReadFile(s.path(volumeId))
+	if os.IsNotExist(err) {
+		return spec, false, nil
+	}
+	if err != nil {
+		return spec, false, err
+	}
+
+	err = json.Unmarshal(data, &spec)
+	if err != nil {
+		return spec, false, err
+	}
+	return spec, true, nil
+}
+
+func (s *fileVolumeSpecs) Record(volumeId string, spec VolumeSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	err = os.Mkdir(s.dir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, volumeId+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(volumeId))
+}
+
+func (s *fileVolumeSpecs) Remove(volumeId string) error {
+	err := os.Remove(s.path(volumeId))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *fileVolumeSpecs) path(volumeId string) string {
+	return filepath.Join(s.dir, volumeId+".json")
+}
+
+type memoryVolumeSpecs struct {
+	lock  sync.Mutex
+	specs map[string]VolumeSpec
+}
+
+// NewMemoryVolumeSpecs keeps volume specs in memory only, so volumes created
+// before a restart are taken to be compatible with any request.
+func NewMemoryVolumeSpecs() VolumeSpecs {
+	return &memoryVolumeSpecs{specs: map[string]VolumeSpec{}}
+}
+
+func (s *memoryVolumeSpecs) Spec(volumeId string) (VolumeSpec, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	spec, ok := s.specs[volumeId]
+	return spec, ok, nil
+}
+
+func (s *memoryVolumeSpecs) Record(volumeId string, spec VolumeSpec) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.specs[volumeId] = spec
+	return nil
+}
+
+func (s *memoryVolumeSpecs) Remove(volumeId string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.specs, volumeId)
+	return nil
+}
@@ -0,0 +1,91 @@
+package node_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VolumeSpecs", func() {
+	var spec node.VolumeSpec
+
+	BeforeEach(func() {
+		spec = node.VolumeSpec{SnapshotId: "test-snapshot-id", Backend: node.LoopbackBackend, CapacityBytes: 1073741824}
+	})
+
+	Describe("FileVolumeSpecs", func() {
+		var (
+			specs    node.VolumeSpecs
+			stateDir string
+		)
+
+		BeforeEach(func() {
+			var err error
+			stateDir, err = ioutil.TempDir("", "volume-specs")
+			Expect(err).NotTo(HaveOccurred())
+
+			specs = node.NewFileVolumeSpecs(filepath.Join(stateDir, node.VolumeSpecsDir))
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(stateDir)
+		})
+
+		It("reports a volume without a spec as not found", func() {
+			_, found, err := specs.Spec("test-volume-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("keeps recorded specs across instances", func() {
+			Expect(specs.Record("test-volume-id", spec)).To(Succeed())
+
+			reopened := node.NewFileVolumeSpecs(filepath.Join(stateDir, node.VolumeSpecsDir))
+			recorded, found, err := reopened.Spec("test-volume-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(recorded).To(Equal(spec))
+		})
+
+		It("keeps the specs readable only by the plugin", func() {
+			Expect(specs.Record("test-volume-id", spec)).To(Succeed())
+
+			info, err := os.Stat(filepath.Join(stateDir, node.VolumeSpecsDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+		})
+
+		It("removes specs", func() {
+			Expect(specs.Record("test-volume-id", spec)).To(Succeed())
+			Expect(specs.Remove("test-volume-id")).To(Succeed())
+
+			_, found, err := specs.Spec("test-volume-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("ignores removing a spec that was never recorded", func() {
+			Expect(specs.Remove("test-volume-id")).To(Succeed())
+		})
+	})
+
+	Describe("MemoryVolumeSpecs", func() {
+		It("records and removes specs", func() {
+			specs := node.NewMemoryVolumeSpecs()
+			Expect(specs.Record("test-volume-id", spec)).To(Succeed())
+
+			recorded, found, err := specs.Spec("test-volume-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(recorded).To(Equal(spec))
+
+			Expect(specs.Remove("test-volume-id")).To(Succeed())
+			_, found, _ = specs.Spec("test-volume-id")
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,298 @@
+package node
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// The volumes root is the only record of which volumes exist, so an embedded
+// controller asks the node to create, find and list them rather than keeping
+// a catalogue of its own.
+
+// ProvisionVolume creates the directory of a new volume, or copies the
+// snapshot or source volume the spec names into it. It returns the spec the
+// volume was created with, so that the backend and capacity a copy takes on
+// from its source are passed on when it is staged. Creating a volume that
+// already exists succeeds if the spec is compatible with the one it was
+// created with.
+func (ln *LocalNode) ProvisionVolume(logger lager.Logger, volumeId string, spec VolumeSpec) (VolumeSpec, error) {
+	logger = logger.Session("provision-volume", lager.Data{"volume id": volumeId, "spec": spec})
+
+	if err := ln.validateVolumeSpec(logger, volumeId, spec); err != nil {
+		return VolumeSpec{}, err
+	}
+
+	unlock, err := ln.lockVolume(logger, volumeId, "")
+	if err != nil {
+		return VolumeSpec{}, err
+	}
+	defer unlock()
+
+	if spec.SourceVolumeId != "" {
+		unlockSource, err := ln.lockVolume(logger, spec.SourceVolumeId, "")
+		if err != nil {
+			return VolumeSpec{}, err
+		}
+		defer unlockSource()
+	}
+
+	if spec.SnapshotId != "" {
+		unlockSnapshot, err := ln.lockSnapshot(logger, spec.SnapshotId)
+		if err != nil {
+			return VolumeSpec{}, err
+		}
+		defer unlockSnapshot()
+	}
+
+	existing, found, err := ln.specs.Spec(volumeId)
+	if err != nil {
+		logger.Error("read-volume-spec-failed", err)
+		errorDescription := "Error reading volume spec"
+		return VolumeSpec{}, grpc.Errorf(codes.Internal, errorDescription)
+	}
+	if found {
+		if !compatibleSpec(existing, spec) {
+			logger.Info("volume-exists-with-another-spec", lager.Data{"existing spec": existing})
+			errorDescription := "Volume already exists with a different source, capacity or backend"
+			return VolumeSpec{}, grpc.Errorf(codes.AlreadyExists, errorDescription)
+		}
+		return existing, nil
+	}
+
+	exists, err := ln.VolumeExists(logger, volumeId)
+	if err != nil {
+		return VolumeSpec{}, err
+	}
+	if exists {
+		// created before specs were kept, so there is nothing to compare with
+		logger.Info("volume-exists-without-spec")
+		return spec, nil
+	}
+
+	var contentPath string
+	switch {
+	case spec.SnapshotId != "":
+		contentPath, err = ln.snapshotSource(logger, spec.SnapshotId)
+	case spec.SourceVolumeId != "":
+		contentPath, _, err = ln.volumeContent(logger, spec.SourceVolumeId)
+	}
+	if err != nil {
+		return VolumeSpec{}, err
+	}
+
+	if contentPath == "" {
+		if spec.Backend == "" {
+			spec.Backend = ln.defaultBackend
+		}
+		_, err = ln.volumePath(logger, volumeId)
+	} else {
+		spec, err = ln.copySpec(logger, spec, contentPath)
+		if err == nil {
+			err = ln.copyVolume(logger, volumeId, contentPath)
+		}
+	}
+	if err != nil {
+		return VolumeSpec{}, err
+	}
+
+	err = ln.specs.Record(volumeId, spec)
+	if err != nil {
+		logger.Error("record-volume-spec-failed", err)
+		errorDescription := "Error recording volume spec"
+		return VolumeSpec{}, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return spec, nil
+}
+
+func (ln *LocalNode) validateVolumeSpec(logger lager.Logger, volumeId string, spec VolumeSpec) error {
+	if err := validateVolumeId(logger, volumeId); err != nil {
+		return err
+	}
+
+	if spec.SnapshotId != "" && spec.SourceVolumeId != "" {
+		errorDescription := "Volume cannot be created from both a snapshot and a volume"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if spec.SnapshotId != "" {
+		if err := validateSnapshotId(logger, spec.SnapshotId); err != nil {
+			return err
+		}
+	}
+
+	if spec.SourceVolumeId != "" {
+		if err := validateVolumeId(logger, spec.SourceVolumeId); err != nil {
+			return err
+		}
+		if spec.SourceVolumeId == volumeId {
+			errorDescription := "Volume cannot be cloned from itself"
+			return grpc.Errorf(codes.InvalidArgument, errorDescription)
+		}
+	}
+
+	if spec.Backend != "" && !IsValidBackend(spec.Backend) {
+		logger.Info("unsupported-backend", lager.Data{"backend": spec.Backend})
+		errorDescription := fmt.Sprintf("Volume backend %s is not supported", spec.Backend)
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	if spec.CapacityBytes < 0 {
+		errorDescription := "Volume capacity cannot be negative"
+		return grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+
+	return nil
+}
+
+// copySpec works out the backend and capacity of a copy of contentPath. The
+// copy is stored the same way as its source, so a directory can only become
+// a directory volume and an image a loopback or block volume of at least the
+// image's size.
+func (ln *LocalNode) copySpec(logger lager.Logger, spec VolumeSpec, contentPath string) (VolumeSpec, error) {
+	info, err := ln.os.Stat(contentPath)
+	if err != nil {
+		logger.Error("stat-copy-source-failed", err)
+		errorDescription := "Error reading volume to copy"
+		return VolumeSpec{}, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	backend := DirectoryBackend
+	switch {
+	case info.IsDir():
+	case filepath.Ext(contentPath) == ".img":
+		backend = LoopbackBackend
+	default:
+		// block volumes are staged by their access type whatever the backend
+		backend = spec.Backend
+	}
+
+	if spec.Backend != "" && spec.Backend != backend {
+		logger.Info("backend-does-not-match-source", lager.Data{"source backend": backend})
+		errorDescription := fmt.Sprintf("Volume backend %s does not match the source, which is stored as %s", spec.Backend, backend)
+		return VolumeSpec{}, grpc.Errorf(codes.InvalidArgument, errorDescription)
+	}
+	spec.Backend = backend
+
+	if !info.IsDir() {
+		if spec.CapacityBytes > info.Size() {
+			logger.Info("capacity-exceeds-source", lager.Data{"source size": info.Size()})
+			errorDescription := "Volume capacity exceeds the size of the source image, expand the volume once it is created instead"
+			return VolumeSpec{}, grpc.Errorf(codes.InvalidArgument, errorDescription)
+		}
+		spec.CapacityBytes = info.Size()
+	}
+
+	return spec, nil
+}
+
+// compatibleSpec reports whether a request for the spec can be answered
+// with a volume created for the existing spec: the same source, the backend
+// if one was asked for and at least the capacity asked for.
+func compatibleSpec(existing, requested VolumeSpec) bool {
+	if existing.SnapshotId != requested.SnapshotId || existing.SourceVolumeId != requested.SourceVolumeId {
+		return false
+	}
+	if requested.Backend != "" && requested.Backend != existing.Backend {
+		return false
+	}
+	if requested.CapacityBytes > 0 && existing.CapacityBytes != requested.CapacityBytes {
+		// images are never smaller than asked for, but a quota is set to exactly the capacity
+		return existing.CapacityBytes > requested.CapacityBytes && existing.Backend != DirectoryBackend
+	}
+	return true
+}
+
+// VolumeExists reports whether the volume has a directory or an image under
+// the volumes root.
+func (ln *LocalNode) VolumeExists(logger lager.Logger, volumeId string) (bool, error) {
+	if err := validateVolumeId(logger, volumeId); err != nil {
+		return false, err
+	}
+
+	for _, path := range []string{filepath.Join(ln.volumesRootDir, volumeId), ln.imagePath(volumeId), ln.blockImagePath(volumeId)} {
+		exists, err := ln.exists(path)
+		if err != nil {
+			logger.Error("stat-volume-failed", err, lager.Data{"path": path})
+			errorDescription := "Error checking if volume exists"
+			return false, grpc.Errorf(codes.Internal, errorDescription)
+		}
+		if exists {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// VolumeIds lists the volumes under the volumes root in ID order.
+func (ln *LocalNode) VolumeIds(logger lager.Logger) ([]string, error) {
+	patterns := map[string]string{
+		filepath.Join(ln.volumesRootDir, "*"):                  "",
+		filepath.Join(ln.volumesRootDir, imagesDir, "*.img"):   ".img",
+		filepath.Join(ln.volumesRootDir, imagesDir, "*.block"): ".block",
+	}
+
+	found := map[string]bool{}
+	for pattern, ext := range patterns {
+		paths, err := ln.filepath.Glob(pattern)
+		if err != nil {
+			logger.Error("list-volumes-failed", err, lager.Data{"pattern": pattern})
+			errorDescription := "Error listing volumes"
+			return nil, grpc.Errorf(codes.Internal, errorDescription)
+		}
+
+		for _, path := range paths {
+			volumeId := strings.TrimSuffix(filepath.Base(path), ext)
+			if !strings.HasPrefix(volumeId, ".") {
+				found[volumeId] = true
+			}
+		}
+	}
+
+	volumeIds := []string{}
+	for volumeId := range found {
+		volumeIds = append(volumeIds, volumeId)
+	}
+	sort.Strings(volumeIds)
+
+	return volumeIds, nil
+}
+
+// CheckVolumeCapabilities validates each capability against the backend the
+// volume context selects, as staging the volume would.
+func (ln *LocalNode) CheckVolumeCapabilities(logger lager.Logger, volumeContext map[string]string, capabilities []*csi.VolumeCapability) error {
+	backend, err := ln.backend(logger, volumeContext)
+	if err != nil {
+		return err
+	}
+
+	for _, vc := range capabilities {
+		err = ln.validateVolumeCapability(logger, vc, backend)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AvailableCapacity reports the free space of the filesystem under the
+// volumes root.
+func (ln *LocalNode) AvailableCapacity(logger lager.Logger) (int64, error) {
+	stats, err := ln.osHelper.Statfs(ln.volumesRootDir)
+	if err != nil {
+		logger.Error("statfs-volumes-root-failed", err)
+		errorDescription := "Error reading available capacity"
+		return 0, grpc.Errorf(codes.Internal, errorDescription)
+	}
+
+	return stats.AvailableBytes, nil
+}
@@ -0,0 +1,425 @@
+package node_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/filepathshim/filepath_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/local-node-plugin/matchers"
+	"code.cloudfoundry.org/local-node-plugin/node"
+	"code.cloudfoundry.org/local-node-plugin/node/nodefakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Volumes", func() {
+	var (
+		fakeFilepath *filepath_fake.FakeFilepath
+		fakeOs       *os_fake.FakeOs
+		fakeOsHelper *nodefakes.FakeOsHelper
+		fakeSpecs    *nodefakes.FakeVolumeSpecs
+		localNode    *node.LocalNode
+		testLogger   *lagertest.TestLogger
+		volumesRoot  string
+	)
+
+	BeforeEach(func() {
+		volumesRoot = "/tmp/_volumes"
+		testLogger = lagertest.NewTestLogger("volumes")
+
+		fakeOs = &os_fake.FakeOs{}
+		fakeFilepath = &filepath_fake.FakeFilepath{}
+		fakeFilepath.EvalSymlinksStub = func(path string) (string, error) {
+			return path, nil
+		}
+		fakeOsHelper = &nodefakes.FakeOsHelper{}
+		fakeSpecs = &nodefakes.FakeVolumeSpecs{}
+
+		localNode = node.NewLocalNode(fakeOs, fakeOsHelper, fakeFilepath, testLogger, volumesRoot, "some-node-id", node.Options{Usage: &nodefakes.FakeUsageAccountant{}, Journal: &nodefakes.FakePublishJournal{}, Specs: fakeSpecs, ControllerService: true})
+	})
+
+	Describe("ProvisionVolume", func() {
+		var (
+			volumeId string
+			spec     node.VolumeSpec
+			result   node.VolumeSpec
+			err      error
+			existing map[string]os.FileInfo
+		)
+
+		BeforeEach(func() {
+			volumeId = "test-volume-id"
+			spec = node.VolumeSpec{CapacityBytes: 1073741824}
+			existing = map[string]os.FileInfo{}
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if info, ok := existing[path]; ok {
+					return info, nil
+				}
+				return nil, os.ErrNotExist
+			}
+		})
+
+		JustBeforeEach(func() {
+			result, err = localNode.ProvisionVolume(testLogger, volumeId, spec)
+		})
+
+		It("creates the volume directory and records its spec with the default backend", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOs.MkdirAllCallCount()).To(Equal(1))
+			path, _ := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(filepath.Join(volumesRoot, "test-volume-id")))
+
+			Expect(result).To(Equal(node.VolumeSpec{Backend: node.DirectoryBackend, CapacityBytes: 1073741824}))
+			Expect(fakeSpecs.RecordCallCount()).To(Equal(1))
+			recordedId, recorded := fakeSpecs.RecordArgsForCall(0)
+			Expect(recordedId).To(Equal("test-volume-id"))
+			Expect(recorded).To(Equal(result))
+		})
+
+		Context("when the volume ID is unsafe", func() {
+			BeforeEach(func() {
+				volumeId = "../etc"
+			})
+
+			It("rejects it", func() {
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume was already created with the same spec", func() {
+			BeforeEach(func() {
+				fakeSpecs.SpecReturns(node.VolumeSpec{Backend: node.DirectoryBackend, CapacityBytes: 1073741824}, true, nil)
+			})
+
+			It("returns the spec it was created with without creating it again", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(node.VolumeSpec{Backend: node.DirectoryBackend, CapacityBytes: 1073741824}))
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+				Expect(fakeSpecs.RecordCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume was created with a different capacity", func() {
+			BeforeEach(func() {
+				fakeSpecs.SpecReturns(node.VolumeSpec{Backend: node.DirectoryBackend, CapacityBytes: 2147483648}, true, nil)
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.AlreadyExists, "Volume already exists with a different source, capacity or backend"))
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the volume was created with a different backend", func() {
+			BeforeEach(func() {
+				spec.Backend = node.LoopbackBackend
+				fakeSpecs.SpecReturns(node.VolumeSpec{Backend: node.DirectoryBackend, CapacityBytes: 1073741824}, true, nil)
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.AlreadyExists, "Volume already exists with a different source, capacity or backend"))
+			})
+		})
+
+		Context("when the volume was created from a source", func() {
+			BeforeEach(func() {
+				fakeSpecs.SpecReturns(node.VolumeSpec{SnapshotId: "test-snapshot-id", Backend: node.DirectoryBackend, CapacityBytes: 1073741824}, true, nil)
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.AlreadyExists, "Volume already exists with a different source, capacity or backend"))
+			})
+		})
+
+		Context("when a loopback volume was created larger than asked for", func() {
+			BeforeEach(func() {
+				fakeSpecs.SpecReturns(node.VolumeSpec{Backend: node.LoopbackBackend, CapacityBytes: 2147483648}, true, nil)
+			})
+
+			It("returns the spec it was created with", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.CapacityBytes).To(Equal(int64(2147483648)))
+			})
+		})
+
+		Context("when the volume exists without a spec", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, "test-volume-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+			})
+
+			It("leaves it alone", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+				Expect(fakeSpecs.RecordCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the spec cannot be recorded", func() {
+			BeforeEach(func() {
+				fakeSpecs.RecordReturns(errors.New("disk full"))
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.Internal, "Error recording volume spec"))
+			})
+		})
+
+		Context("when the backend is not supported", func() {
+			BeforeEach(func() {
+				spec.Backend = "tmpfs"
+			})
+
+			It("returns an error", func() {
+				Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume backend tmpfs is not supported"))
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("ProvisionVolume from another volume", func() {
+		var (
+			spec     node.VolumeSpec
+			result   node.VolumeSpec
+			err      error
+			existing map[string]os.FileInfo
+		)
+
+		BeforeEach(func() {
+			spec = node.VolumeSpec{SourceVolumeId: "golden-volume-id"}
+			existing = map[string]os.FileInfo{}
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if info, ok := existing[path]; ok {
+					return info, nil
+				}
+				return nil, os.ErrNotExist
+			}
+		})
+
+		JustBeforeEach(func() {
+			result, err = localNode.ProvisionVolume(testLogger, "new-volume-id", spec)
+		})
+
+		Context("when the source is a directory", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, "golden-volume-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+			})
+
+			It("copies it beside the new volume and moves it into place", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				tempPath := filepath.Join(volumesRoot, ".new-volume-id.tmp")
+				Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(1))
+				src, dst, options := fakeOsHelper.CloneTreeArgsForCall(0)
+				Expect(src).To(Equal(filepath.Join(volumesRoot, "golden-volume-id")))
+				Expect(dst).To(Equal(tempPath))
+				Expect(options.LinkFallback).To(BeFalse())
+
+				Expect(fakeOs.RenameCallCount()).To(Equal(1))
+				oldpath, newpath := fakeOs.RenameArgsForCall(0)
+				Expect(oldpath).To(Equal(tempPath))
+				Expect(newpath).To(Equal(filepath.Join(volumesRoot, "new-volume-id")))
+			})
+
+			It("records that the volume is a directory copied from the source", func() {
+				Expect(result).To(Equal(node.VolumeSpec{SourceVolumeId: "golden-volume-id", Backend: node.DirectoryBackend}))
+				_, recorded := fakeSpecs.RecordArgsForCall(0)
+				Expect(recorded).To(Equal(result))
+			})
+
+			Context("when a different backend is asked for", func() {
+				BeforeEach(func() {
+					spec.Backend = node.LoopbackBackend
+				})
+
+				It("returns an error", func() {
+					Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume backend loopback does not match the source, which is stored as directory"))
+					Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(0))
+				})
+			})
+
+			It("logs the progress of the copy", func() {
+				_, _, options := fakeOsHelper.CloneTreeArgsForCall(0)
+				options.Progress(3, 4096)
+				Expect(testLogger.Buffer()).To(gbytes.Say(`copy-progress.*"bytes":4096,"files":3`))
+			})
+
+			It("logs the special files left out of the copy", func() {
+				_, _, options := fakeOsHelper.CloneTreeArgsForCall(0)
+				options.Skipped("/path/to/app.sock", os.ModeSocket|0755)
+				Expect(testLogger.Buffer()).To(gbytes.Say(`copy-skipped-special-file.*Srwxr-xr-x.*/path/to/app.sock`))
+			})
+
+			Context("when the copy fails", func() {
+				BeforeEach(func() {
+					fakeOsHelper.CloneTreeReturns(errors.New("permission denied"))
+				})
+
+				It("removes the partial copy", func() {
+					grpcStatus, _ := status.FromError(err)
+					Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+					Expect(grpcStatus.Message()).To(Equal("Error copying volume"))
+					Expect(fakeOs.RenameCallCount()).To(Equal(0))
+					Expect(fakeOs.RemoveAllArgsForCall(fakeOs.RemoveAllCallCount() - 1)).To(Equal(filepath.Join(volumesRoot, ".new-volume-id.tmp")))
+				})
+			})
+		})
+
+		Context("when the source is a loopback image", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, ".images", "golden-volume-id.img")] = &sizedFileInfo{size: 2147483648}
+			})
+
+			It("copies the image", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeOsHelper.CloneFileCallCount()).To(Equal(1))
+				src, dst, _ := fakeOsHelper.CloneFileArgsForCall(0)
+				Expect(src).To(Equal(filepath.Join(volumesRoot, ".images", "golden-volume-id.img")))
+				Expect(dst).To(Equal(filepath.Join(volumesRoot, ".images", ".new-volume-id.img.tmp")))
+
+				_, newpath := fakeOs.RenameArgsForCall(0)
+				Expect(newpath).To(Equal(filepath.Join(volumesRoot, ".images", "new-volume-id.img")))
+			})
+
+			It("takes the loopback backend and the size of the image", func() {
+				Expect(result).To(Equal(node.VolumeSpec{SourceVolumeId: "golden-volume-id", Backend: node.LoopbackBackend, CapacityBytes: 2147483648}))
+			})
+
+			Context("when a smaller capacity is asked for", func() {
+				BeforeEach(func() {
+					spec.CapacityBytes = 1073741824
+				})
+
+				It("keeps the size of the image", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.CapacityBytes).To(Equal(int64(2147483648)))
+				})
+			})
+
+			Context("when a larger capacity is asked for", func() {
+				BeforeEach(func() {
+					spec.CapacityBytes = 4294967296
+				})
+
+				It("returns an error", func() {
+					Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume capacity exceeds the size of the source image, expand the volume once it is created instead"))
+					Expect(fakeOsHelper.CloneFileCallCount()).To(Equal(0))
+					Expect(fakeSpecs.RecordCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the volume already exists", func() {
+			BeforeEach(func() {
+				existing[filepath.Join(volumesRoot, "golden-volume-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+				existing[filepath.Join(volumesRoot, "new-volume-id")] = &FakeFileInfo{FileMode: os.ModeDir}
+			})
+
+			It("leaves it alone", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOsHelper.CloneTreeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the source volume does not exist", func() {
+			It("returns an error", func() {
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.NotFound))
+				Expect(grpcStatus.Message()).To(Equal("Source volume does not exist"))
+			})
+		})
+
+		It("refuses to create a volume from both a snapshot and a volume", func() {
+			_, err := localNode.ProvisionVolume(testLogger, "new-volume-id", node.VolumeSpec{SnapshotId: "test-snapshot-id", SourceVolumeId: "golden-volume-id"})
+			Expect(err).To(matchers.HaveGrpcStatus(codes.InvalidArgument, "Volume cannot be created from both a snapshot and a volume"))
+		})
+
+		It("refuses to clone a volume onto itself", func() {
+			_, err := localNode.ProvisionVolume(testLogger, "golden-volume-id", node.VolumeSpec{SourceVolumeId: "golden-volume-id"})
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("VolumeExists", func() {
+		It("finds volumes by their directory or image", func() {
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if path == filepath.Join(volumesRoot, ".images", "block-volume.block") {
+					return &sizedFileInfo{}, nil
+				}
+				return nil, os.ErrNotExist
+			}
+
+			Expect(localNode.VolumeExists(testLogger, "block-volume")).To(BeTrue())
+			Expect(localNode.VolumeExists(testLogger, "missing-volume")).To(BeFalse())
+		})
+	})
+
+	Describe("VolumeIds", func() {
+		BeforeEach(func() {
+			fakeFilepath.GlobStub = func(pattern string) ([]string, error) {
+				switch pattern {
+				case filepath.Join(volumesRoot, "*"):
+					return []string{filepath.Join(volumesRoot, "b-volume"), filepath.Join(volumesRoot, ".images"), filepath.Join(volumesRoot, ".state")}, nil
+				case filepath.Join(volumesRoot, ".images", "*.img"):
+					return []string{filepath.Join(volumesRoot, ".images", "b-volume.img")}, nil
+				case filepath.Join(volumesRoot, ".images", "*.block"):
+					return []string{filepath.Join(volumesRoot, ".images", "a-volume.block")}, nil
+				}
+				return nil, nil
+			}
+		})
+
+		It("lists each volume once in ID order, leaving out the plugin's own directories", func() {
+			Expect(localNode.VolumeIds(testLogger)).To(Equal([]string{"a-volume", "b-volume"}))
+		})
+
+		Context("when the volumes root cannot be read", func() {
+			BeforeEach(func() {
+				fakeFilepath.GlobReturns(nil, errors.New("bad pattern"))
+			})
+
+			It("returns an error", func() {
+				_, err := localNode.VolumeIds(testLogger)
+				grpcStatus, _ := status.FromError(err)
+				Expect(grpcStatus.Code()).To(Equal(codes.Internal))
+			})
+		})
+	})
+
+	Describe("CheckVolumeCapabilities", func() {
+		It("accepts capabilities the volume's backend supports", func() {
+			Expect(localNode.CheckVolumeCapabilities(testLogger, map[string]string{node.BackendAttribute: node.LoopbackBackend}, []*csi.VolumeCapability{
+				{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+			})).To(Succeed())
+		})
+
+		It("rejects capabilities it does not", func() {
+			err := localNode.CheckVolumeCapabilities(testLogger, nil, []*csi.VolumeCapability{
+				{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER}},
+			})
+			grpcStatus, _ := status.FromError(err)
+			Expect(grpcStatus.Code()).To(Equal(codes.InvalidArgument))
+			Expect(grpcStatus.Message()).To(Equal("Volume access mode MULTI_NODE_MULTI_WRITER is not supported"))
+		})
+	})
+
+	Describe("AvailableCapacity", func() {
+		It("reports the free space under the volumes root", func() {
+			fakeOsHelper.StatfsReturns(node.FilesystemStats{AvailableBytes: 1073741824}, nil)
+
+			Expect(localNode.AvailableCapacity(testLogger)).To(Equal(int64(1073741824)))
+			Expect(fakeOsHelper.StatfsArgsForCall(0)).To(Equal(volumesRoot))
+		})
+	})
+})
@@ -0,0 +1,458 @@
+// +build linux
+
+package oshelper
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+)
+
+// from linux/fs.h
+const ficlone = 0x40049409
+
+const copyChunkSize = 1 << 20
+
+const progressInterval = 5 * time.Second
+
+// CloneFile copies srcPath to dstPath, sharing its extents when the
+// filesystem supports reflinks and otherwise copying it sparsely.
+func (o *osHelper) CloneFile(srcPath string, dstPath string, options node.CopyOptions) error {
+	info, err := os.Lstat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	options.LinkFallback = false
+	cloner := newTreeCloner(options)
+	defer cloner.stop()
+
+	return cloner.cloneFile(srcPath, dstPath, info)
+}
+
+// CloneTree copies the directory tree at srcPath to dstPath, which must not
+// exist. Regular files are reflinked when the filesystem supports it.
+// Otherwise they are hard linked when options.LinkFallback is set, which is
+// quick but lets in-place writes to the source show through, or copied by
+// options.Workers at once.
+func (o *osHelper) CloneTree(srcPath string, dstPath string, options node.CopyOptions) error {
+	cloner := newTreeCloner(options)
+	defer cloner.stop()
+
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	files := make(chan cloneJob)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range files {
+				if cloner.failed() == nil {
+					cloner.fail(cloner.cloneFile(job.srcPath, job.dstPath, job.info))
+				}
+			}
+		}()
+	}
+
+	dirs := []cloneJob{}
+	err := filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := cloner.failed(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstPath, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			// read-only directories only get their mode once their files are in
+			err = os.Mkdir(target, 0700)
+			if err == nil {
+				dirs = append(dirs, cloneJob{path, target, info})
+			}
+		case mode&os.ModeSymlink != 0:
+			var link string
+			link, err = os.Readlink(path)
+			if err == nil {
+				err = os.Symlink(link, target)
+			}
+			if err == nil {
+				err = preserveAttributes(path, target, info)
+			}
+		case mode.IsRegular():
+			files <- cloneJob{path, target, info}
+		default:
+			// sockets, fifos and devices are not volume content
+			if options.Skipped != nil {
+				options.Skipped(path, mode)
+			}
+		}
+		return err
+	})
+	close(files)
+	wg.Wait()
+
+	if err == nil {
+		err = cloner.failed()
+	}
+	if err != nil {
+		return err
+	}
+
+	// deepest first, so adding a directory's entries cannot change its times
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = preserveAttributes(dirs[i].srcPath, dirs[i].dstPath, dirs[i].info)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type cloneJob struct {
+	srcPath string
+	dstPath string
+	info    os.FileInfo
+}
+
+// treeCloner copies the files of one tree, possibly from several goroutines.
+// It stops trying reflinks after the first one the filesystem rejects, as it
+// will reject every other file on it too.
+type treeCloner struct {
+	noReflink int32
+	link      bool
+	throttle  *throttle
+
+	files    int64
+	bytes    int64
+	progress func(files, bytes int64)
+	stopped  chan struct{}
+	finished chan struct{}
+
+	errLock sync.Mutex
+	err     error
+}
+
+func newTreeCloner(options node.CopyOptions) *treeCloner {
+	c := &treeCloner{link: options.LinkFallback}
+	if options.BytesPerSecond > 0 {
+		c.throttle = &throttle{bytesPerSecond: options.BytesPerSecond}
+	}
+	if options.Progress != nil {
+		c.progress = options.Progress
+		c.stopped = make(chan struct{})
+		c.finished = make(chan struct{})
+		go c.reportProgress()
+	}
+	return c
+}
+
+func (c *treeCloner) reportProgress() {
+	defer close(c.finished)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.progress(atomic.LoadInt64(&c.files), atomic.LoadInt64(&c.bytes))
+		case <-c.stopped:
+			c.progress(atomic.LoadInt64(&c.files), atomic.LoadInt64(&c.bytes))
+			return
+		}
+	}
+}
+
+// stop reports the final progress before returning.
+func (c *treeCloner) stop() {
+	if c.progress == nil {
+		return
+	}
+	close(c.stopped)
+	<-c.finished
+}
+
+func (c *treeCloner) fail(err error) {
+	if err == nil {
+		return
+	}
+	c.errLock.Lock()
+	defer c.errLock.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *treeCloner) failed() error {
+	c.errLock.Lock()
+	defer c.errLock.Unlock()
+	return c.err
+}
+
+func (c *treeCloner) cloneFile(srcPath, dstPath string, info os.FileInfo) error {
+	linked, err := c.copyFile(srcPath, dstPath)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&c.files, 1)
+	atomic.AddInt64(&c.bytes, info.Size())
+
+	if linked {
+		// a hard link is the source file itself
+		return nil
+	}
+	return preserveAttributes(srcPath, dstPath, info)
+}
+
+func (c *treeCloner) copyFile(srcPath, dstPath string) (bool, error) {
+	if atomic.LoadInt32(&c.noReflink) == 0 {
+		err := reflink(srcPath, dstPath)
+		if !reflinkUnsupported(err) {
+			return false, err
+		}
+		atomic.StoreInt32(&c.noReflink, 1)
+	}
+
+	if c.link {
+		return true, os.Link(srcPath, dstPath)
+	}
+	return false, sparseCopy(srcPath, dstPath, c.throttle)
+}
+
+func reflink(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	dst.Close()
+	if errno != 0 {
+		os.Remove(dstPath)
+		return errno
+	}
+
+	return nil
+}
+
+func reflinkUnsupported(err error) bool {
+	switch err {
+	case syscall.EOPNOTSUPP, syscall.ENOTTY, syscall.EXDEV, syscall.EINVAL:
+		return true
+	}
+	return false
+}
+
+// sparseCopy skips over blocks of zeroes rather than writing them, so sparse
+// loopback images stay sparse.
+func sparseCopy(srcPath, dstPath string, t *throttle) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = copySparse(dst, src, t)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+	return err
+}
+
+func copySparse(dst, src *os.File, t *throttle) error {
+	buf := make([]byte, copyChunkSize)
+	var size int64
+
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if isZero(buf[:n]) {
+				_, err := dst.Seek(int64(n), io.SeekCurrent)
+				if err != nil {
+					return err
+				}
+			} else {
+				t.wait(n)
+				_, err := dst.Write(buf[:n])
+				if err != nil {
+					return err
+				}
+			}
+			size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// a trailing hole is only recorded by the file size
+	err := dst.Truncate(size)
+	if err != nil {
+		return err
+	}
+	return dst.Sync()
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// throttle spreads writes out so that they average no more than
+// bytesPerSecond, however many goroutines share it. The clock starts with the
+// first write, so time spent walking the tree is not credited to the copy.
+type throttle struct {
+	bytesPerSecond int64
+
+	lock  sync.Mutex
+	start time.Time
+	bytes int64
+}
+
+func (t *throttle) wait(n int) {
+	if t == nil {
+		return
+	}
+
+	t.lock.Lock()
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	t.bytes += int64(n)
+	// in floating point, as bytes times a second in nanoseconds overflows
+	// after a few gigabytes
+	due := t.start.Add(time.Duration(float64(t.bytes) / float64(t.bytesPerSecond) * float64(time.Second)))
+	t.lock.Unlock()
+
+	time.Sleep(time.Until(due))
+}
+
+// preserveAttributes gives the copy the owner, extended attributes, mode and
+// modification time of the original. Ownership goes first, as chown clears
+// file capabilities and the setuid and setgid bits.
+func preserveAttributes(srcPath, dstPath string, info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		err := os.Lchown(dstPath, int(stat.Uid), int(stat.Gid))
+		if err != nil {
+			return err
+		}
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	err := copyXattrs(srcPath, dstPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(dstPath, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(dstPath, info.ModTime(), info.ModTime())
+}
+
+// copyXattrs copies extended attributes such as ACLs and security labels,
+// unless either filesystem does not support them.
+func copyXattrs(srcPath, dstPath string) error {
+	names, err := xattr(func(buf []byte) (int, error) { return syscall.Listxattr(srcPath, buf) })
+	if err == syscall.ENOTSUP {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		value, err := xattr(func(buf []byte) (int, error) { return syscall.Getxattr(srcPath, string(name), buf) })
+		if err == syscall.ENODATA {
+			// removed since it was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = syscall.Setxattr(dstPath, string(name), value, 0)
+		if err == syscall.ENOTSUP {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xattr reads a value whose size is only known by asking, retrying if it
+// grows in between.
+func xattr(read func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		size, err = read(buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package oshelper
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+)
+
+func (o *osHelper) CloneFile(srcPath string, dstPath string, options node.CopyOptions) error {
+	return errors.New("copying volumes is only supported on linux")
+}
+
+func (o *osHelper) CloneTree(srcPath string, dstPath string, options node.CopyOptions) error {
+	return errors.New("copying volumes is only supported on linux")
+}
@@ -0,0 +1,295 @@
+// +build linux
+
+package oshelper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// from linux/loop.h
+const (
+	loopSetFd       = 0x4c00
+	loopClrFd       = 0x4c01
+	loopSetStatus64 = 0x4c04
+	loopGetStatus64 = 0x4c05
+	loopSetCapacity = 0x4c07
+	loopCtlGetFree  = 0x4c82
+
+	loFlagsAutoclear = 4
+
+	loopControlPath = "/dev/loop-control"
+
+	// attempts to claim a free loop device before giving up, since another
+	// process can claim the one LOOP_CTL_GET_FREE returned first
+	loopAttachAttempts = 10
+)
+
+type loopInfo64 struct {
+	device         uint64
+	inode          uint64
+	rdevice        uint64
+	offset         uint64
+	sizelimit      uint64
+	number         uint32
+	encryptType    uint32
+	encryptKeySize uint32
+	flags          uint32
+	fileName       [64]byte
+	cryptName      [64]byte
+	encryptKey     [32]byte
+	init           [2]uint64
+}
+
+func (o *osHelper) CreateImage(imagePath string, sizeBytes int64, fsType string) error {
+	file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	// truncating rather than writing keeps the image sparse
+	err = file.Truncate(sizeBytes)
+	file.Close()
+	if err != nil {
+		os.Remove(imagePath)
+		return err
+	}
+
+	// raw block volumes are handed to the application unformatted
+	if fsType == "" {
+		return nil
+	}
+
+	cmd := exec.Command("mkfs."+fsType, "-q", imagePath)
+	err = cmd.Run()
+	if err != nil {
+		os.Remove(imagePath)
+		return err
+	}
+
+	return nil
+}
+
+func (o *osHelper) MountImage(imagePath string, targetPath string) error {
+	fsType, err := imageFsType(imagePath)
+	if err != nil {
+		return err
+	}
+
+	// the kernel detaches an autoclear device once it is unmounted, or as
+	// soon as it is closed here if the mount fails
+	device, file, err := attachLoop(imagePath, loFlagsAutoclear)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = syscall.Mount(device, targetPath, fsType, 0, "")
+	if err != nil {
+		return &MountError{Op: "mount", Source: device, Target: targetPath, Err: err}
+	}
+
+	return nil
+}
+
+func (o *osHelper) AttachLoopDevice(imagePath string) (string, error) {
+	device, file, err := attachLoop(imagePath, 0)
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+
+	return device, nil
+}
+
+func (o *osHelper) FindLoopDevice(imagePath string) (string, error) {
+	var image syscall.Stat_t
+	err := syscall.Stat(imagePath, &image)
+	if os.IsNotExist(err) {
+		// an image that does not exist is not attached to anything
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	devices, err := filepath.Glob("/dev/loop[0-9]*")
+	if err != nil {
+		return "", err
+	}
+
+	for _, device := range devices {
+		info, attached, err := loopStatus(device)
+		if err != nil {
+			return "", err
+		}
+
+		if attached && info.device == uint64(image.Dev) && info.inode == uint64(image.Ino) {
+			return device, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (o *osHelper) DetachLoopDevice(devicePath string) error {
+	return loopIoctl(devicePath, loopClrFd, 0)
+}
+
+func (o *osHelper) ResizeImage(imagePath string, sizeBytes int64) error {
+	err := os.Truncate(imagePath, sizeBytes)
+	if err != nil {
+		return err
+	}
+
+	device, err := o.FindLoopDevice(imagePath)
+	if err != nil {
+		return err
+	}
+
+	if device == "" {
+		return nil
+	}
+
+	// the loop driver only notices the new backing file size when told to
+	return loopIoctl(device, loopSetCapacity, 0)
+}
+
+func (o *osHelper) GrowFilesystem(devicePath string, mountPath string) error {
+	mount, err := mountContaining(mountPath)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch mount.FsType {
+	case "ext4":
+		cmd = exec.Command("resize2fs", devicePath)
+	case "xfs":
+		cmd = exec.Command("xfs_growfs", mountPath)
+	default:
+		return fmt.Errorf("growing %s filesystems is not supported", mount.FsType)
+	}
+
+	return cmd.Run()
+}
+
+// attachLoop binds the image to a free loop device, returning the device
+// path and the open device, which the caller has to close.
+func attachLoop(imagePath string, flags uint32) (string, *os.File, error) {
+	image, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	defer image.Close()
+
+	control, err := os.OpenFile(loopControlPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	defer control.Close()
+
+	for attempt := 0; attempt < loopAttachAttempts; attempt++ {
+		number, _, errno := syscall.Syscall(syscall.SYS_IOCTL, control.Fd(), loopCtlGetFree, 0)
+		if errno != 0 {
+			return "", nil, &os.SyscallError{Syscall: "LOOP_CTL_GET_FREE", Err: errno}
+		}
+
+		device := fmt.Sprintf("/dev/loop%d", number)
+		file, err := os.OpenFile(device, os.O_RDWR, 0)
+		if err != nil {
+			return "", nil, err
+		}
+
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), loopSetFd, image.Fd())
+		if errno == syscall.EBUSY {
+			file.Close()
+			continue
+		}
+		if errno != 0 {
+			file.Close()
+			return "", nil, &os.SyscallError{Syscall: "LOOP_SET_FD", Err: errno}
+		}
+
+		if flags != 0 {
+			info := loopInfo64{flags: flags}
+			_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), loopSetStatus64, uintptr(unsafe.Pointer(&info)))
+			if errno != 0 {
+				syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), loopClrFd, 0)
+				file.Close()
+				return "", nil, &os.SyscallError{Syscall: "LOOP_SET_STATUS64", Err: errno}
+			}
+		}
+
+		return device, file, nil
+	}
+
+	return "", nil, fmt.Errorf("no free loop device for %s", imagePath)
+}
+
+// loopStatus reports the backing file of a loop device, and whether it has
+// one at all.
+func loopStatus(device string) (loopInfo64, bool, error) {
+	var info loopInfo64
+
+	file, err := os.Open(device)
+	if err != nil {
+		return info, false, err
+	}
+	defer file.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), loopGetStatus64, uintptr(unsafe.Pointer(&info)))
+	if errno == syscall.ENXIO {
+		return info, false, nil
+	}
+	if errno != 0 {
+		return info, false, &os.SyscallError{Syscall: "LOOP_GET_STATUS64", Err: errno}
+	}
+
+	return info, true, nil
+}
+
+func loopIoctl(device string, request uintptr, arg uintptr) error {
+	file, err := os.Open(device)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, arg)
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "ioctl", Err: errno}
+	}
+	return nil
+}
+
+// imageFsType recognises the filesystems CreateImage is used with from their
+// superblock magic, which mount(2), unlike mount(8), does not probe for.
+func imageFsType(imagePath string) (string, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	superblock := make([]byte, 2048)
+	_, err = file.ReadAt(superblock, 0)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(superblock, []byte("XFSB")):
+		return "xfs", nil
+	case binary.LittleEndian.Uint16(superblock[1080:]) == 0xef53:
+		return "ext4", nil
+	}
+
+	return "", fmt.Errorf("unrecognised filesystem in %s", imagePath)
+}
@@ -0,0 +1,36 @@
+// +build linux
+
+package oshelper_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/local-node-plugin/oshelper"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FindLoopDevice", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "loop")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Context("when the image does not exist", func() {
+		It("reports that no loop device is attached", func() {
+			device, err := oshelper.NewOsHelper(&osshim.OsShim{}).FindLoopDevice(filepath.Join(tmpDir, "test-volume-id.block"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(device).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,35 @@
+// +build !linux
+
+package oshelper
+
+import (
+	"errors"
+)
+
+func (o *osHelper) CreateImage(imagePath string, sizeBytes int64, fsType string) error {
+	return errors.New("loopback images are only supported on linux")
+}
+
+func (o *osHelper) MountImage(imagePath string, targetPath string) error {
+	return errors.New("loopback images are only supported on linux")
+}
+
+func (o *osHelper) AttachLoopDevice(imagePath string) (string, error) {
+	return "", errors.New("loop devices are only supported on linux")
+}
+
+func (o *osHelper) FindLoopDevice(imagePath string) (string, error) {
+	return "", nil
+}
+
+func (o *osHelper) DetachLoopDevice(devicePath string) error {
+	return errors.New("loop devices are only supported on linux")
+}
+
+func (o *osHelper) ResizeImage(imagePath string, sizeBytes int64) error {
+	return errors.New("loopback images are only supported on linux")
+}
+
+func (o *osHelper) GrowFilesystem(devicePath string, mountPath string) error {
+	return errors.New("loopback images are only supported on linux")
+}
@@ -0,0 +1,57 @@
+// +build darwin
+
+package oshelper
+
+import (
+	"os/exec"
+	"strings"
+)
+
+func (o *osHelper) Mount(srcPath string, targetPath string, options []string) error {
+	return o.bindMount(srcPath, targetPath, options)
+}
+
+func (o *osHelper) MountReadOnly(srcPath string, targetPath string, options []string) error {
+	return o.bindMount(srcPath, targetPath, append([]string{"ro"}, options...))
+}
+
+func (o *osHelper) bindMount(srcPath string, targetPath string, options []string) error {
+	cmd := exec.Command("mount", "--bind", srcPath, targetPath)
+	err := cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	if len(options) == 0 {
+		return nil
+	}
+
+	// mount options are ignored on the initial bind, so they have to be applied with a remount
+	cmd = exec.Command("mount", "-o", "remount,bind,"+strings.Join(options, ","), targetPath)
+	err = cmd.Run()
+	if err != nil {
+		o.Unmount(targetPath)
+		return err
+	}
+
+	return nil
+}
+
+func (o *osHelper) Unmount(targetPath string) error {
+	cmd := exec.Command("umount", targetPath)
+	return cmd.Run()
+}
+
+func (o *osHelper) IsMounted(targetPath string) (bool, error) {
+	cmd := exec.Command("mountpoint", "-q", targetPath)
+	err := cmd.Run()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
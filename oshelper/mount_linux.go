@@ -0,0 +1,96 @@
+// +build linux
+
+package oshelper
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var mountOptionFlags = map[string]uintptr{
+	"ro":         syscall.MS_RDONLY,
+	"noexec":     syscall.MS_NOEXEC,
+	"nosuid":     syscall.MS_NOSUID,
+	"nodev":      syscall.MS_NODEV,
+	"noatime":    syscall.MS_NOATIME,
+	"nodiratime": syscall.MS_NODIRATIME,
+	"relatime":   syscall.MS_RELATIME,
+}
+
+// MountError records the mount operation that failed along with the errno
+// returned by the kernel.
+type MountError struct {
+	Op     string
+	Source string
+	Target string
+	Err    error
+}
+
+func (e *MountError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s %s: %s", e.Op, e.Target, e.Err)
+	}
+	return fmt.Sprintf("%s %s %s: %s", e.Op, e.Source, e.Target, e.Err)
+}
+
+func (o *osHelper) Mount(srcPath string, targetPath string, options []string) error {
+	return o.bindMount(srcPath, targetPath, options)
+}
+
+func (o *osHelper) MountReadOnly(srcPath string, targetPath string, options []string) error {
+	return o.bindMount(srcPath, targetPath, append([]string{"ro"}, options...))
+}
+
+func (o *osHelper) bindMount(srcPath string, targetPath string, options []string) error {
+	flags, err := mountFlags(options)
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Mount(srcPath, targetPath, "", syscall.MS_BIND, "")
+	if err != nil {
+		return &MountError{Op: "mount", Source: srcPath, Target: targetPath, Err: err}
+	}
+
+	// the kernel keeps the source's atime setting on a remount unless told otherwise
+	if flags&syscall.MS_NOATIME == 0 {
+		flags |= syscall.MS_RELATIME
+	}
+
+	// mount flags are ignored on the initial bind, so they have to be applied
+	// with a remount, which also drops any the source was mounted with
+	err = syscall.Mount("", targetPath, "", syscall.MS_REMOUNT|syscall.MS_BIND|flags, "")
+	if err != nil {
+		o.Unmount(targetPath)
+		return &MountError{Op: "remount", Target: targetPath, Err: err}
+	}
+
+	return nil
+}
+
+func (o *osHelper) Unmount(targetPath string) error {
+	err := syscall.Unmount(targetPath, 0)
+	if err != nil {
+		return &MountError{Op: "unmount", Target: targetPath, Err: err}
+	}
+
+	return nil
+}
+
+func (o *osHelper) IsMounted(targetPath string) (bool, error) {
+	_, mounted, err := o.GetMountInfo(targetPath)
+	return mounted, err
+}
+
+func mountFlags(options []string) (uintptr, error) {
+	var flags uintptr
+	for _, option := range options {
+		flag, ok := mountOptionFlags[option]
+		if !ok {
+			return 0, fmt.Errorf("unsupported mount option %s", option)
+		}
+		flags |= flag
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,151 @@
+// +build linux
+
+package oshelper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+// GetMountInfo returns the mount whose mount point is targetPath. A target
+// that does not exist is reported as not mounted rather than as an error.
+func (o *osHelper) GetMountInfo(targetPath string) (node.MountInfo, bool, error) {
+	path, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return node.MountInfo{}, false, nil
+		}
+		return node.MountInfo{}, false, err
+	}
+
+	mounts, err := o.ListMounts()
+	if err != nil {
+		return node.MountInfo{}, false, err
+	}
+
+	// later entries are stacked on top of earlier ones at the same mount point
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].MountPoint == path {
+			return mounts[i], true, nil
+		}
+	}
+
+	return node.MountInfo{}, false, nil
+}
+
+// mountContaining returns the mount holding path, that is the topmost mount
+// whose mount point is path or its closest ancestor.
+func mountContaining(path string) (node.MountInfo, error) {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return node.MountInfo{}, err
+	}
+
+	file, err := os.Open(mountInfoPath)
+	if err != nil {
+		return node.MountInfo{}, err
+	}
+	defer file.Close()
+
+	mounts, err := parseMountInfo(file)
+	if err != nil {
+		return node.MountInfo{}, err
+	}
+
+	found := -1
+	for i, mount := range mounts {
+		if !pathWithin(path, mount.MountPoint) {
+			continue
+		}
+		if found == -1 || len(mount.MountPoint) >= len(mounts[found].MountPoint) {
+			found = i
+		}
+	}
+
+	if found == -1 {
+		return node.MountInfo{}, fmt.Errorf("no mount contains %s", path)
+	}
+	return mounts[found], nil
+}
+
+func pathWithin(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// ListMounts returns every mount visible to the plugin, in mount order.
+func (o *osHelper) ListMounts() ([]node.MountInfo, error) {
+	file, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseMountInfo(file)
+}
+
+// parseMountInfo reads the mountinfo format described in proc(5):
+//
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(r io.Reader) ([]node.MountInfo, error) {
+	mounts := []node.MountInfo{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+
+		if separator == -1 || len(fields) < separator+3 {
+			return nil, fmt.Errorf("malformed mountinfo line: %q", scanner.Text())
+		}
+
+		mounts = append(mounts, node.MountInfo{
+			Device:      fields[2],
+			Root:        unescapeMountPath(fields[3]),
+			MountPoint:  unescapeMountPath(fields[4]),
+			Options:     strings.Split(fields[5], ","),
+			Propagation: fields[6:separator],
+			FsType:      fields[separator+1],
+			Source:      unescapeMountPath(fields[separator+2]),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes the kernel uses for spaces,
+// tabs, newlines and backslashes in mountinfo paths.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package oshelper
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+)
+
+func (o *osHelper) GetMountInfo(targetPath string) (node.MountInfo, bool, error) {
+	return node.MountInfo{}, false, errors.New("mountinfo is only supported on linux")
+}
+
+func (o *osHelper) ListMounts() ([]node.MountInfo, error) {
+	return nil, errors.New("mountinfo is only supported on linux")
+}
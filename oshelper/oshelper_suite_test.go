@@ -0,0 +1,13 @@
+package oshelper_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestOshelper(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Oshelper Suite")
+}
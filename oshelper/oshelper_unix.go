@@ -3,12 +3,15 @@
 package oshelper
 
 import (
-	"os/exec"
 	"syscall"
 
 	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/local-node-plugin/node"
 )
 
+// ST_RDONLY on linux, MNT_RDONLY on darwin
+const readOnlyFlag = 0x1
+
 type osHelper struct {
 }
 
@@ -16,30 +19,30 @@ func NewOsHelper(os osshim.Os) *osHelper {
 	return &osHelper{}
 }
 
-func (o *osHelper) Umask(mask int) (oldmask int) {
-	return syscall.Umask(mask)
-}
-
-func (o *osHelper) Mount(srcPath string, targetPath string) error {
-	cmd := exec.Command("mount", "--bind", srcPath, targetPath)
-	return cmd.Run()
-}
+func (o *osHelper) IsReadOnly(targetPath string) (bool, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(targetPath, &stat)
+	if err != nil {
+		return false, err
+	}
 
-func (o *osHelper) Unmount(targetPath string) error {
-	cmd := exec.Command("umount", targetPath)
-	return cmd.Run()
+	return uint64(stat.Flags)&readOnlyFlag != 0, nil
 }
 
-func (o *osHelper) IsMounted(targetPath string) (bool, error) {
-	cmd := exec.Command("mountpoint", "-q", targetPath)
-	err := cmd.Run()
+func (o *osHelper) Statfs(path string) (node.FilesystemStats, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
 	if err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
-			return false, nil
-		}
-
-		return false, err
+		return node.FilesystemStats{}, err
 	}
 
-	return true, nil
+	blockSize := int64(stat.Bsize)
+	return node.FilesystemStats{
+		TotalBytes:     int64(stat.Blocks) * blockSize,
+		AvailableBytes: int64(stat.Bavail) * blockSize,
+		UsedBytes:      int64(stat.Blocks-stat.Bfree) * blockSize,
+		TotalInodes:    int64(stat.Files),
+		FreeInodes:     int64(stat.Ffree),
+		UsedInodes:     int64(stat.Files - stat.Ffree),
+	}, nil
 }
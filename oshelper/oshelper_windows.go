@@ -3,9 +3,11 @@
 package oshelper
 
 import (
+	"errors"
 	"os"
 
 	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/local-node-plugin/node"
 )
 
 type osHelper struct {
@@ -18,12 +20,15 @@ func NewOsHelper(os osshim.Os) *osHelper {
 	}
 }
 
-func (o *osHelper) Umask(mask int) (oldmask int) {
-	return 0
+func (o *osHelper) Mount(srcPath string, targetPath string, options []string) error {
+	if len(options) > 0 {
+		return errors.New("mount options are not supported on windows")
+	}
+	return o.os.Symlink(srcPath, targetPath)
 }
 
-func (o *osHelper) Mount(srcPath string, targetPath string) error {
-	return o.os.Symlink(srcPath, targetPath)
+func (o *osHelper) MountReadOnly(srcPath string, targetPath string, options []string) error {
+	return errors.New("read-only mounts are not supported on windows")
 }
 
 func (o *osHelper) Unmount(targetPath string) error {
@@ -40,3 +45,11 @@ func (o *osHelper) IsMounted(targetPath string) (bool, error) {
 	}
 	return true, err
 }
+
+func (o *osHelper) IsReadOnly(targetPath string) (bool, error) {
+	return false, nil
+}
+
+func (o *osHelper) Statfs(path string) (node.FilesystemStats, error) {
+	return node.FilesystemStats{}, errors.New("volume stats are not supported on windows")
+}
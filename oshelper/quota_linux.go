@@ -0,0 +1,152 @@
+// +build linux
+
+package oshelper
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+)
+
+// from linux/fs.h and linux/quota.h
+const (
+	fsIocFsGetXattr    = 0x801c581f
+	fsIocFsSetXattr    = 0x401c5820
+	fsXflagProjInherit = 0x00000200
+
+	prjQuota  = 2
+	qGetQuota = 0x800007
+	qSetQuota = 0x800008
+	qifLimits = 0x5 // QIF_BLIMITS | QIF_ILIMITS
+
+	quotaBlockSize = 1024
+)
+
+type fsxattr struct {
+	xflags     uint32
+	extsize    uint32
+	nextents   uint32
+	projid     uint32
+	cowextsize uint32
+	pad        [8]byte
+}
+
+type ifDqblk struct {
+	bHardLimit uint64
+	bSoftLimit uint64
+	curSpace   uint64
+	iHardLimit uint64
+	iSoftLimit uint64
+	curInodes  uint64
+	bTime      uint64
+	iTime      uint64
+	valid      uint32
+}
+
+func (o *osHelper) SupportsProjectQuota(path string) (bool, error) {
+	device, err := mountSource(path)
+	if err != nil {
+		return false, err
+	}
+
+	// quotactl fails when project quotas are not enabled on the filesystem
+	var dq ifDqblk
+	return quotactl(qGetQuota, device, 0, &dq) == nil, nil
+}
+
+func (o *osHelper) GetProjectId(path string) (uint32, error) {
+	var attr fsxattr
+	err := fsxattrIoctl(path, fsIocFsGetXattr, &attr)
+	if err != nil {
+		return 0, err
+	}
+
+	return attr.projid, nil
+}
+
+func (o *osHelper) SetProjectQuota(path string, projectId uint32, limits node.QuotaLimits) error {
+	var attr fsxattr
+	err := fsxattrIoctl(path, fsIocFsGetXattr, &attr)
+	if err != nil {
+		return err
+	}
+
+	// new files and directories inherit the project ID of the volume directory
+	attr.projid = projectId
+	attr.xflags |= fsXflagProjInherit
+	err = fsxattrIoctl(path, fsIocFsSetXattr, &attr)
+	if err != nil {
+		return err
+	}
+
+	device, err := mountSource(path)
+	if err != nil {
+		return err
+	}
+
+	dq := ifDqblk{
+		bHardLimit: uint64((limits.Bytes + quotaBlockSize - 1) / quotaBlockSize),
+		iHardLimit: uint64(limits.Inodes),
+		valid:      qifLimits,
+	}
+	return quotactl(qSetQuota, device, projectId, &dq)
+}
+
+func (o *osHelper) GetProjectQuota(path string, projectId uint32) (node.QuotaStats, error) {
+	device, err := mountSource(path)
+	if err != nil {
+		return node.QuotaStats{}, err
+	}
+
+	var dq ifDqblk
+	err = quotactl(qGetQuota, device, projectId, &dq)
+	if err != nil {
+		return node.QuotaStats{}, err
+	}
+
+	return node.QuotaStats{
+		LimitBytes:  int64(dq.bHardLimit) * quotaBlockSize,
+		UsedBytes:   int64(dq.curSpace),
+		LimitInodes: int64(dq.iHardLimit),
+		UsedInodes:  int64(dq.curInodes),
+	}, nil
+}
+
+func mountSource(path string) (string, error) {
+	mount, err := mountContaining(path)
+	if err != nil {
+		return "", err
+	}
+
+	return mount.Source, nil
+}
+
+func fsxattrIoctl(path string, request uintptr, attr *fsxattr) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, uintptr(unsafe.Pointer(attr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func quotactl(cmd int, device string, id uint32, dq *ifDqblk) error {
+	devicePtr, err := syscall.BytePtrFromString(device)
+	if err != nil {
+		return err
+	}
+
+	qcmd := uintptr(cmd<<8 | prjQuota)
+	_, _, errno := syscall.Syscall6(syscall.SYS_QUOTACTL, qcmd, uintptr(unsafe.Pointer(devicePtr)), uintptr(id), uintptr(unsafe.Pointer(dq)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+// +build !linux
+
+package oshelper
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/local-node-plugin/node"
+)
+
+func (o *osHelper) SupportsProjectQuota(path string) (bool, error) {
+	return false, nil
+}
+
+func (o *osHelper) GetProjectId(path string) (uint32, error) {
+	return 0, nil
+}
+
+func (o *osHelper) SetProjectQuota(path string, projectId uint32, limits node.QuotaLimits) error {
+	return errors.New("project quotas are only supported on linux")
+}
+
+func (o *osHelper) GetProjectQuota(path string, projectId uint32) (node.QuotaStats, error) {
+	return node.QuotaStats{}, errors.New("project quotas are only supported on linux")
+}
@@ -5,6 +5,8 @@ echo "installing ifrit"
 go get -u "github.com/tedsuo/ifrit"
 echo "installing lager"
 go get -u "code.cloudfoundry.org/lager"
+echo "installing clock"
+go get -u "code.cloudfoundry.org/clock"
 echo "installing goshims"
 go get -u "code.cloudfoundry.org/goshims" >/dev/null 2>&1 || true
 echo "installing ginkgo..."
@@ -14,6 +16,8 @@ go get -u "github.com/onsi/gomega"
 go get -u "github.com/onsi/gomega/types"
 echo "installing grpc..."
 go get -u "google.golang.org/grpc"
+echo "installing protobuf..."
+go get -u "github.com/golang/protobuf/ptypes"
 echo "installing csi spec..."
 go get -u "github.com/paulcwarren/spec"
 